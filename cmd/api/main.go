@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -22,9 +24,11 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
-	"github.com/markbates/goth/providers/spotify"
+	"github.com/tuannamnguyen/playlist-manager/internal/encryption"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
 	"github.com/tuannamnguyen/playlist-manager/internal/repository"
 	"github.com/tuannamnguyen/playlist-manager/internal/rest"
+	authmiddleware "github.com/tuannamnguyen/playlist-manager/internal/rest/middleware"
 	"github.com/tuannamnguyen/playlist-manager/internal/service"
 	"gopkg.in/boj/redistore.v1"
 )
@@ -96,7 +100,8 @@ func run() error {
 		return fmt.Errorf("unable to connect to Redis for session store: %v", err)
 	}
 	defer store.Close()
-	store.SetMaxAge(3600)
+	// the session only holds who the user is, provider credentials are stored in postgres
+	store.SetMaxAge(30 * 24 * 3600)
 
 	isProd, err := strconv.ParseBool(os.Getenv("IS_PROD"))
 	if err != nil {
@@ -110,24 +115,65 @@ func run() error {
 
 	gob.Register(goth.User{})
 	gothic.Store = store
-	goth.UseProviders(
-		spotify.New(
-			os.Getenv("SPOTIFY_ID"),
-			os.Getenv("SPOTIFY_SECRET"),
-			os.Getenv("SPOTIFY_REDIRECT_URL"),
-			spotify.ScopePlaylistModifyPrivate,
-			spotify.ScopePlaylistModifyPublic,
-			spotify.ScopePlaylistReadPrivate,
-			spotify.ScopeStreaming,
-		),
+	providers, err := newProviderRegistry()
+	if err != nil {
+		return fmt.Errorf("registering providers: %v", err)
+	}
+	goth.UseProviders(providers.OAuthProviders()...)
+
+	// setup provider credentials
+	credentialCipher, err := encryption.NewCipher(os.Getenv("CREDENTIALS_ENCRYPTION_KEY"))
+	if err != nil {
+		return fmt.Errorf("setting up credentials encryption: %v", err)
+	}
+	credentialRepo := repository.NewProviderCredentialRepository(db, credentialCipher)
+	credentialService := service.NewCredential(credentialRepo, providers)
+	providers.UseTokenSource(credentialService)
+
+	userService := service.NewUser(repository.NewUserRepository(db), credentialRepo)
+
+	// setup background conversion jobs
+	jobService := service.NewConversionJob(
+		repository.NewConversionJobRepository(db, credentialCipher),
+		repository.NewPlaylistSongRepository(db),
+		repository.NewPlaylistRemoteLinkRepository(db, credentialCipher),
+		providers,
+		4,
 	)
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	jobService.Start(jobCtx)
+
+	// setup scheduled two-way sync
+	syncService := service.NewSync(
+		repository.NewPlaylistRemoteLinkRepository(db, credentialCipher),
+		repository.NewPlaylistSongRepository(db),
+		newPlaylistService(db, gcsClient, httpClient, providers),
+		providers,
+	)
+	syncCtx, stopSync := context.WithCancel(context.Background())
+	defer stopSync()
+	syncService.Start(syncCtx)
+
+	// setup purge of the playlists trash
+	trashService := service.NewTrash(repository.NewPlaylistRepository(db, gcsClient, httpClient))
+	trashCtx, stopTrash := context.WithCancel(context.Background())
+	defer stopTrash()
+	trashService.Start(trashCtx)
+
+	// share links and their previews point at the public address of the API, the Host header can't be trusted
+	publicBaseURL := strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+	parsedBaseURL, err := url.Parse(publicBaseURL)
+	if err != nil || parsedBaseURL.Scheme == "" || parsedBaseURL.Host == "" {
+		return fmt.Errorf("PUBLIC_BASE_URL must be an absolute url, got %q", publicBaseURL)
+	}
 
 	// setup server
 	e := echo.New()
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGKILL, syscall.SIGTERM)
 	defer stop()
 
-	go startServer(e, db, httpClient, store, gcsClient)
+	go startServer(e, db, httpClient, store, gcsClient, providers, credentialService, userService, jobService, syncService, trashService, publicBaseURL)
 
 	// Wait for interrupt signal to gracefully shutdown the server with a timeout of 10 seconds.
 	<-ctx.Done()
@@ -137,29 +183,58 @@ func run() error {
 		e.Logger.Fatal(err)
 	}
 
+	// running jobs are requeued so the next server can resume them
+	stopJobs()
+	stopSync()
+	stopTrash()
+	jobService.Wait()
+	syncService.Wait()
+	trashService.Wait()
+
 	return nil
 }
 
-func startServer(e *echo.Echo, db *sqlx.DB, httpClient *http.Client, store sessions.Store, gcsClient *storage.Client) {
+func startServer(
+	e *echo.Echo,
+	db *sqlx.DB,
+	httpClient *http.Client,
+	store sessions.Store,
+	gcsClient *storage.Client,
+	providers *service.ProviderRegistry,
+	credentialService *service.CredentialService,
+	userService *service.UserService,
+	jobService *service.ConversionJobService,
+	syncService *service.SyncService,
+	trashService *service.TrashService,
+	publicBaseURL string,
+) {
 	e.Pre(middleware.RemoveTrailingSlash())
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     []string{os.Getenv("FRONTEND_URL")},
-		AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.DELETE},
-		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
+		AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.PATCH, echo.DELETE},
+		AllowHeaders:     append([]string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization}, providerHeaders(providers)...),
 		AllowCredentials: true,
 	}))
 
 	log.Printf("frontend url: %s", os.Getenv("FRONTEND_URL"))
 
-	e.Validator = &CustomValidator{validator: validator.New()}
+	v := validator.New()
+	err := v.RegisterValidation("provider", func(fl validator.FieldLevel) bool {
+		_, ok := providers.Get(fl.Field().String())
+		return ok
+	})
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	e.Validator = &CustomValidator{validator: v}
 
 	e.GET("/healthcheck", func(c echo.Context) error {
 		return c.String(http.StatusOK, "healthcheck ok")
 	})
 
-	setupAPIRouter(e, db, httpClient, store, gcsClient)
+	setupAPIRouter(e, db, httpClient, store, gcsClient, providers, credentialService, userService, jobService, syncService, trashService, publicBaseURL)
 
 	if err := e.Start(":8080"); err != nil && err != http.ErrServerClosed {
 		// if error here, check if there are any other apps running on the same port
@@ -167,62 +242,185 @@ func startServer(e *echo.Echo, db *sqlx.DB, httpClient *http.Client, store sessi
 	}
 }
 
-func setupAPIRouter(e *echo.Echo, db *sqlx.DB, httpClient *http.Client, store sessions.Store, gcsClient *storage.Client) {
-	apiRouter := e.Group("/api")
+func setupAPIRouter(
+	e *echo.Echo,
+	db *sqlx.DB,
+	httpClient *http.Client,
+	store sessions.Store,
+	gcsClient *storage.Client,
+	providers *service.ProviderRegistry,
+	credentialService *service.CredentialService,
+	userService *service.UserService,
+	jobService *service.ConversionJobService,
+	syncService *service.SyncService,
+	trashService *service.TrashService,
+	publicBaseURL string,
+) {
+	userHandler := rest.NewUserHandler(userService)
+	memberService := service.NewMember(repository.NewPlaylistMemberRepository(db))
+	shareService := service.NewShare(
+		repository.NewPlaylistShareRepository(db),
+		repository.NewPlaylistRepository(db, gcsClient, httpClient),
+		repository.NewPlaylistSongRepository(db),
+	)
+	shareHandler := rest.NewShareHandler(shareService, publicBaseURL)
+
+	// the provider login and its callback are browser redirects, which can't carry the token
+	publicOAuthRouter := e.Group("/api/oauth")
+	// share links are for people without an account
+	publicShareRouter := e.Group("/api/share")
+
+	apiRouter := e.Group("/api", authmiddleware.EnsureValidTokenMiddleware(), userHandler.RegisterUser)
 
 	apiRouter.GET("/test", func(c echo.Context) error {
 		return c.String(http.StatusOK, "You have been authenticated")
 	})
-	playlistRouter := apiRouter.Group("/playlists")
-	searchRouter := apiRouter.Group("/search")
-	oauthRouter := apiRouter.Group("/oauth")
-	metadataRouter := apiRouter.Group("/metadata")
 
-	setupPlaylistRoutes(playlistRouter, db, store, gcsClient)
+	read := authmiddleware.RequireScopes(authmiddleware.ScopePlaylistsRead)
+	convert := authmiddleware.RequireScopes(authmiddleware.ScopePlaylistsConvert)
+
+	// playlist routes declare their scopes per route
+	playlistRouter := apiRouter.Group("/playlists")
+	searchRouter := apiRouter.Group("/search", read)
+	oauthRouter := apiRouter.Group("/oauth", convert)
+	metadataRouter := apiRouter.Group("/metadata", read)
+	jobRouter := apiRouter.Group("/jobs", read)
+	providerRouter := apiRouter.Group("/providers", read)
+	// every signed in user can see and edit their own profile
+	meRouter := apiRouter.Group("/me")
+	inviteRouter := apiRouter.Group("/invites", read)
+
+	setupPlaylistRoutes(playlistRouter, db, httpClient, store, gcsClient, providers, memberService, shareHandler, jobService, syncService, trashService)
 	setupSearchRoutes(searchRouter, httpClient)
-	setupOAuthRoutes(oauthRouter, store)
+	setupOAuthRoutes(oauthRouter, publicOAuthRouter, credentialService, store)
 	setupMetadataRoutes(metadataRouter, store)
+	setupJobRoutes(jobRouter, store, providers, memberService, jobService)
+	setupProviderRoutes(providerRouter, providers)
+	setupUserRoutes(meRouter, userHandler)
+	setupInviteRoutes(inviteRouter, memberService)
+	setupShareRoutes(e, publicShareRouter, shareHandler)
 }
 
-func setupPlaylistRoutes(router *echo.Group, db *sqlx.DB, store sessions.Store, gcsClient *storage.Client) {
+func setupPlaylistRoutes(
+	router *echo.Group,
+	db *sqlx.DB,
+	httpClient *http.Client,
+	store sessions.Store,
+	gcsClient *storage.Client,
+	providers *service.ProviderRegistry,
+	memberService *service.MemberService,
+	shareHandler *rest.ShareHandler,
+	jobService *service.ConversionJobService,
+	syncService *service.SyncService,
+	trashService *service.TrashService,
+) {
 	// setup playlist endpoint
-	playlistRepository := repository.NewPlaylistRepository(db, gcsClient)
-	songRepository := repository.NewSongRepository(db)
-	playlistSongRepository := repository.NewPlaylistSongRepository(db)
-	albumRepository := repository.NewAlbumRepository(db)
-	artistRepository := repository.NewArtistRepository(db)
-	artistSongRepository := repository.NewArtistSongRepository(db)
-	artistAlbumRepository := repository.NewArtistAlbumRepository(db)
-
-	playlistService := service.NewPlaylist(
-		playlistRepository,
-		songRepository,
-		playlistSongRepository,
-		albumRepository,
-		artistRepository,
-		artistSongRepository,
-		artistAlbumRepository,
-	)
-	playlistHandler := rest.NewPlaylistHandler(playlistService, store)
+	playlistService := newPlaylistService(db, gcsClient, httpClient, providers)
+	playlistHandler := rest.NewPlaylistHandler(playlistService, store, providers)
+	combineHandler := rest.NewCombineHandler(playlistService, memberService)
+	duplicateService := service.NewDuplicate(repository.NewPlaylistSongRepository(db))
+	duplicateHandler := rest.NewDuplicateHandler(duplicateService)
+	memberHandler := rest.NewMemberHandler(memberService)
+	versionService := service.NewVersion(repository.NewPlaylistVersionRepository(db), repository.NewSongRepository(db))
+	versionHandler := rest.NewVersionHandler(versionService)
+	trashHandler := rest.NewTrashHandler(trashService)
+	jobHandler := rest.NewConversionJobHandler(jobService, store, providers, memberService)
+	syncHandler := rest.NewSyncHandler(syncService, store, providers)
+
+	// routes of a single playlist are only for its members with the role, the scope is checked first
+	viewer := memberHandler.RequireRole(model.PlaylistRoleViewer)
+	editor := memberHandler.RequireRole(model.PlaylistRoleEditor)
+	owner := memberHandler.RequireRole(model.PlaylistRoleOwner)
+	read := authmiddleware.RequireScopes(authmiddleware.ScopePlaylistsRead)
+	write := authmiddleware.RequireScopes(authmiddleware.ScopePlaylistsWrite)
+	convert := authmiddleware.RequireScopes(authmiddleware.ScopePlaylistsConvert)
+	// importing reads from the provider and creates a playlist
+	importing := authmiddleware.RequireScopes(authmiddleware.ScopePlaylistsConvert, authmiddleware.ScopePlaylistsWrite)
 
 	// playlist CRUD
-	router.POST("", playlistHandler.Add)
-	router.GET("", playlistHandler.GetAll)
-	router.GET("/:id", playlistHandler.GetByID)
-	router.DELETE("/:id", playlistHandler.DeleteByID)
+	router.POST("", playlistHandler.Add, write)
+	router.GET("", playlistHandler.GetAll, read)
+	router.GET("/:id", playlistHandler.GetByID, read, viewer)
+	router.PUT("/:id", playlistHandler.Update, write, editor)
+	router.PATCH("/:id", playlistHandler.Update, write, editor)
+	router.DELETE("/:id", playlistHandler.DeleteByID, write, owner)
+	// members and anyone with a share link of the playlist can duplicate it
+	router.POST("/:id/duplicate", playlistHandler.Duplicate, read, write, shareHandler.OrShared(viewer))
+	// the roles on the source and target playlists are checked by the handler
+	router.POST("/combine", combineHandler.Combine, read, write)
+	// duplicates across the playlists the user is a member of
+	router.GET("/duplicates", duplicateHandler.GetAcrossPlaylists, read)
+
+	// duplicate songs endpoints
+	router.GET("/:playlist_id/duplicates", duplicateHandler.GetInPlaylist, read, viewer)
+	router.POST("/:playlist_id/dedupe", duplicateHandler.Dedupe, write, editor)
+
+	// smart playlist endpoints
+	router.PUT("/:playlist_id/rules", playlistHandler.UpdateSmartRules, write, editor)
+	router.POST("/:playlist_id/freeze", playlistHandler.Freeze, write, editor)
+
+	// trash endpoints, only the owner of a playlist sees it in their trash
+	router.GET("/trash", trashHandler.GetAll, read)
+	router.POST("/trash/:id/restore", trashHandler.Restore, write)
+	router.DELETE("/trash/:id", trashHandler.Purge, write)
+
+	// playlist members endpoints
+	router.GET("/:playlist_id/members", memberHandler.GetAll, read, viewer)
+	router.PATCH("/:playlist_id/members/:user_id", memberHandler.UpdateRole, write, owner)
+	router.DELETE("/:playlist_id/members/:user_id", memberHandler.Remove, write, owner)
+	router.POST("/:playlist_id/invites", memberHandler.Invite, write, owner)
+	router.DELETE("/:playlist_id/invites/:token", memberHandler.RevokeInvite, write, owner)
+
+	// history endpoints
+	router.GET("/:playlist_id/history", versionHandler.GetAll, read, viewer)
+	router.GET("/:playlist_id/history/diff", versionHandler.Diff, read, viewer)
+	router.POST("/:playlist_id/restore/:version", versionHandler.Restore, write, editor)
+
+	// share links endpoints
+	router.GET("/:playlist_id/shares", shareHandler.GetAll, read, owner)
+	router.POST("/:playlist_id/shares", shareHandler.Create, write, owner)
+	router.DELETE("/:playlist_id/shares/:token", shareHandler.Revoke, write, owner)
 
 	// playlist-songs table endpoints
 	playlistSongsEndpoint := "/:playlist_id/songs"
-	router.POST(playlistSongsEndpoint, playlistHandler.AddSongsToPlaylist)
-	router.GET(playlistSongsEndpoint, playlistHandler.GetAllSongsFromPlaylist)
-	router.DELETE(playlistSongsEndpoint, playlistHandler.DeleteSongsFromPlaylist)
+	router.POST(playlistSongsEndpoint, playlistHandler.AddSongsToPlaylist, write, editor)
+	router.GET(playlistSongsEndpoint, playlistHandler.GetAllSongsFromPlaylist, read, viewer)
+	router.DELETE(playlistSongsEndpoint, playlistHandler.DeleteSongsFromPlaylist, write, editor)
+	router.POST(playlistSongsEndpoint+"/move", playlistHandler.MoveSongsInPlaylist, write, editor)
+	router.PUT(playlistSongsEndpoint+"/order", playlistHandler.ReorderSongsInPlaylist, write, editor)
 
 	// conversion endpoints
-	router.POST("/:playlist_id/convert/:provider", playlistHandler.ConvertHandler)
+	router.POST("/:playlist_id/convert/:provider", jobHandler.ConvertHandler, convert, editor)
+	router.POST("/:playlist_id/sync/:provider", jobHandler.SyncHandler, convert, editor)
+	// two-way sync changes the playlist as well as the remote playlist
+	router.POST("/:playlist_id/sync/:provider/two-way", syncHandler.TwoWaySyncHandler, convert, write, editor)
+
+	// import endpoints
+	router.GET("/import/:provider", playlistHandler.ListRemotePlaylistsHandler, convert)
+	router.POST("/import/:provider/:remote_playlist_id", playlistHandler.ImportHandler, importing)
 
 	// csv endpoints
-	router.GET("/:playlist_id/songs/csv", playlistHandler.GetAllSongsFromPlaylistToCsv)
-	router.POST("/:playlist_id/songs/csv", playlistHandler.AddSongsToPlaylistFromCsv)
+	router.GET("/:playlist_id/songs/csv", playlistHandler.GetAllSongsFromPlaylistToCsv, read, viewer)
+	router.POST("/:playlist_id/songs/csv", playlistHandler.AddSongsToPlaylistFromCsv, write, editor)
+}
+
+func newPlaylistService(
+	db *sqlx.DB,
+	gcsClient *storage.Client,
+	httpClient *http.Client,
+	providers *service.ProviderRegistry,
+) *service.PlaylistService {
+	return service.NewPlaylist(
+		repository.NewPlaylistRepository(db, gcsClient, httpClient),
+		repository.NewSongRepository(db),
+		repository.NewPlaylistSongRepository(db),
+		repository.NewAlbumRepository(db),
+		repository.NewArtistRepository(db),
+		repository.NewArtistSongRepository(db),
+		repository.NewArtistAlbumRepository(db),
+		service.NewMember(repository.NewPlaylistMemberRepository(db)),
+		providers,
+	)
 }
 
 func setupSearchRoutes(router *echo.Group, httpClient *http.Client) {
@@ -234,11 +432,19 @@ func setupSearchRoutes(router *echo.Group, httpClient *http.Client) {
 	router.POST("", searchHandler.SearchMusicData)
 }
 
-func setupOAuthRoutes(router *echo.Group, store sessions.Store) {
-	oauthHandler := rest.NewOAuthHandler(store)
+func setupOAuthRoutes(
+	router *echo.Group,
+	publicRouter *echo.Group,
+	credentialService *service.CredentialService,
+	store sessions.Store,
+) {
+	oauthHandler := rest.NewOAuthHandler(credentialService, store)
+
+	publicRouter.GET("/:provider", oauthHandler.LoginHandler)
+	publicRouter.GET("/callback/:provider", oauthHandler.CallbackHandler)
 
-	router.GET("/:provider", oauthHandler.LoginHandler)
-	router.GET("/callback/:provider", oauthHandler.CallbackHandler)
+	router.POST("/session", oauthHandler.SessionHandler)
+	router.GET("/connections", oauthHandler.ConnectionsHandler)
 	router.GET("/token/:provider", oauthHandler.GetAccessTokenHandler)
 	router.GET("/check_auth/:provider", oauthHandler.CheckAuthHandler)
 	router.GET("/logout/:provider", oauthHandler.LogoutHandler)
@@ -251,3 +457,41 @@ func setupMetadataRoutes(router *echo.Group, store sessions.Store) {
 	router.POST("/song_lyrics", metadataHandler.GetLyrics)
 	router.GET("/artist_information", metadataHandler.GetArtistInformation)
 }
+
+func setupJobRoutes(
+	router *echo.Group,
+	store sessions.Store,
+	providers *service.ProviderRegistry,
+	memberService *service.MemberService,
+	jobService *service.ConversionJobService,
+) {
+	jobHandler := rest.NewConversionJobHandler(jobService, store, providers, memberService)
+
+	router.GET("/:id", jobHandler.GetByID)
+}
+
+func setupProviderRoutes(router *echo.Group, providers *service.ProviderRegistry) {
+	providerHandler := rest.NewProviderHandler(providers)
+
+	router.GET("", providerHandler.ListHandler)
+}
+
+func setupUserRoutes(router *echo.Group, userHandler *rest.UserHandler) {
+	router.GET("", userHandler.GetMe)
+	router.PATCH("", userHandler.UpdateMe)
+}
+
+func setupInviteRoutes(router *echo.Group, memberService *service.MemberService) {
+	memberHandler := rest.NewMemberHandler(memberService)
+
+	router.POST("/:token/accept", memberHandler.AcceptInvite)
+}
+
+func setupShareRoutes(e *echo.Echo, router *echo.Group, shareHandler *rest.ShareHandler) {
+	router.GET("/:token", shareHandler.GetPlaylist)
+	router.GET("/:token/songs", shareHandler.GetSongs)
+	router.GET("/:token/cover", shareHandler.Cover)
+
+	e.GET("/share/:token", shareHandler.Page)
+	e.GET("/api/oembed", shareHandler.OEmbed)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/markbates/goth"
+	"github.com/markbates/goth/providers/deezer"
+	"github.com/markbates/goth/providers/google"
+	"github.com/markbates/goth/providers/spotify"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service"
+	applemusicconverter "github.com/tuannamnguyen/playlist-manager/internal/service/converters/applemusic"
+	deezerconverter "github.com/tuannamnguyen/playlist-manager/internal/service/converters/deezer"
+	spotifyconverter "github.com/tuannamnguyen/playlist-manager/internal/service/converters/spotify"
+	tidalconverter "github.com/tuannamnguyen/playlist-manager/internal/service/converters/tidal"
+	youtubemusicconverter "github.com/tuannamnguyen/playlist-manager/internal/service/converters/youtubemusic"
+)
+
+const musicUserTokenField = "musicUserToken"
+
+// newProviderRegistry registers every provider playlists can be exported to.
+// Adding a provider only takes a registration here.
+func newProviderRegistry() (*service.ProviderRegistry, error) {
+	registry := service.NewProviderRegistry()
+
+	registrations := []service.ProviderRegistration{
+		{
+			Info: model.ProviderInfo{
+				Name:         "spotify",
+				DisplayName:  "Spotify",
+				Auth:         model.ProviderAuthOAuth,
+				Capabilities: model.ProviderCapabilities{RemoveTracks: true},
+			},
+			OAuth: spotify.New(
+				os.Getenv("SPOTIFY_ID"),
+				os.Getenv("SPOTIFY_SECRET"),
+				os.Getenv("SPOTIFY_REDIRECT_URL"),
+				spotify.ScopePlaylistModifyPrivate,
+				spotify.ScopePlaylistModifyPublic,
+				spotify.ScopePlaylistReadPrivate,
+				spotify.ScopeStreaming,
+			),
+			NewConverter: func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (service.Converter, error) {
+				return spotifyconverter.New(ctx, providerMetadata.Token), nil
+			},
+			NewImporter: func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (service.Importer, error) {
+				return spotifyconverter.New(ctx, providerMetadata.Token), nil
+			},
+			NewTwoWaySyncer: func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (service.TwoWaySyncer, error) {
+				return spotifyconverter.New(ctx, providerMetadata.Token), nil
+			},
+		},
+		{
+			Info: model.ProviderInfo{
+				Name:        "applemusic",
+				DisplayName: "Apple Music",
+				Auth:        model.ProviderAuthRequest,
+				Metadata: []model.ProviderMetadataField{
+					{
+						Name:        musicUserTokenField,
+						Header:      "Music-User-Token",
+						Description: "Music user token from MusicKit authorization",
+						Required:    true,
+					},
+				},
+			},
+			NewConverter: func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (service.Converter, error) {
+				return applemusicconverter.New(ctx, providerMetadata.Values[musicUserTokenField]), nil
+			},
+			NewImporter: func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (service.Importer, error) {
+				return applemusicconverter.New(ctx, providerMetadata.Values[musicUserTokenField]), nil
+			},
+		},
+		{
+			Info: model.ProviderInfo{
+				Name:         "youtubemusic",
+				DisplayName:  "YouTube Music",
+				Auth:         model.ProviderAuthOAuth,
+				Capabilities: model.ProviderCapabilities{RemoveTracks: true},
+			},
+			OAuth: newYouTubeMusicProvider(),
+			NewConverter: func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (service.Converter, error) {
+				return youtubemusicconverter.New(ctx, providerMetadata.Token)
+			},
+		},
+		{
+			Info: model.ProviderInfo{
+				Name:         "deezer",
+				DisplayName:  "Deezer",
+				Auth:         model.ProviderAuthOAuth,
+				Capabilities: model.ProviderCapabilities{RemoveTracks: true},
+			},
+			OAuth: deezer.New(
+				os.Getenv("DEEZER_ID"),
+				os.Getenv("DEEZER_SECRET"),
+				os.Getenv("DEEZER_REDIRECT_URL"),
+				deezerconverter.Scopes...,
+			),
+			NewConverter: func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (service.Converter, error) {
+				return deezerconverter.New(ctx, providerMetadata.Token), nil
+			},
+		},
+		{
+			Info: model.ProviderInfo{
+				Name:         "tidal",
+				DisplayName:  "TIDAL",
+				Auth:         model.ProviderAuthOAuth,
+				Capabilities: model.ProviderCapabilities{RemoveTracks: true},
+			},
+			OAuth: tidalconverter.NewProvider(
+				os.Getenv("TIDAL_ID"),
+				os.Getenv("TIDAL_SECRET"),
+				os.Getenv("TIDAL_REDIRECT_URL"),
+				tidalconverter.Scopes...,
+			),
+			NewConverter: func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (service.Converter, error) {
+				return tidalconverter.New(ctx, providerMetadata.Token), nil
+			},
+		},
+	}
+
+	for _, registration := range registrations {
+		if err := registry.Register(registration); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+// newYouTubeMusicProvider logs in with Google, asking for a refresh token so exports keep working after the access token expires.
+func newYouTubeMusicProvider() goth.Provider {
+	provider := google.New(
+		os.Getenv("YOUTUBE_MUSIC_ID"),
+		os.Getenv("YOUTUBE_MUSIC_SECRET"),
+		os.Getenv("YOUTUBE_MUSIC_REDIRECT_URL"),
+		// goth fetches the user from the userinfo endpoint, which needs these scopes
+		"email",
+		"profile",
+		youtubemusicconverter.Scope,
+	)
+	provider.SetName("youtubemusic")
+	provider.SetAccessType("offline")
+	provider.SetPrompt("consent")
+
+	return provider
+}
+
+// providerHeaders returns the request headers providers read their metadata from, which CORS has to allow.
+func providerHeaders(providers *service.ProviderRegistry) []string {
+	var headers []string
+	for _, info := range providers.List() {
+		for _, field := range info.Metadata {
+			if field.Header != "" {
+				headers = append(headers, field.Header)
+			}
+		}
+	}
+	return headers
+}
@@ -0,0 +1,31 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCipher(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	c, err := NewCipher(key)
+	require.NoError(t, err)
+
+	ciphertext, err := c.Encrypt([]byte("access token"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "access token")
+
+	plaintext, err := c.Decrypt(ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "access token", string(plaintext))
+
+	ciphertext[len(ciphertext)-1] ^= 1
+	_, err = c.Decrypt(ciphertext)
+	assert.Error(t, err, "tampered ciphertext")
+
+	_, err = NewCipher(base64.StdEncoding.EncodeToString(make([]byte, 16)))
+	assert.Error(t, err, "short key")
+}
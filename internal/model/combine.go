@@ -0,0 +1,41 @@
+package model
+
+// SetOperation is how the songs of several playlists are combined.
+type SetOperation string
+
+const (
+	// SetOperationUnion keeps the songs in any of the playlists
+	SetOperationUnion SetOperation = "union"
+	// SetOperationIntersection keeps the songs in every playlist
+	SetOperationIntersection SetOperation = "intersection"
+	// SetOperationDifference keeps the songs of the first playlist that aren't in the others
+	SetOperationDifference SetOperation = "difference"
+	// SetOperationSymmetricDifference keeps the songs in exactly one of the playlists
+	SetOperationSymmetricDifference SetOperation = "symmetric_difference"
+)
+
+// CombineOrder is the order of the songs of combined playlists.
+type CombineOrder string
+
+const (
+	// CombineOrderSource keeps the songs in the order of the playlists they come from, one playlist after the other
+	CombineOrderSource     CombineOrder = "source"
+	CombineOrderInterleave CombineOrder = "interleave"
+	CombineOrderSongName   CombineOrder = "song_name"
+	CombineOrderAlbumName  CombineOrder = "album_name"
+	CombineOrderDuration   CombineOrder = "duration"
+	CombineOrderAddedAt    CombineOrder = "added_at"
+)
+
+// PlaylistCombineIn combines the songs of the source playlists into a new playlist named Name,
+// or into the playlist TargetID. Songs are the same when they have the same ID or the same ISRC.
+type PlaylistCombineIn struct {
+	Operation SetOperation `json:"operation" validate:"required,oneof=union intersection difference symmetric_difference"`
+	SourceIDs []int        `json:"source_ids" validate:"required,min=2,max=20,unique"`
+	Order     CombineOrder `json:"order" validate:"omitempty,oneof=source interleave song_name album_name duration added_at"`
+	TargetID  int          `json:"target_id" validate:"min=0"`
+	// Replace makes the songs of the target playlist the combined songs, they're added to it otherwise
+	Replace             bool   `json:"replace"`
+	Name                string `json:"playlist_name" validate:"required_without=TargetID"`
+	PlaylistDescription string `json:"playlist_description"`
+}
@@ -5,28 +5,100 @@ import "golang.org/x/oauth2"
 type ConverterRequestData struct {
 	PlaylistName     string                    `json:"playlist_name" validate:"required"`
 	ProviderMetadata ConverterProviderMetadata `json:"provider_metadata,omitempty"`
+	// Selections maps a song ID to the provider track ID the user picked from a preview
+	Selections map[int]string `json:"selections,omitempty"`
 	ProviderParam
 }
 
-type ConverterProviderMetadata struct {
-	AppleMusic struct {
-		MusicUserToken string `json:"musicUserToken"`
-	} `json:"applemusic"`
-}
+// ConverterProviderMetadata maps a provider name to the metadata fields the user sent for it.
+type ConverterProviderMetadata map[string]map[string]string
 
+// ConverterServiceProviderMetadata holds what a provider needs to act on behalf of the user.
 type ConverterServiceProviderMetadata struct {
-	AppleMusic AppleMusicMetadata
-	Spotify    SpotifyMetadata
+	// UserID is the user whose credentials OAuth providers act with
+	UserID string `json:",omitempty"`
+	// Token is filled in from the credentials of the user when the provider is used, and never stored
+	Token *oauth2.Token `json:",omitempty"`
+	// Values holds the provider metadata fields sent with the request
+	Values map[string]string
 }
 
-type AppleMusicMetadata struct {
-	MusicUserToken string
+type ProviderParam struct {
+	Provider string `param:"provider" validate:"required,provider"`
 }
 
-type SpotifyMetadata struct {
-	Token *oauth2.Token
+type ImporterRequestData struct {
+	PlaylistName     string                    `json:"playlist_name"`
+	ProviderMetadata ConverterProviderMetadata `json:"provider_metadata,omitempty"`
+	RemotePlaylistID string                    `param:"remote_playlist_id" validate:"required"`
+	ProviderParam
 }
 
-type ProviderParam struct {
-	Provider string `param:"provider" validate:"required,oneof=spotify applemusic"`
+type MatchStatus string
+
+const (
+	MatchStatusMatched   MatchStatus = "matched"
+	MatchStatusUnmatched MatchStatus = "unmatched"
+	MatchStatusAmbiguous MatchStatus = "ambiguous"
+)
+
+type MatchStrategy string
+
+const (
+	MatchStrategyISRC       MatchStrategy = "isrc"
+	MatchStrategyTextSearch MatchStrategy = "text_search"
+	MatchStrategyManual     MatchStrategy = "manual"
+)
+
+type SongMatchResult struct {
+	Song              SongOutAPI    `json:"song"`
+	Status            MatchStatus   `json:"status"`
+	Strategy          MatchStrategy `json:"strategy,omitempty"`
+	ProviderTrackID   string        `json:"provider_track_id,omitempty"`
+	CandidateTrackIDs []string      `json:"candidate_track_ids,omitempty"`
+	Error             string        `json:"error,omitempty"`
+}
+
+type ConversionReport struct {
+	Provider         string            `json:"provider"`
+	RemotePlaylistID string            `json:"remote_playlist_id,omitempty"`
+	Matched          []SongMatchResult `json:"matched"`
+	Unmatched        []SongMatchResult `json:"unmatched"`
+	Ambiguous        []SongMatchResult `json:"ambiguous"`
+}
+
+// Add puts a song match result in the bucket for its status.
+// Ambiguous songs are still exported with their best candidate so users only need to review them.
+func (c *ConversionReport) Add(result SongMatchResult) {
+	switch result.Status {
+	case MatchStatusMatched:
+		c.Matched = append(c.Matched, result)
+	case MatchStatusAmbiguous:
+		c.Ambiguous = append(c.Ambiguous, result)
+	default:
+		c.Unmatched = append(c.Unmatched, result)
+	}
+}
+
+type TrackCandidate struct {
+	ProviderTrackID string        `json:"provider_track_id"`
+	Name            string        `json:"song_name"`
+	ArtistNames     []string      `json:"artist_names"`
+	AlbumName       string        `json:"album_name"`
+	Duration        int           `json:"duration"`
+	ImageURL        string        `json:"image_url"`
+	ISRC            string        `json:"isrc"`
+	Strategy        MatchStrategy `json:"strategy"`
+	Confidence      float64       `json:"confidence"`
+}
+
+type SongPreview struct {
+	Song       SongOutAPI       `json:"song"`
+	Candidates []TrackCandidate `json:"candidates"`
+	Error      string           `json:"error,omitempty"`
+}
+
+type ConversionPreview struct {
+	Provider string        `json:"provider"`
+	Songs    []SongPreview `json:"songs"`
 }
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+
+	"golang.org/x/oauth2"
+)
+
+var ErrProviderNotConnected = errors.New("not connected to provider")
+
+// ProviderCredential is the OAuth token a user logged in to a provider with.
+type ProviderCredential struct {
+	UserID         string
+	Provider       string
+	ProviderUserID string
+	Token          *oauth2.Token
+}
+
+// ProviderCredentialInDB holds the tokens encrypted.
+type ProviderCredentialInDB struct {
+	UserID         string         `db:"user_id"`
+	Provider       string         `db:"provider"`
+	ProviderUserID sql.NullString `db:"provider_user_id"`
+	AccessToken    []byte         `db:"access_token"`
+	RefreshToken   []byte         `db:"refresh_token"`
+	ExpiresAt      sql.NullTime   `db:"expires_at"`
+}
+
+type ProviderCredentialOutDB struct {
+	ProviderCredentialInDB
+	Timestamp
+}
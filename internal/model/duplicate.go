@@ -0,0 +1,54 @@
+package model
+
+// DuplicateReason is why songs are versions of the same recording.
+type DuplicateReason string
+
+const (
+	// DuplicateReasonISRC is for songs with the same ISRC
+	DuplicateReasonISRC DuplicateReason = "isrc"
+	// DuplicateReasonTitleArtists is for songs with the same title and artists once normalized,
+	// and durations within the tolerance of each other
+	DuplicateReasonTitleArtists DuplicateReason = "title_artists"
+)
+
+// DuplicatePreference is which version of a song a dedupe keeps.
+type DuplicatePreference string
+
+const (
+	// DuplicatePreferAlbum keeps a version from an album over a version from a single, then the first version
+	DuplicatePreferAlbum  DuplicatePreference = "album"
+	DuplicatePreferSingle DuplicatePreference = "single"
+	DuplicatePreferFirst  DuplicatePreference = "first"
+	// DuplicatePreferLongest keeps the longest version, which is usually not a radio edit
+	DuplicatePreferLongest DuplicatePreference = "longest"
+)
+
+// DefaultDuplicateTolerance is how many milliseconds apart the durations of versions of a song can be by default.
+const DefaultDuplicateTolerance = 2000
+
+// DuplicateQuery tunes how duplicates are found. Tolerance is in milliseconds.
+type DuplicateQuery struct {
+	Tolerance int                 `query:"tolerance" validate:"min=0,max=60000"`
+	Prefer    DuplicatePreference `query:"prefer" validate:"omitempty,oneof=album single first longest"`
+}
+
+// DuplicateGroup is versions of the same recording, in the order they were found.
+type DuplicateGroup struct {
+	Reasons []DuplicateReason `json:"reasons"`
+	// PreferredSongID is the version a dedupe keeps
+	PreferredSongID int             `json:"preferred_song_id"`
+	Songs           []DuplicateSong `json:"songs"`
+}
+
+// DuplicateSong is a version of a song with the playlists of the user it's in, which are only listed
+// when looking across playlists.
+type DuplicateSong struct {
+	SongOutAPI
+	PlaylistIDs []int `json:"playlist_ids,omitempty"`
+}
+
+// DedupeResult is what a dedupe removed from a playlist.
+type DedupeResult struct {
+	Groups         []DuplicateGroup `json:"groups"`
+	RemovedSongIDs []int            `json:"removed_song_ids"`
+}
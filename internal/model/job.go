@@ -0,0 +1,70 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var ErrJobNotFound = errors.New("conversion job not found")
+
+type JobStatus string
+
+const (
+	JobStatusQueued             JobStatus = "queued"
+	JobStatusRunning            JobStatus = "running"
+	JobStatusSucceeded          JobStatus = "succeeded"
+	JobStatusFailed             JobStatus = "failed"
+	JobStatusPartiallySucceeded JobStatus = "partially_succeeded"
+)
+
+const JobSongStatusPending MatchStatus = "pending"
+
+type ConversionJob struct {
+	ID               int                 `json:"job_id"`
+	PlaylistID       int                 `json:"playlist_id"`
+	Provider         string              `json:"provider"`
+	PlaylistName     string              `json:"playlist_name"`
+	Status           JobStatus           `json:"status"`
+	RemotePlaylistID string              `json:"remote_playlist_id,omitempty"`
+	Error            string              `json:"error,omitempty"`
+	TotalSongs       int                 `json:"total_songs"`
+	ProcessedSongs   int                 `json:"processed_songs"`
+	Songs            []ConversionJobSong `json:"songs"`
+	Report           ConversionReport    `json:"report"`
+	Timestamp
+}
+
+type ConversionJobSong struct {
+	Position int             `json:"position"`
+	Status   MatchStatus     `json:"status"`
+	Result   SongMatchResult `json:"result"`
+}
+
+type ConversionJobInDB struct {
+	PlaylistID   int    `db:"playlist_id"`
+	Provider     string `db:"provider"`
+	PlaylistName string `db:"playlist_name"`
+	// ProviderMetadata is sealed by the repository before it's stored
+	ProviderMetadata ConverterServiceProviderMetadata `db:"-"`
+}
+
+type ConversionJobOutDB struct {
+	ID               int            `db:"job_id"`
+	PlaylistID       int            `db:"playlist_id"`
+	Provider         string         `db:"provider"`
+	PlaylistName     string         `db:"playlist_name"`
+	Status           string         `db:"status"`
+	ProviderMetadata []byte         `db:"provider_metadata"`
+	RemotePlaylistID sql.NullString `db:"remote_playlist_id"`
+	Error            sql.NullString `db:"error"`
+	Timestamp
+}
+
+type ConversionJobSongOutDB struct {
+	JobID    int    `db:"job_id"`
+	Position int    `db:"position"`
+	Song     []byte `db:"song"`
+	Status   string `db:"status"`
+	Result   []byte `db:"result"`
+	Timestamp
+}
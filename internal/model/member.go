@@ -0,0 +1,64 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInviteNotFound    = errors.New("invite not found or expired")
+	ErrMemberNotFound    = errors.New("user is not a member of the playlist")
+	ErrOwnerRoleReserved = errors.New("the owner of a playlist can't be changed or removed")
+)
+
+type PlaylistRole string
+
+const (
+	PlaylistRoleOwner  PlaylistRole = "owner"
+	PlaylistRoleEditor PlaylistRole = "editor"
+	PlaylistRoleViewer PlaylistRole = "viewer"
+)
+
+var playlistRoleRanks = map[PlaylistRole]int{
+	PlaylistRoleViewer: 1,
+	PlaylistRoleEditor: 2,
+	PlaylistRoleOwner:  3,
+}
+
+// Includes reports whether the role grants everything the other role can do.
+func (r PlaylistRole) Includes(other PlaylistRole) bool {
+	return playlistRoleRanks[r] >= playlistRoleRanks[other] && playlistRoleRanks[r] > 0
+}
+
+type PlaylistMember struct {
+	UserID      string       `json:"user_id"`
+	DisplayName string       `json:"display_name"`
+	Role        PlaylistRole `json:"role"`
+	Timestamp
+}
+
+type PlaylistMemberOutDB struct {
+	UserID      string `db:"user_id"`
+	DisplayName string `db:"display_name"`
+	Role        string `db:"role"`
+	Timestamp
+}
+
+type PlaylistMemberUpdate struct {
+	Role PlaylistRole `json:"role" validate:"required,oneof=editor viewer"`
+}
+
+// PlaylistInvite lets anyone with its token join the playlist with its role until it expires.
+type PlaylistInvite struct {
+	Token      string       `json:"token" db:"token"`
+	PlaylistID int          `json:"playlist_id" db:"playlist_id"`
+	Role       PlaylistRole `json:"role" db:"role"`
+	CreatedBy  string       `json:"created_by" db:"created_by"`
+	ExpiresAt  time.Time    `json:"expires_at" db:"expires_at"`
+}
+
+type PlaylistInviteIn struct {
+	Role PlaylistRole `json:"role" validate:"required,oneof=editor viewer"`
+	// ExpiresInHours defaults to 72 hours
+	ExpiresInHours int `json:"expires_in_hours" validate:"omitempty,min=1,max=720"`
+}
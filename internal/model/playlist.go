@@ -1,6 +1,15 @@
 package model
 
-import "database/sql"
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrPlaylistNotFound  = errors.New("playlist not found")
+	ErrPlaylistForbidden = errors.New("playlist belongs to another user")
+)
 
 type Playlist struct {
 	ID                  int    `json:"playlist_id"`
@@ -9,6 +18,14 @@ type Playlist struct {
 	UserID              string `json:"user_id"`
 	Username            string `json:"user_name"`
 	ImageURL            string `json:"image_url"`
+	// RemoteLinks holds the sync state of every provider the playlist was exported to
+	RemoteLinks []PlaylistRemoteLink `json:"remote_links"`
+	// ForkedFrom is the playlist this one was duplicated from
+	ForkedFrom int `json:"forked_from,omitempty"`
+	// DeletedAt is set when the playlist is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// SmartRules is set when the songs of the playlist come from rules
+	SmartRules *SmartPlaylistRules `json:"smart_rules,omitempty"`
 	Timestamp
 }
 
@@ -19,6 +36,9 @@ type PlaylistOutDB struct {
 	UserID              string         `db:"user_id"`
 	Username            string         `db:"user_name"`
 	ImageName           string         `db:"image_name"`
+	ForkedFrom          sql.NullInt64  `db:"forked_from"`
+	DeletedAt           sql.NullTime   `db:"deleted_at"`
+	SmartRules          []byte         `db:"smart_rules"`
 	Timestamp
 }
 
@@ -26,13 +46,46 @@ type PlaylistInDB struct {
 	Name                string `db:"playlist_name"`
 	PlaylistDescription string `db:"playlist_description"`
 	UserID              string `db:"user_id"`
-	Username            string `db:"user_name"`
 	ImageName           string `db:"image_name"`
+	// SmartRules is encoded by the repository
+	SmartRules *SmartPlaylistRules `db:"-"`
 }
 
+// PlaylistIn is a new playlist. UserID comes from the token of the user creating it.
+// The playlist is a smart playlist when it has SmartRules.
 type PlaylistIn struct {
-	Name                string `json:"playlist_name" validate:"required"`
-	PlaylistDescription string `json:"playlist_description"`
-	UserID              string `json:"user_id" validate:"required"`
-	Username            string `json:"user_name" validate:"required"`
+	Name                string              `json:"playlist_name" validate:"required"`
+	PlaylistDescription string              `json:"playlist_description"`
+	UserID              string              `json:"user_id" validate:"required"`
+	SmartRules          *SmartPlaylistRules `json:"smart_rules,omitempty"`
+}
+
+// PlaylistDuplicateIn names the copy of a playlist, which keeps the name of the playlist when it's empty.
+type PlaylistDuplicateIn struct {
+	Name string `json:"playlist_name"`
+}
+
+type PlaylistUpdate struct {
+	Name                *string `validate:"omitempty,min=1"`
+	PlaylistDescription *string
+}
+
+type PlaylistUpdateInDB struct {
+	Name                *string `db:"playlist_name"`
+	PlaylistDescription *string `db:"playlist_description"`
+	ImageName           *string `db:"image_name"`
+}
+
+type ImportedPlaylist struct {
+	Name        string
+	Description string
+	ImageURL    string
+	Songs       []SongInAPI
+}
+
+type RemotePlaylist struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ImageURL    string `json:"image_url"`
 }
@@ -1,7 +1,14 @@
 package model
 
+import "errors"
+
+// ErrInvalidSongOrder is returned when songs are moved out of the playlist bounds
+// or a new order isn't made of the songs of the playlist.
+var ErrInvalidSongOrder = errors.New("invalid playlist song order")
+
 type PlaylistSong struct {
 	PlaylistID int `json:"playlist_id" db:"playlist_id"`
 	SongID     int `json:"song_id" db:"song_id"`
+	Position   int `json:"position" db:"position"`
 	Timestamp
 }
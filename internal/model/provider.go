@@ -0,0 +1,35 @@
+package model
+
+type ProviderAuth string
+
+const (
+	// ProviderAuthOAuth providers log users in through the OAuth endpoints
+	ProviderAuthOAuth ProviderAuth = "oauth"
+	// ProviderAuthRequest providers get the user credentials in the provider metadata of every request
+	ProviderAuthRequest ProviderAuth = "request"
+)
+
+// ProviderMetadataField is a value users send in the provider metadata of a request,
+// e.g. {"provider_metadata": {"applemusic": {"musicUserToken": "..."}}}.
+type ProviderMetadataField struct {
+	Name string `json:"name"`
+	// Header can carry the value on requests without a body
+	Header      string `json:"header,omitempty"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+type ProviderCapabilities struct {
+	Export       bool `json:"export"`
+	Import       bool `json:"import"`
+	RemoveTracks bool `json:"remove_tracks"`
+	TwoWaySync   bool `json:"two_way_sync"`
+}
+
+type ProviderInfo struct {
+	Name         string                  `json:"name"`
+	DisplayName  string                  `json:"display_name"`
+	Auth         ProviderAuth            `json:"auth"`
+	Metadata     []ProviderMetadataField `json:"metadata"`
+	Capabilities ProviderCapabilities    `json:"capabilities"`
+}
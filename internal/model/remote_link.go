@@ -0,0 +1,115 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrRemoteLinkNotFound    = errors.New("playlist was never exported to this provider")
+	ErrSyncInProgress        = errors.New("playlist is already being synced with this provider")
+	ErrTwoWaySyncUnsupported = errors.New("two-way sync is not available for this provider")
+)
+
+// PlaylistRemoteLink is the playlist a local playlist was exported to on a provider.
+// Later exports to the same provider update that playlist instead of creating a new one.
+type PlaylistRemoteLink struct {
+	PlaylistID         int        `json:"-"`
+	Provider           string     `json:"provider"`
+	RemotePlaylistID   string     `json:"remote_playlist_id"`
+	RemotePlaylistName string     `json:"remote_playlist_name"`
+	TrackIDs           []string   `json:"-"`
+	SyncedJobID        int        `json:"-"`
+	SyncedAt           *time.Time `json:"synced_at"`
+	LastJobID          int        `json:"last_job_id,omitempty"`
+	LastSyncStatus     JobStatus  `json:"last_sync_status,omitempty"`
+	LastSyncError      string     `json:"last_sync_error,omitempty"`
+	// SongTrackIDs maps the ID of every exported song to its provider track ID, empty when the song didn't match
+	SongTrackIDs   map[int]string `json:"-"`
+	SnapshotID     string         `json:"-"`
+	AutoSync       bool           `json:"auto_sync"`
+	Conflicts      []SyncConflict `json:"conflicts,omitempty"`
+	TwoWaySyncedAt *time.Time     `json:"two_way_synced_at,omitempty"`
+}
+
+type PlaylistRemoteLinkInDB struct {
+	PlaylistID         int        `db:"playlist_id"`
+	Provider           string     `db:"provider"`
+	RemotePlaylistID   string     `db:"remote_playlist_id"`
+	RemotePlaylistName string     `db:"remote_playlist_name"`
+	TrackIDs           string     `db:"track_ids"`
+	SyncedJobID        *int       `db:"synced_job_id"`
+	SyncedAt           *time.Time `db:"synced_at"`
+	SongTrackIDs       string     `db:"song_track_ids"`
+}
+
+type PlaylistRemoteLinkOutDB struct {
+	PlaylistID         int            `db:"playlist_id"`
+	Provider           string         `db:"provider"`
+	RemotePlaylistID   string         `db:"remote_playlist_id"`
+	RemotePlaylistName string         `db:"remote_playlist_name"`
+	TrackIDs           []byte         `db:"track_ids"`
+	SyncedJobID        sql.NullInt64  `db:"synced_job_id"`
+	SyncedAt           sql.NullTime   `db:"synced_at"`
+	LastJobID          sql.NullInt64  `db:"last_job_id"`
+	LastSyncStatus     sql.NullString `db:"last_sync_status"`
+	LastSyncError      sql.NullString `db:"last_sync_error"`
+	SongTrackIDs       []byte         `db:"song_track_ids"`
+	SnapshotID         sql.NullString `db:"snapshot_id"`
+	AutoSync           bool           `db:"auto_sync"`
+	ProviderMetadata   []byte         `db:"provider_metadata"`
+	Conflicts          []byte         `db:"conflicts"`
+	TwoWaySyncedAt     sql.NullTime   `db:"two_way_synced_at"`
+	SyncLockedUntil    sql.NullTime   `db:"sync_locked_until"`
+	Timestamp
+}
+
+type SyncRequestData struct {
+	ProviderMetadata ConverterProviderMetadata `json:"provider_metadata,omitempty"`
+	ProviderParam
+}
+
+type TwoWaySyncRequestData struct {
+	ProviderMetadata ConverterProviderMetadata `json:"provider_metadata,omitempty"`
+	// AutoSync turns the scheduled sync of the playlist on or off
+	AutoSync bool `json:"auto_sync"`
+	// Resolve picks the side whose order is kept when both sides reordered the playlist
+	Resolve SyncSide `json:"resolve" validate:"omitempty,oneof=local remote"`
+	ProviderParam
+}
+
+type SyncSide string
+
+const (
+	SyncSideLocal  SyncSide = "local"
+	SyncSideRemote SyncSide = "remote"
+)
+
+type SyncConflictType string
+
+const SyncConflictOrder SyncConflictType = "order"
+
+type SyncConflict struct {
+	Type    SyncConflictType `json:"type"`
+	Message string           `json:"message"`
+}
+
+// RemoteTrack is a track of a remote playlist.
+type RemoteTrack struct {
+	ProviderTrackID string
+	Song            SongInAPI
+}
+
+type TwoWaySyncResult struct {
+	Provider          string         `json:"provider"`
+	RemotePlaylistID  string         `json:"remote_playlist_id"`
+	AddedToLocal      int            `json:"added_to_local"`
+	RemovedFromLocal  int            `json:"removed_from_local"`
+	AddedToRemote     int            `json:"added_to_remote"`
+	RemovedFromRemote int            `json:"removed_from_remote"`
+	LocalReordered    bool           `json:"local_reordered"`
+	RemoteReordered   bool           `json:"remote_reordered"`
+	Unmatched         []SongOutAPI   `json:"unmatched"`
+	Conflicts         []SyncConflict `json:"conflicts"`
+}
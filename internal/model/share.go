@@ -0,0 +1,28 @@
+package model
+
+import "errors"
+
+var ErrShareNotFound = errors.New("share link not found or revoked")
+
+// PlaylistShare gives anyone with its token read-only access to the playlist until it's revoked.
+type PlaylistShare struct {
+	Token      string `json:"token" db:"token"`
+	PlaylistID int    `json:"playlist_id" db:"playlist_id"`
+	CreatedBy  string `json:"created_by" db:"created_by"`
+	// URL is the page of the shared playlist, it's built from the request host
+	URL string `json:"url" db:"-"`
+	Timestamp
+}
+
+// OEmbed is the oEmbed response of a share link, see https://oembed.com.
+type OEmbed struct {
+	Type            string `json:"type"`
+	Version         string `json:"version"`
+	Title           string `json:"title"`
+	AuthorName      string `json:"author_name,omitempty"`
+	ProviderName    string `json:"provider_name"`
+	ProviderURL     string `json:"provider_url"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+}
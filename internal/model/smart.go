@@ -0,0 +1,54 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrPlaylistNotSmart      = errors.New("playlist is not a smart playlist")
+	ErrSmartPlaylistReadOnly = errors.New("songs of a smart playlist come from its rules")
+	ErrInvalidSmartRules     = errors.New("invalid smart playlist rules")
+)
+
+// SmartRuleField is what a smart playlist rule matches songs on.
+type SmartRuleField string
+
+const (
+	SmartRuleArtist      SmartRuleField = "artist"
+	SmartRuleAlbum       SmartRuleField = "album"
+	SmartRuleDuration    SmartRuleField = "duration"
+	SmartRuleAddedAfter  SmartRuleField = "added_after"
+	SmartRuleInPlaylist  SmartRuleField = "in_playlist"
+	SmartRuleISRCPrefix  SmartRuleField = "isrc_prefix"
+	SmartRuleISRCCountry SmartRuleField = "isrc_country"
+)
+
+// SmartPlaylistRules picks the songs of a smart playlist from the catalog.
+type SmartPlaylistRules struct {
+	// Match is all when a song must match every rule and any when one rule is enough, all by default
+	Match string              `json:"match,omitempty" validate:"omitempty,oneof=all any"`
+	Rules []SmartPlaylistRule `json:"rules" validate:"required,min=1,max=20,dive"`
+	// OrderBy is the order of the playlist, the latest songs added to the catalog first by default
+	OrderBy string `json:"order_by,omitempty" validate:"omitempty,oneof=added_at song_name album_name duration"`
+	Order   string `json:"order,omitempty" validate:"omitempty,oneof=asc desc"`
+	// Limit keeps the first songs in the order, every matching song is kept when it's zero
+	Limit int `json:"limit,omitempty" validate:"min=0,max=1000"`
+}
+
+// SmartPlaylistRule matches songs on one field. Which of its values are used depends on the field.
+type SmartPlaylistRule struct {
+	Field SmartRuleField `json:"field" validate:"required,oneof=artist album duration added_after in_playlist isrc_prefix isrc_country"`
+	// Not matches the songs the rule doesn't match
+	Not bool `json:"not,omitempty"`
+	// Values are the artists, albums, ISRC prefixes or ISRC countries a song matches one of
+	Values []string `json:"values,omitempty"`
+	// MinDuration and MaxDuration bound the duration in milliseconds, either can be left out
+	MinDuration *int `json:"min_duration,omitempty"`
+	MaxDuration *int `json:"max_duration,omitempty"`
+	// After matches the songs added to the catalog after it
+	After *time.Time `json:"after,omitempty"`
+	// PlaylistIDs matches the songs in one of the playlists. Only playlists the owner of
+	// the smart playlist is a member of are looked at, and smart playlists have no songs there.
+	PlaylistIDs []int `json:"playlist_ids,omitempty"`
+}
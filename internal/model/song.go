@@ -27,6 +27,8 @@ type SongOutAPI struct {
 	ImageURL    string   `json:"image_url"`
 	Duration    int      `json:"duration"`
 	ISRC        string   `json:"isrc"`
+	Position    int      `json:"position"`
+	AddedBy     string   `json:"added_by,omitempty"`
 	Timestamp
 }
 
@@ -38,5 +40,7 @@ type SongOutDB struct {
 	ImageURL   string         `db:"image_url"`
 	Duration   int            `db:"duration"`
 	ISRC       sql.NullString `db:"isrc"`
+	Position   int            `db:"position"`
+	AddedBy    sql.NullString `db:"added_by"`
 	Timestamp
 }
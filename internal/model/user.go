@@ -0,0 +1,34 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type User struct {
+	ID                 string   `json:"user_id"`
+	DisplayName        string   `json:"display_name"`
+	AvatarURL          string   `json:"avatar_url"`
+	ConnectedProviders []string `json:"connected_providers"`
+	Timestamp
+}
+
+type UserInDB struct {
+	ID          string         `db:"user_id"`
+	DisplayName string         `db:"display_name"`
+	AvatarURL   sql.NullString `db:"avatar_url"`
+}
+
+type UserOutDB struct {
+	UserInDB
+	Timestamp
+}
+
+// UserUpdate holds the profile fields to change, nil fields are left untouched.
+type UserUpdate struct {
+	DisplayName *string `json:"display_name" validate:"omitempty,min=1"`
+	// an empty avatar URL removes the avatar
+	AvatarURL *string `json:"avatar_url" validate:"omitempty,url"`
+}
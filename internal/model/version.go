@@ -0,0 +1,77 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrVersionNotFound = errors.New("playlist version not found")
+
+// PlaylistChange is what changed the playlist in a version.
+type PlaylistChange string
+
+const (
+	PlaylistChangeCreated        PlaylistChange = "created"
+	PlaylistChangeDuplicated     PlaylistChange = "duplicated"
+	PlaylistChangeUpdated        PlaylistChange = "updated"
+	PlaylistChangeSongsAdded     PlaylistChange = "songs_added"
+	PlaylistChangeSongsRemoved   PlaylistChange = "songs_removed"
+	PlaylistChangeSongsMoved     PlaylistChange = "songs_moved"
+	PlaylistChangeSongsReordered PlaylistChange = "songs_reordered"
+	PlaylistChangeSynced         PlaylistChange = "synced"
+	PlaylistChangeRestored       PlaylistChange = "restored"
+	PlaylistChangeFrozen         PlaylistChange = "frozen"
+	PlaylistChangeCombined       PlaylistChange = "combined"
+	PlaylistChangeDeduplicated   PlaylistChange = "deduplicated"
+)
+
+// PlaylistVersion is a snapshot of the metadata and the songs of a playlist after a change.
+type PlaylistVersion struct {
+	PlaylistID          int            `json:"playlist_id"`
+	Version             int            `json:"version"`
+	Change              PlaylistChange `json:"change"`
+	RestoredFrom        int            `json:"restored_from,omitempty"`
+	Name                string         `json:"playlist_name"`
+	PlaylistDescription string         `json:"playlist_description"`
+	SongCount           int            `json:"song_count"`
+	// Songs is left out of the history list
+	Songs     []PlaylistVersionSong `json:"songs,omitempty"`
+	CreatedAt time.Time             `json:"created_at"`
+}
+
+// PlaylistVersionSong is a song of a playlist version, in the playlist order.
+type PlaylistVersionSong struct {
+	SongID  int       `json:"song_id"`
+	AddedBy string    `json:"added_by,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+type PlaylistVersionOutDB struct {
+	PlaylistID          int            `db:"playlist_id"`
+	Version             int            `db:"version"`
+	Change              string         `db:"change"`
+	RestoredFrom        sql.NullInt64  `db:"restored_from"`
+	Name                string         `db:"playlist_name"`
+	PlaylistDescription sql.NullString `db:"playlist_description"`
+	SongCount           int            `db:"song_count"`
+	Songs               []byte         `db:"songs"`
+	Timestamp
+}
+
+// PlaylistVersionDiff is what changed between two versions of a playlist.
+type PlaylistVersionDiff struct {
+	From                int          `json:"from"`
+	To                  int          `json:"to"`
+	Name                *ValueChange `json:"playlist_name,omitempty"`
+	PlaylistDescription *ValueChange `json:"playlist_description,omitempty"`
+	AddedSongs          []SongOutAPI `json:"added_songs"`
+	RemovedSongs        []SongOutAPI `json:"removed_songs"`
+	// Reordered is true when the songs in both versions aren't in the same order
+	Reordered bool `json:"reordered"`
+}
+
+type ValueChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
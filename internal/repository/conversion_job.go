@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tuannamnguyen/playlist-manager/internal/encryption"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+// ConversionJobRepository stores conversion jobs, with the provider metadata of the jobs encrypted with cipher.
+type ConversionJobRepository struct {
+	db     *sqlx.DB
+	cipher *encryption.Cipher
+}
+
+func NewConversionJobRepository(db *sqlx.DB, cipher *encryption.Cipher) *ConversionJobRepository {
+	return &ConversionJobRepository{db: db, cipher: cipher}
+}
+
+// Insert creates a queued job for the songs. results holds songs, keyed by position, whose match is already known.
+func (cj *ConversionJobRepository) Insert(
+	ctx context.Context,
+	job model.ConversionJobInDB,
+	songs []model.SongOutAPI,
+	results map[int]model.SongMatchResult,
+) (int, error) {
+	encodedMetadata, err := sealProviderMetadata(cj.cipher, job.ProviderMetadata)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := cj.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction insert conversion job: %v\n", err)
+		}
+	}()
+
+	row := tx.QueryRowxContext(
+		ctx,
+		`INSERT INTO conversion_job (playlist_id, provider, playlist_name, status, provider_metadata)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING job_id`,
+		job.PlaylistID,
+		job.Provider,
+		job.PlaylistName,
+		model.JobStatusQueued,
+		encodedMetadata,
+	)
+
+	var jobID int
+	err = row.Scan(&jobID)
+	if err != nil {
+		return 0, &rowScanError{err}
+	}
+
+	if len(songs) > 0 {
+		query := `INSERT INTO conversion_job_song (job_id, position, song, status, result)
+			VALUES %s`
+
+		valueStrings := make([]string, 0, len(songs))
+		valueArgs := make([]any, 0, len(songs)*5)
+		for position, song := range songs {
+			encodedSong, err := json.Marshal(song)
+			if err != nil {
+				return 0, fmt.Errorf("marshalling conversion job song: %w", err)
+			}
+
+			status := model.JobSongStatusPending
+			var encodedResult *string
+			if result, ok := results[position]; ok {
+				encoded, err := json.Marshal(result)
+				if err != nil {
+					return 0, fmt.Errorf("marshalling song match result: %w", err)
+				}
+
+				status = result.Status
+				resultJSON := string(encoded)
+				encodedResult = &resultJSON
+			}
+
+			valueStrings = append(valueStrings, "(?, ?, ?, ?, ?)")
+			valueArgs = append(valueArgs, jobID, position, string(encodedSong), status, encodedResult)
+		}
+
+		query = sqlx.Rebind(
+			sqlx.DOLLAR,
+			fmt.Sprintf(query, strings.Join(valueStrings, ",")),
+		)
+
+		_, err = tx.ExecContext(ctx, query, valueArgs...)
+		if err != nil {
+			return 0, &execError{err}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, &transactionCommitError{err}
+	}
+
+	return jobID, nil
+}
+
+// SelectWithID returns the job with its songs, or model.ErrJobNotFound when it doesn't exist.
+func (cj *ConversionJobRepository) SelectWithID(ctx context.Context, id int) (model.ConversionJob, error) {
+	var jobOutDB model.ConversionJobOutDB
+	err := cj.db.QueryRowxContext(ctx, "SELECT * FROM conversion_job WHERE job_id = $1", id).StructScan(&jobOutDB)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.ConversionJob{}, model.ErrJobNotFound
+	}
+	if err != nil {
+		return model.ConversionJob{}, &structScanError{err}
+	}
+
+	var songsOutDB []model.ConversionJobSongOutDB
+	err = cj.db.SelectContext(ctx, &songsOutDB, "SELECT * FROM conversion_job_song WHERE job_id = $1 ORDER BY position", id)
+	if err != nil {
+		return model.ConversionJob{}, &selectError{err}
+	}
+
+	return mapConversionJobDBToAPI(jobOutDB, songsOutDB)
+}
+
+func (cj *ConversionJobRepository) SelectProviderMetadata(ctx context.Context, id int) (model.ConverterServiceProviderMetadata, error) {
+	var encodedMetadata []byte
+	err := cj.db.QueryRowxContext(ctx, "SELECT provider_metadata FROM conversion_job WHERE job_id = $1", id).Scan(&encodedMetadata)
+	if err != nil {
+		return model.ConverterServiceProviderMetadata{}, &rowScanError{err}
+	}
+
+	return openProviderMetadata(cj.cipher, encodedMetadata)
+}
+
+// ClaimNext marks the oldest queued job as running and returns its ID.
+// The returned bool is false when there is no queued job.
+func (cj *ConversionJobRepository) ClaimNext(ctx context.Context) (int, bool, error) {
+	row := cj.db.QueryRowxContext(
+		ctx,
+		`UPDATE conversion_job
+		SET status = $1
+		WHERE job_id = (
+			SELECT job_id FROM conversion_job
+			WHERE status = $2
+			ORDER BY created_at, job_id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING job_id`,
+		model.JobStatusRunning,
+		model.JobStatusQueued,
+	)
+
+	var jobID int
+	err := row.Scan(&jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, &rowScanError{err}
+	}
+
+	return jobID, true, nil
+}
+
+// RequeueStale puts running jobs that have not made progress for staleAfter back in the queue,
+// which happens when the server processing them stopped before it could requeue them.
+func (cj *ConversionJobRepository) RequeueStale(ctx context.Context, staleAfter time.Duration) error {
+	_, err := cj.db.ExecContext(
+		ctx,
+		`UPDATE conversion_job SET status = $1 WHERE status = $2 AND updated_at < $3`,
+		model.JobStatusQueued,
+		model.JobStatusRunning,
+		time.Now().Add(-staleAfter),
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+func (cj *ConversionJobRepository) UpdateStatus(ctx context.Context, id int, status model.JobStatus, errMessage string) error {
+	_, err := cj.db.ExecContext(
+		ctx,
+		`UPDATE conversion_job SET status = $1, error = NULLIF($2, '') WHERE job_id = $3`,
+		status,
+		errMessage,
+		id,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+func (cj *ConversionJobRepository) UpdateRemotePlaylistID(ctx context.Context, id int, remotePlaylistID string) error {
+	_, err := cj.db.ExecContext(
+		ctx,
+		`UPDATE conversion_job SET remote_playlist_id = $1 WHERE job_id = $2`,
+		remotePlaylistID,
+		id,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+// UpdateSongResult stores the match result of a song and refreshes the job's updated_at as a heartbeat.
+func (cj *ConversionJobRepository) UpdateSongResult(ctx context.Context, id int, position int, result model.SongMatchResult) error {
+	encodedResult, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("marshalling song match result: %w", err)
+	}
+
+	_, err = cj.db.ExecContext(
+		ctx,
+		`WITH job_song AS (
+			UPDATE conversion_job_song SET status = $1, result = $2
+			WHERE job_id = $3 AND position = $4
+		)
+		UPDATE conversion_job SET updated_at = CURRENT_TIMESTAMP WHERE job_id = $3`,
+		result.Status,
+		string(encodedResult),
+		id,
+		position,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
@@ -105,3 +105,19 @@ type gcsGetSignedURLError struct {
 func (g *gcsGetSignedURLError) Error() string {
 	return fmt.Sprintf("gcs get signed URL: %s", g.err.Error())
 }
+
+type gcsDeleteObjectError struct {
+	err error
+}
+
+func (g *gcsDeleteObjectError) Error() string {
+	return fmt.Sprintf("gcs delete object: %s", g.err.Error())
+}
+
+type gcsCopyObjectError struct {
+	err error
+}
+
+func (g *gcsCopyObjectError) Error() string {
+	return fmt.Sprintf("gcs copy object: %s", g.err.Error())
+}
@@ -1,11 +1,25 @@
 package repository
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"os"
+	"path"
+	"slices"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
+	"github.com/tuannamnguyen/playlist-manager/internal/encryption"
 	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"golang.org/x/oauth2"
 )
 
 func parsePlaylistSongData(rows []model.SongOutDB) []model.SongOutAPI {
@@ -32,6 +46,8 @@ func parsePlaylistSongData(rows []model.SongOutDB) []model.SongOutAPI {
 				ImageURL:    row.ImageURL,
 				Duration:    row.Duration,
 				ISRC:        ISRC,
+				Position:    row.Position,
+				AddedBy:     row.AddedBy.String,
 				Timestamp:   row.Timestamp,
 			})
 		}
@@ -72,9 +88,17 @@ func (p *PlaylistRepository) mapSinglePlaylistDBToApiResponse(playlistOutDB mode
 		PlaylistDescription: playlistDescription,
 		UserID:              playlistOutDB.UserID,
 		Username:            playlistOutDB.Username,
+		ForkedFrom:          int(playlistOutDB.ForkedFrom.Int64),
 		Timestamp:           playlistOutDB.Timestamp,
 		ImageURL:            imageURL,
 	}
+	if playlistOutDB.DeletedAt.Valid {
+		playlistAPIResponse.DeletedAt = &playlistOutDB.DeletedAt.Time
+	}
+	playlistAPIResponse.SmartRules, err = decodeSmartRules(playlistOutDB.SmartRules)
+	if err != nil {
+		return model.Playlist{}, err
+	}
 	return playlistAPIResponse, nil
 }
 
@@ -112,3 +136,515 @@ func transformSearchAPIResponse(searchRes SearchResponse) []model.SongInAPI {
 
 	return result
 }
+
+func insertSongIDsAt(order []int, songsID []int, position int) []int {
+	existing := make(map[int]bool, len(order)+len(songsID))
+	for _, songID := range order {
+		existing[songID] = true
+	}
+
+	var newSongsID []int
+	for _, songID := range songsID {
+		if existing[songID] {
+			continue
+		}
+		existing[songID] = true
+		newSongsID = append(newSongsID, songID)
+	}
+
+	if position < 0 || position > len(order) {
+		position = len(order)
+	}
+
+	result := make([]int, 0, len(order)+len(newSongsID))
+	result = append(result, order[:position]...)
+	result = append(result, newSongsID...)
+	result = append(result, order[position:]...)
+
+	return result
+}
+
+func moveSongIDRange(order []int, rangeStart int, rangeLength int, insertBefore int) ([]int, error) {
+	if rangeStart < 0 || rangeLength < 1 || rangeStart+rangeLength > len(order) {
+		return nil, fmt.Errorf("%w: range [%d, %d) out of bounds for playlist of %d songs", model.ErrInvalidSongOrder, rangeStart, rangeStart+rangeLength, len(order))
+	}
+	if insertBefore < 0 || insertBefore > len(order) {
+		return nil, fmt.Errorf("%w: insert position %d out of bounds for playlist of %d songs", model.ErrInvalidSongOrder, insertBefore, len(order))
+	}
+
+	rangeEnd := rangeStart + rangeLength
+	if insertBefore >= rangeStart && insertBefore <= rangeEnd {
+		return slices.Clone(order), nil
+	}
+
+	moved := order[rangeStart:rangeEnd]
+	rest := make([]int, 0, len(order)-rangeLength)
+	rest = append(rest, order[:rangeStart]...)
+	rest = append(rest, order[rangeEnd:]...)
+
+	if insertBefore > rangeEnd {
+		insertBefore -= rangeLength
+	}
+
+	result := make([]int, 0, len(order))
+	result = append(result, rest[:insertBefore]...)
+	result = append(result, moved...)
+	result = append(result, rest[insertBefore:]...)
+
+	return result, nil
+}
+
+func validateSongIDsOrder(order []int, songsID []int) error {
+	if len(order) != len(songsID) {
+		return fmt.Errorf("%w: expected %d songs in new order, got %d", model.ErrInvalidSongOrder, len(order), len(songsID))
+	}
+
+	remaining := make(map[int]bool, len(order))
+	for _, songID := range order {
+		remaining[songID] = true
+	}
+
+	for _, songID := range songsID {
+		if !remaining[songID] {
+			return fmt.Errorf("%w: song %d is not in playlist or is duplicated", model.ErrInvalidSongOrder, songID)
+		}
+		delete(remaining, songID)
+	}
+
+	return nil
+}
+
+func mapConversionJobDBToAPI(jobOutDB model.ConversionJobOutDB, songsOutDB []model.ConversionJobSongOutDB) (model.ConversionJob, error) {
+	job := model.ConversionJob{
+		ID:               jobOutDB.ID,
+		PlaylistID:       jobOutDB.PlaylistID,
+		Provider:         jobOutDB.Provider,
+		PlaylistName:     jobOutDB.PlaylistName,
+		Status:           model.JobStatus(jobOutDB.Status),
+		RemotePlaylistID: jobOutDB.RemotePlaylistID.String,
+		Error:            jobOutDB.Error.String,
+		TotalSongs:       len(songsOutDB),
+		Songs:            make([]model.ConversionJobSong, 0, len(songsOutDB)),
+		Report: model.ConversionReport{
+			Provider:         jobOutDB.Provider,
+			RemotePlaylistID: jobOutDB.RemotePlaylistID.String,
+		},
+		Timestamp: jobOutDB.Timestamp,
+	}
+
+	for _, songOutDB := range songsOutDB {
+		jobSong := model.ConversionJobSong{
+			Position: songOutDB.Position,
+			Status:   model.MatchStatus(songOutDB.Status),
+		}
+
+		if songOutDB.Result != nil {
+			err := json.Unmarshal(songOutDB.Result, &jobSong.Result)
+			if err != nil {
+				return model.ConversionJob{}, fmt.Errorf("unmarshalling song match result: %w", err)
+			}
+
+			job.ProcessedSongs++
+			job.Report.Add(jobSong.Result)
+		} else {
+			err := json.Unmarshal(songOutDB.Song, &jobSong.Result.Song)
+			if err != nil {
+				return model.ConversionJob{}, fmt.Errorf("unmarshalling conversion job song: %w", err)
+			}
+			jobSong.Result.Status = model.JobSongStatusPending
+		}
+
+		job.Songs = append(job.Songs, jobSong)
+	}
+
+	return job, nil
+}
+
+func mapRemoteLinkDBToAPI(linkOutDB model.PlaylistRemoteLinkOutDB) (model.PlaylistRemoteLink, error) {
+	link := model.PlaylistRemoteLink{
+		PlaylistID:         linkOutDB.PlaylistID,
+		Provider:           linkOutDB.Provider,
+		RemotePlaylistID:   linkOutDB.RemotePlaylistID,
+		RemotePlaylistName: linkOutDB.RemotePlaylistName,
+		SyncedJobID:        int(linkOutDB.SyncedJobID.Int64),
+		LastJobID:          int(linkOutDB.LastJobID.Int64),
+		LastSyncStatus:     model.JobStatus(linkOutDB.LastSyncStatus.String),
+		LastSyncError:      linkOutDB.LastSyncError.String,
+		SnapshotID:         linkOutDB.SnapshotID.String,
+		AutoSync:           linkOutDB.AutoSync,
+	}
+
+	if linkOutDB.SyncedAt.Valid {
+		link.SyncedAt = &linkOutDB.SyncedAt.Time
+	}
+	if linkOutDB.TwoWaySyncedAt.Valid {
+		link.TwoWaySyncedAt = &linkOutDB.TwoWaySyncedAt.Time
+	}
+
+	err := json.Unmarshal(linkOutDB.TrackIDs, &link.TrackIDs)
+	if err != nil {
+		return model.PlaylistRemoteLink{}, fmt.Errorf("unmarshalling remote playlist track IDs: %w", err)
+	}
+
+	err = json.Unmarshal(linkOutDB.SongTrackIDs, &link.SongTrackIDs)
+	if err != nil {
+		return model.PlaylistRemoteLink{}, fmt.Errorf("unmarshalling remote playlist song track IDs: %w", err)
+	}
+
+	err = json.Unmarshal(linkOutDB.Conflicts, &link.Conflicts)
+	if err != nil {
+		return model.PlaylistRemoteLink{}, fmt.Errorf("unmarshalling remote playlist sync conflicts: %w", err)
+	}
+
+	return link, nil
+}
+
+func mapRemoteLinkAPIToDB(link model.PlaylistRemoteLink) (model.PlaylistRemoteLinkInDB, error) {
+	trackIDs := link.TrackIDs
+	if trackIDs == nil {
+		trackIDs = []string{}
+	}
+	encodedTrackIDs, err := json.Marshal(trackIDs)
+	if err != nil {
+		return model.PlaylistRemoteLinkInDB{}, fmt.Errorf("marshalling remote playlist track IDs: %w", err)
+	}
+
+	songTrackIDs := link.SongTrackIDs
+	if songTrackIDs == nil {
+		songTrackIDs = map[int]string{}
+	}
+	encodedSongTrackIDs, err := json.Marshal(songTrackIDs)
+	if err != nil {
+		return model.PlaylistRemoteLinkInDB{}, fmt.Errorf("marshalling remote playlist song track IDs: %w", err)
+	}
+
+	linkInDB := model.PlaylistRemoteLinkInDB{
+		PlaylistID:         link.PlaylistID,
+		Provider:           link.Provider,
+		RemotePlaylistID:   link.RemotePlaylistID,
+		RemotePlaylistName: link.RemotePlaylistName,
+		TrackIDs:           string(encodedTrackIDs),
+		SyncedAt:           link.SyncedAt,
+		SongTrackIDs:       string(encodedSongTrackIDs),
+	}
+	if link.SyncedJobID != 0 {
+		linkInDB.SyncedJobID = &link.SyncedJobID
+	}
+
+	return linkInDB, nil
+}
+
+func (r *ProviderCredentialRepository) mapCredentialDBToAPI(credentialInDB model.ProviderCredentialInDB) (model.ProviderCredential, error) {
+	accessToken, err := r.cipher.Decrypt(credentialInDB.AccessToken)
+	if err != nil {
+		return model.ProviderCredential{}, fmt.Errorf("decrypting access token: %w", err)
+	}
+
+	token := &oauth2.Token{
+		AccessToken: string(accessToken),
+		Expiry:      credentialInDB.ExpiresAt.Time,
+	}
+
+	if credentialInDB.RefreshToken != nil {
+		refreshToken, err := r.cipher.Decrypt(credentialInDB.RefreshToken)
+		if err != nil {
+			return model.ProviderCredential{}, fmt.Errorf("decrypting refresh token: %w", err)
+		}
+		token.RefreshToken = string(refreshToken)
+	}
+
+	return model.ProviderCredential{
+		UserID:         credentialInDB.UserID,
+		Provider:       credentialInDB.Provider,
+		ProviderUserID: credentialInDB.ProviderUserID.String,
+		Token:          token,
+	}, nil
+}
+
+func (r *ProviderCredentialRepository) mapCredentialAPIToDB(credential model.ProviderCredential) (model.ProviderCredentialInDB, error) {
+	accessToken, err := r.cipher.Encrypt([]byte(credential.Token.AccessToken))
+	if err != nil {
+		return model.ProviderCredentialInDB{}, fmt.Errorf("encrypting access token: %w", err)
+	}
+
+	credentialInDB := model.ProviderCredentialInDB{
+		UserID:         credential.UserID,
+		Provider:       credential.Provider,
+		ProviderUserID: sql.NullString{String: credential.ProviderUserID, Valid: credential.ProviderUserID != ""},
+		AccessToken:    accessToken,
+		// expires_at has no time zone, so it's stored in UTC like it's read back
+		ExpiresAt: sql.NullTime{Time: credential.Token.Expiry.UTC(), Valid: !credential.Token.Expiry.IsZero()},
+	}
+
+	if credential.Token.RefreshToken != "" {
+		credentialInDB.RefreshToken, err = r.cipher.Encrypt([]byte(credential.Token.RefreshToken))
+		if err != nil {
+			return model.ProviderCredentialInDB{}, fmt.Errorf("encrypting refresh token: %w", err)
+		}
+	}
+
+	return credentialInDB, nil
+}
+
+// storedProviderMetadata is how provider metadata is kept in the database. Only the user is stored in the clear,
+// the fields sent with the request, like the Apple Music user token, are sealed, and tokens of OAuth providers
+// are never stored since they come from the credentials of the user.
+type storedProviderMetadata struct {
+	UserID       string `json:",omitempty"`
+	SealedValues []byte `json:",omitempty"`
+}
+
+func sealProviderMetadata(cipher *encryption.Cipher, providerMetadata model.ConverterServiceProviderMetadata) (string, error) {
+	storedMetadata := storedProviderMetadata{UserID: providerMetadata.UserID}
+	if len(providerMetadata.Values) > 0 {
+		encodedValues, err := json.Marshal(providerMetadata.Values)
+		if err != nil {
+			return "", fmt.Errorf("marshalling provider metadata values: %w", err)
+		}
+
+		storedMetadata.SealedValues, err = cipher.Encrypt(encodedValues)
+		if err != nil {
+			return "", fmt.Errorf("encrypting provider metadata values: %w", err)
+		}
+	}
+
+	encoded, err := json.Marshal(storedMetadata)
+	if err != nil {
+		return "", fmt.Errorf("marshalling provider metadata: %w", err)
+	}
+
+	return string(encoded), nil
+}
+
+func openProviderMetadata(cipher *encryption.Cipher, encoded []byte) (model.ConverterServiceProviderMetadata, error) {
+	var storedMetadata storedProviderMetadata
+	err := json.Unmarshal(encoded, &storedMetadata)
+	if err != nil {
+		return model.ConverterServiceProviderMetadata{}, fmt.Errorf("unmarshalling provider metadata: %w", err)
+	}
+
+	providerMetadata := model.ConverterServiceProviderMetadata{UserID: storedMetadata.UserID}
+	if storedMetadata.SealedValues != nil {
+		encodedValues, err := cipher.Decrypt(storedMetadata.SealedValues)
+		if err != nil {
+			return model.ConverterServiceProviderMetadata{}, fmt.Errorf("decrypting provider metadata values: %w", err)
+		}
+
+		err = json.Unmarshal(encodedValues, &providerMetadata.Values)
+		if err != nil {
+			return model.ConverterServiceProviderMetadata{}, fmt.Errorf("unmarshalling provider metadata values: %w", err)
+		}
+	}
+
+	return providerMetadata, nil
+}
+
+func mapPlaylistVersionDBToAPI(versionOutDB model.PlaylistVersionOutDB) (model.PlaylistVersion, error) {
+	playlistVersion := model.PlaylistVersion{
+		PlaylistID:          versionOutDB.PlaylistID,
+		Version:             versionOutDB.Version,
+		Change:              model.PlaylistChange(versionOutDB.Change),
+		RestoredFrom:        int(versionOutDB.RestoredFrom.Int64),
+		Name:                versionOutDB.Name,
+		PlaylistDescription: versionOutDB.PlaylistDescription.String,
+		SongCount:           versionOutDB.SongCount,
+		CreatedAt:           versionOutDB.CreatedAt,
+	}
+
+	if versionOutDB.Songs != nil {
+		err := json.Unmarshal(versionOutDB.Songs, &playlistVersion.Songs)
+		if err != nil {
+			return model.PlaylistVersion{}, fmt.Errorf("unmarshalling playlist version songs: %w", err)
+		}
+	}
+
+	return playlistVersion, nil
+}
+
+func newPlaylistPictureName(filename string) string {
+	timestamp := time.Now().Format(time.RFC3339)
+	uuid := uuid.New().String()
+	return fmt.Sprintf("playlist_cover/%s_%s_%s", timestamp, uuid, filename)
+}
+
+// defaultPlaylistPicture encodes the plain grey square used as the cover of playlists without an image.
+func defaultPlaylistPicture() ([]byte, error) {
+	const size = 300
+	picture := image.NewGray(image.Rect(0, 0, size, size))
+	draw.Draw(picture, picture.Bounds(), image.NewUniform(color.Gray{Y: 0x33}), image.Point{}, draw.Src)
+
+	var b bytes.Buffer
+	err := png.Encode(&b, picture)
+	if err != nil {
+		return nil, fmt.Errorf("encoding default playlist picture: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+// playlistPictureFilename returns the file name a playlist cover was uploaded with.
+func playlistPictureFilename(objectName string) string {
+	// neither the timestamp nor the uuid before the file name contain underscores
+	parts := strings.SplitN(path.Base(objectName), "_", 3)
+	if len(parts) < 3 {
+		return path.Base(objectName)
+	}
+
+	return parts[2]
+}
+
+// encodeSmartRules returns the JSON of the rules, nil for a playlist that isn't smart.
+func encodeSmartRules(rules *model.SmartPlaylistRules) (*string, error) {
+	if rules == nil {
+		return nil, nil
+	}
+
+	encoded, err := json.Marshal(rules)
+	if err != nil {
+		return nil, fmt.Errorf("marshalling smart playlist rules: %w", err)
+	}
+
+	rulesJSON := string(encoded)
+	return &rulesJSON, nil
+}
+
+// decodeSmartRules returns the rules in the JSON, nil for a playlist that isn't smart.
+func decodeSmartRules(encoded []byte) (*model.SmartPlaylistRules, error) {
+	if encoded == nil {
+		return nil, nil
+	}
+
+	var rules model.SmartPlaylistRules
+	err := json.Unmarshal(encoded, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshalling smart playlist rules: %w", err)
+	}
+
+	return &rules, nil
+}
+
+// smartPlaylistSongsQuery selects the songs of the catalog matching the rules of a smart playlist of ownerID
+// in the order of the rules, with the columns of playlist_song so that it can stand in for it.
+// The slices in the args still have to be expanded with sqlx.In.
+func smartPlaylistSongsQuery(rules model.SmartPlaylistRules, ownerID string) (string, []any) {
+	conditions := make([]string, 0, len(rules.Rules))
+	var args []any
+	for _, rule := range rules.Rules {
+		condition, conditionArgs := smartRuleCondition(rule, ownerID)
+		if rule.Not {
+			// songs without an ISRC don't match the rule, so they match its negation
+			condition = "NOT COALESCE(" + condition + ", FALSE)"
+		}
+
+		conditions = append(conditions, "("+condition+")")
+		args = append(args, conditionArgs...)
+	}
+
+	separator := " AND "
+	if rules.Match == "any" {
+		separator = " OR "
+	}
+
+	orderBy := smartPlaylistOrderBy(rules.OrderBy, rules.Order)
+
+	query := fmt.Sprintf(
+		`SELECT s.song_id, (ROW_NUMBER() OVER (ORDER BY %[1]s) - 1)::INT AS position,
+			NULL::TEXT AS added_by, s.created_at, s.updated_at
+		FROM song AS s
+		JOIN album AS al ON al.album_id = s.album_id
+		WHERE %[2]s
+		ORDER BY %[1]s`,
+		orderBy,
+		strings.Join(conditions, separator),
+	)
+	if rules.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, rules.Limit)
+	}
+
+	return query, args
+}
+
+func smartRuleCondition(rule model.SmartPlaylistRule, ownerID string) (string, []any) {
+	switch rule.Field {
+	case model.SmartRuleArtist:
+		return `EXISTS (
+				SELECT 1 FROM artist_song AS rule_ars
+				JOIN artist AS rule_ar ON rule_ar.artist_id = rule_ars.artist_id
+				WHERE rule_ars.song_id = s.song_id AND LOWER(rule_ar.artist_name) IN (?)
+			)`,
+			[]any{mapStrings(rule.Values, strings.ToLower)}
+	case model.SmartRuleAlbum:
+		return "LOWER(al.album_name) IN (?)", []any{mapStrings(rule.Values, strings.ToLower)}
+	case model.SmartRuleDuration:
+		bounds := []string{"TRUE"}
+		var args []any
+		if rule.MinDuration != nil {
+			bounds = append(bounds, "s.duration >= ?")
+			args = append(args, *rule.MinDuration)
+		}
+		if rule.MaxDuration != nil {
+			bounds = append(bounds, "s.duration <= ?")
+			args = append(args, *rule.MaxDuration)
+		}
+		return strings.Join(bounds, " AND "), args
+	case model.SmartRuleAddedAfter:
+		if rule.After == nil {
+			return "FALSE", nil
+		}
+		return "s.created_at > ?", []any{rule.After.UTC()}
+	case model.SmartRuleInPlaylist:
+		// the owner has to be a member of the playlists, so rules can't reveal the songs of other playlists
+		return `EXISTS (
+				SELECT 1 FROM playlist_song AS rule_pls
+				JOIN playlist AS rule_pl ON rule_pl.playlist_id = rule_pls.playlist_id
+				JOIN playlist_member AS rule_pm ON rule_pm.playlist_id = rule_pls.playlist_id
+				WHERE rule_pls.song_id = s.song_id AND rule_pls.playlist_id IN (?)
+				AND rule_pl.deleted_at IS NULL AND rule_pm.user_id = ?
+			)`,
+			[]any{rule.PlaylistIDs, ownerID}
+	case model.SmartRuleISRCPrefix:
+		prefixes := make([]string, len(rule.Values))
+		args := make([]any, len(rule.Values))
+		for i, prefix := range rule.Values {
+			prefixes[i] = "UPPER(REPLACE(s.isrc, '-', '')) LIKE ?"
+			args[i] = strings.ToUpper(prefix) + "%"
+		}
+		if len(prefixes) == 0 {
+			return "FALSE", nil
+		}
+		return strings.Join(prefixes, " OR "), args
+	case model.SmartRuleISRCCountry:
+		return "UPPER(LEFT(s.isrc, 2)) IN (?)", []any{mapStrings(rule.Values, strings.ToUpper)}
+	default:
+		return "FALSE", nil
+	}
+}
+
+// smartPlaylistOrderBy orders the songs of a smart playlist, the latest added to the catalog first by default.
+func smartPlaylistOrderBy(orderBy string, order string) string {
+	column := "s.created_at"
+	switch orderBy {
+	case "song_name":
+		column = "s.song_name"
+	case "album_name":
+		column = "al.album_name"
+	case "duration":
+		column = "s.duration"
+	}
+
+	direction := "ASC"
+	if order == "desc" || (order == "" && column == "s.created_at") {
+		direction = "DESC"
+	}
+
+	return column + " " + direction + ", s.song_id"
+}
+
+func mapStrings(values []string, f func(string) string) []string {
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = f(value)
+	}
+	return result
+}
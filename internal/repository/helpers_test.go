@@ -1,12 +1,18 @@
 package repository
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/base64"
+	"image/png"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tuannamnguyen/playlist-manager/internal/encryption"
 	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"golang.org/x/oauth2"
 )
 
 var fakeTimestamp = model.Timestamp{
@@ -165,3 +171,297 @@ func TestParsePlaylistSongData(t *testing.T) {
 		})
 	}
 }
+
+func TestInsertSongIDsAt(t *testing.T) {
+	type args struct {
+		order    []int
+		songsID  []int
+		position int
+	}
+	tests := []struct {
+		name string
+		args args
+		want []int
+	}{
+		{
+			name: "append to empty playlist",
+			args: args{order: nil, songsID: []int{1, 2}, position: -1},
+			want: []int{1, 2},
+		},
+		{
+			name: "append to end",
+			args: args{order: []int{1, 2}, songsID: []int{3}, position: -1},
+			want: []int{1, 2, 3},
+		},
+		{
+			name: "insert at beginning",
+			args: args{order: []int{1, 2}, songsID: []int{3, 4}, position: 0},
+			want: []int{3, 4, 1, 2},
+		},
+		{
+			name: "insert in the middle",
+			args: args{order: []int{1, 2, 3}, songsID: []int{4}, position: 1},
+			want: []int{1, 4, 2, 3},
+		},
+		{
+			name: "position out of range appends",
+			args: args{order: []int{1, 2}, songsID: []int{3}, position: 10},
+			want: []int{1, 2, 3},
+		},
+		{
+			name: "skip songs already in playlist and duplicates",
+			args: args{order: []int{1, 2}, songsID: []int{2, 3, 3}, position: 0},
+			want: []int{3, 1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := insertSongIDsAt(tt.args.order, tt.args.songsID, tt.args.position)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMoveSongIDRange(t *testing.T) {
+	type args struct {
+		order        []int
+		rangeStart   int
+		rangeLength  int
+		insertBefore int
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []int
+		wantErr bool
+	}{
+		{
+			name: "move first song to the end",
+			args: args{order: []int{1, 2, 3, 4}, rangeStart: 0, rangeLength: 1, insertBefore: 4},
+			want: []int{2, 3, 4, 1},
+		},
+		{
+			name: "move range to the beginning",
+			args: args{order: []int{1, 2, 3, 4, 5}, rangeStart: 2, rangeLength: 2, insertBefore: 0},
+			want: []int{3, 4, 1, 2, 5},
+		},
+		{
+			name: "move range forward",
+			args: args{order: []int{1, 2, 3, 4, 5}, rangeStart: 0, rangeLength: 2, insertBefore: 4},
+			want: []int{3, 4, 1, 2, 5},
+		},
+		{
+			name: "insert position inside range is a no-op",
+			args: args{order: []int{1, 2, 3}, rangeStart: 0, rangeLength: 2, insertBefore: 1},
+			want: []int{1, 2, 3},
+		},
+		{
+			name:    "range out of bounds",
+			args:    args{order: []int{1, 2, 3}, rangeStart: 2, rangeLength: 2, insertBefore: 0},
+			wantErr: true,
+		},
+		{
+			name:    "insert position out of bounds",
+			args:    args{order: []int{1, 2, 3}, rangeStart: 0, rangeLength: 1, insertBefore: 4},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := moveSongIDRange(tt.args.order, tt.args.rangeStart, tt.args.rangeLength, tt.args.insertBefore)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("moveSongIDRange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.ErrorIs(t, err, model.ErrInvalidSongOrder)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateSongIDsOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   []int
+		songsID []int
+		wantErr bool
+	}{
+		{
+			name:    "valid permutation",
+			order:   []int{1, 2, 3},
+			songsID: []int{3, 1, 2},
+			wantErr: false,
+		},
+		{
+			name:    "missing song",
+			order:   []int{1, 2, 3},
+			songsID: []int{3, 1},
+			wantErr: true,
+		},
+		{
+			name:    "duplicated song",
+			order:   []int{1, 2, 3},
+			songsID: []int{3, 1, 1},
+			wantErr: true,
+		},
+		{
+			name:    "song not in playlist",
+			order:   []int{1, 2, 3},
+			songsID: []int{3, 1, 4},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSongIDsOrder(tt.order, tt.songsID)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSongIDsOrder() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				assert.ErrorIs(t, err, model.ErrInvalidSongOrder)
+			}
+		})
+	}
+}
+
+func TestPlaylistPictureFilename(t *testing.T) {
+	tests := []struct {
+		name       string
+		objectName string
+		want       string
+	}{
+		{
+			name:       "uploaded cover",
+			objectName: "playlist_cover/2024-07-27T10:12:00Z_0b7e1c6a-6f0e-4a53-9d6e-2f4f0f8f0c11_my_cover.png",
+			want:       "my_cover.png",
+		},
+		{
+			name:       "copied cover",
+			objectName: newPlaylistPictureName("cover.jpg"),
+			want:       "cover.jpg",
+		},
+		{
+			name:       "not named like a cover",
+			objectName: "playlist_cover/cover.jpg",
+			want:       "cover.jpg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, playlistPictureFilename(tt.objectName))
+		})
+	}
+}
+
+func TestDefaultPlaylistPicture(t *testing.T) {
+	picture, err := defaultPlaylistPicture()
+	require.NoError(t, err)
+
+	config, err := png.DecodeConfig(bytes.NewReader(picture))
+	require.NoError(t, err)
+	assert.Equal(t, 300, config.Width)
+	assert.Equal(t, 300, config.Height)
+}
+
+func TestSmartPlaylistSongsQuery(t *testing.T) {
+	minDuration := 120000
+	after := time.Date(2024, 7, 27, 17, 12, 0, 0, time.FixedZone("UTC+7", 7*60*60))
+
+	tests := []struct {
+		name         string
+		rules        model.SmartPlaylistRules
+		wantContains []string
+		wantArgs     []any
+	}{
+		{
+			name: "every rule matches",
+			rules: model.SmartPlaylistRules{
+				Rules: []model.SmartPlaylistRule{
+					{Field: model.SmartRuleArtist, Values: []string{"Kanye West", "JAY-Z"}},
+					{Field: model.SmartRuleDuration, MinDuration: &minDuration},
+				},
+			},
+			wantContains: []string{
+				"LOWER(rule_ar.artist_name) IN (?)",
+				") AND (TRUE AND s.duration >= ?)",
+				"ORDER BY s.created_at DESC, s.song_id",
+			},
+			wantArgs: []any{[]string{"kanye west", "jay-z"}, 120000},
+		},
+		{
+			name: "any rule matches with negation and limit",
+			rules: model.SmartPlaylistRules{
+				Match: "any",
+				Rules: []model.SmartPlaylistRule{
+					{Field: model.SmartRuleISRCCountry, Values: []string{"gb"}, Not: true},
+					{Field: model.SmartRuleAddedAfter, After: &after},
+					{Field: model.SmartRuleInPlaylist, PlaylistIDs: []int{3, 5}},
+				},
+				OrderBy: "song_name",
+				Limit:   50,
+			},
+			wantContains: []string{
+				"(NOT COALESCE(UPPER(LEFT(s.isrc, 2)) IN (?), FALSE)) OR (s.created_at > ?) OR (EXISTS",
+				"rule_pm.user_id = ?",
+				"ORDER BY s.song_name ASC, s.song_id LIMIT ?",
+			},
+			wantArgs: []any{[]string{"GB"}, after.UTC(), []int{3, 5}, "auth0|owner", 50},
+		},
+		{
+			name: "isrc prefixes",
+			rules: model.SmartPlaylistRules{
+				Rules: []model.SmartPlaylistRule{
+					{Field: model.SmartRuleISRCPrefix, Values: []string{"usum7", "GBUM7"}},
+				},
+				OrderBy: "duration",
+				Order:   "desc",
+			},
+			wantContains: []string{
+				"(UPPER(REPLACE(s.isrc, '-', '')) LIKE ? OR UPPER(REPLACE(s.isrc, '-', '')) LIKE ?)",
+				"ORDER BY s.duration DESC, s.song_id",
+			},
+			wantArgs: []any{"USUM7%", "GBUM7%"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, args := smartPlaylistSongsQuery(tt.rules, "auth0|owner")
+			for _, want := range tt.wantContains {
+				assert.Contains(t, query, want)
+			}
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
+
+func TestSealProviderMetadata(t *testing.T) {
+	cipher, err := encryption.NewCipher(base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	require.NoError(t, err)
+
+	encoded, err := sealProviderMetadata(cipher, model.ConverterServiceProviderMetadata{
+		UserID: "user",
+		Token:  &oauth2.Token{AccessToken: "access token"},
+		Values: map[string]string{"musicUserToken": "music user token"},
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, encoded, "access token")
+	assert.NotContains(t, encoded, "music user token")
+
+	providerMetadata, err := openProviderMetadata(cipher, []byte(encoded))
+	require.NoError(t, err)
+	assert.Equal(t, model.ConverterServiceProviderMetadata{
+		UserID: "user",
+		Values: map[string]string{"musicUserToken": "music user token"},
+	}, providerMetadata)
+
+	encoded, err = sealProviderMetadata(cipher, model.ConverterServiceProviderMetadata{UserID: "user"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"UserID": "user"}`, encoded)
+
+	providerMetadata, err = openProviderMetadata(cipher, []byte(encoded))
+	require.NoError(t, err)
+	assert.Equal(t, model.ConverterServiceProviderMetadata{UserID: "user"}, providerMetadata)
+}
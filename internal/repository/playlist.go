@@ -1,63 +1,116 @@
 package repository
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
+	"net/http"
 	"os"
+	"path"
 	"time"
 
 	"cloud.google.com/go/storage"
-	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/tuannamnguyen/playlist-manager/internal/model"
 )
 
+// selectPlaylistQuery selects playlists with the current display name of their user.
+// Queries add a condition on whether the playlist is in the trash.
+const selectPlaylistQuery = `SELECT pl.*, u.display_name AS user_name
+	FROM playlist AS pl
+	JOIN app_user AS u ON u.user_id = pl.user_id`
+
+const (
+	playlistPictureFetchTimeout = 30 * time.Second
+	maxPlaylistPictureSize      = 10 << 20
+)
+
 type PlaylistRepository struct {
-	db        *sqlx.DB
-	gcsClient *storage.Client
+	db         *sqlx.DB
+	gcsClient  *storage.Client
+	httpClient *http.Client
 }
 
-func NewPlaylistRepository(db *sqlx.DB, gcsClient *storage.Client) *PlaylistRepository {
-	return &PlaylistRepository{db, gcsClient}
+func NewPlaylistRepository(db *sqlx.DB, gcsClient *storage.Client, httpClient *http.Client) *PlaylistRepository {
+	return &PlaylistRepository{db, gcsClient, httpClient}
 }
 
-func (p *PlaylistRepository) Insert(ctx context.Context, playlistModel model.PlaylistInDB) error {
+// Insert creates the playlist owned by its user and records it as the first version of the playlist.
+func (p *PlaylistRepository) Insert(ctx context.Context, playlistModel model.PlaylistInDB) (int, error) {
 	updatedAt := time.Now()
 	createdAt := time.Now()
 
-	_, err := p.db.ExecContext(
+	smartRules, err := encodeSmartRules(playlistModel.SmartRules)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction insert playlist: %v\n", err)
+		}
+	}()
+
+	row := tx.QueryRowxContext(
 		ctx,
-		`INSERT INTO playlist (playlist_name, user_id, user_name, playlist_description, updated_at, created_at, image_name)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`WITH new_playlist AS (
+			INSERT INTO playlist (playlist_name, user_id, playlist_description, updated_at, created_at, image_name, smart_rules)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING playlist_id, user_id
+		)
+		INSERT INTO playlist_member (playlist_id, user_id, role)
+		SELECT playlist_id, user_id, 'owner' FROM new_playlist
 		RETURNING playlist_id`,
 		playlistModel.Name,
 		playlistModel.UserID,
-		playlistModel.Username,
 		playlistModel.PlaylistDescription,
 		updatedAt,
 		createdAt,
 		playlistModel.ImageName,
+		smartRules,
 	)
 
+	var playlistID int
+	err = row.Scan(&playlistID)
 	if err != nil {
-		return &execError{err}
+		return 0, &rowScanError{err}
 	}
 
-	return nil
+	err = recordVersion(ctx, tx, playlistID, model.PlaylistChangeCreated, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, &transactionCommitError{err}
+	}
+
+	return playlistID, nil
 }
 
+// SelectAll returns the playlists the user is a member of, or every playlist when userID is empty.
+// Playlists in the trash are left out.
 func (p *PlaylistRepository) SelectAll(ctx context.Context, userID string) ([]model.Playlist, error) {
 	var playlistsOutDB []model.PlaylistOutDB
 	var query string
 	var args []interface{}
 
 	if userID != "" {
-		query = "SELECT * FROM playlist WHERE user_id = $1"
+		query = selectPlaylistQuery + " WHERE pl.deleted_at IS NULL AND pl.playlist_id IN (SELECT playlist_id FROM playlist_member WHERE user_id = $1)"
 		args = append(args, userID)
 	} else {
-		query = "SELECT * FROM playlist"
+		query = selectPlaylistQuery + " WHERE pl.deleted_at IS NULL"
 	}
 
 	err := p.db.SelectContext(ctx, &playlistsOutDB, query, args...)
@@ -65,22 +118,175 @@ func (p *PlaylistRepository) SelectAll(ctx context.Context, userID string) ([]mo
 		return nil, &selectError{err}
 	}
 
-	return p.mapPlaylistDBToAPI(playlistsOutDB)
+	playlists, err := p.mapPlaylistDBToAPI(playlistsOutDB)
+	if err != nil {
+		return nil, err
+	}
+
+	playlistIDs := make([]int, len(playlists))
+	for i, playlist := range playlists {
+		playlistIDs[i] = playlist.ID
+	}
+
+	remoteLinks, err := selectRemoteLinks(ctx, p.db, playlistIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range playlists {
+		playlists[i].RemoteLinks = remoteLinks[playlists[i].ID]
+	}
+
+	return playlists, nil
 }
 
+// SelectWithID returns the playlist, or model.ErrPlaylistNotFound when it doesn't exist or is in the trash.
 func (p *PlaylistRepository) SelectWithID(ctx context.Context, id int) (model.Playlist, error) {
 	var playlist model.PlaylistOutDB
 
-	err := p.db.QueryRowxContext(ctx, "SELECT * FROM playlist WHERE playlist_id = $1", id).StructScan(&playlist)
+	err := p.db.QueryRowxContext(ctx, selectPlaylistQuery+" WHERE pl.playlist_id = $1 AND pl.deleted_at IS NULL", id).StructScan(&playlist)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Playlist{}, model.ErrPlaylistNotFound
+	}
 	if err != nil {
 		return model.Playlist{}, &structScanError{err}
 	}
 
-	return p.mapSinglePlaylistDBToApiResponse(playlist)
+	playlistAPIResponse, err := p.mapSinglePlaylistDBToApiResponse(playlist)
+	if err != nil {
+		return model.Playlist{}, err
+	}
+
+	remoteLinks, err := selectRemoteLinks(ctx, p.db, []int{id})
+	if err != nil {
+		return model.Playlist{}, err
+	}
+	playlistAPIResponse.RemoteLinks = remoteLinks[id]
+
+	return playlistAPIResponse, nil
+}
+
+// Duplicate copies the playlist with a copy of its cover and its songs in their order, or its rules
+// for a smart playlist, to a new playlist of the user, which remembers the playlist it was forked from. An empty name keeps the name of the playlist.
+// It returns model.ErrPlaylistNotFound when the playlist doesn't exist or is in the trash.
+func (p *PlaylistRepository) Duplicate(ctx context.Context, id int, userID string, name string) (int, error) {
+	var source model.PlaylistInDB
+	err := p.db.QueryRowxContext(
+		ctx,
+		`SELECT playlist_name, COALESCE(playlist_description, '') AS playlist_description, user_id, image_name
+		FROM playlist
+		WHERE playlist_id = $1 AND deleted_at IS NULL`,
+		id,
+	).StructScan(&source)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, model.ErrPlaylistNotFound
+	}
+	if err != nil {
+		return 0, &structScanError{err}
+	}
+
+	imageName, err := p.copyPictureObject(ctx, source.ImageName)
+	if err != nil {
+		return 0, err
+	}
+
+	copyModel := model.PlaylistInDB{
+		Name:                source.Name,
+		PlaylistDescription: source.PlaylistDescription,
+		UserID:              userID,
+		ImageName:           imageName,
+	}
+	if name != "" {
+		copyModel.Name = name
+	}
+
+	playlistID, err := p.insertDuplicate(ctx, id, copyModel)
+	if err != nil {
+		// the copied cover is not referenced by any playlist so remove it
+		if deleteErr := p.DeletePlaylistPicture(ctx, imageName); deleteErr != nil {
+			log.Printf("error removing unused playlist cover %s: %v", imageName, deleteErr)
+		}
+		return 0, err
+	}
+
+	return playlistID, nil
+}
+
+// insertDuplicate inserts the copy of the playlist, its owner and its songs, which are added by the owner,
+// and records the copy as the first version of the playlist.
+func (p *PlaylistRepository) insertDuplicate(ctx context.Context, forkedFrom int, playlistModel model.PlaylistInDB) (int, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction duplicate playlist: %v\n", err)
+		}
+	}()
+
+	var playlistID int
+	err = tx.QueryRowxContext(
+		ctx,
+		`INSERT INTO playlist (playlist_name, user_id, playlist_description, image_name, forked_from, smart_rules)
+		SELECT $1, $2, $3, $4, playlist_id, smart_rules FROM playlist WHERE playlist_id = $5
+		RETURNING playlist_id`,
+		playlistModel.Name,
+		playlistModel.UserID,
+		playlistModel.PlaylistDescription,
+		playlistModel.ImageName,
+		forkedFrom,
+	).Scan(&playlistID)
+	if err != nil {
+		return 0, &rowScanError{err}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		"INSERT INTO playlist_member (playlist_id, user_id, role) VALUES ($1, $2, 'owner')",
+		playlistID,
+		playlistModel.UserID,
+	)
+	if err != nil {
+		return 0, &execError{err}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO playlist_song (playlist_id, song_id, position, added_by)
+		SELECT $1, song_id, position, $3
+		FROM playlist_song
+		WHERE playlist_id = $2`,
+		playlistID,
+		forkedFrom,
+		playlistModel.UserID,
+	)
+	if err != nil {
+		return 0, &execError{err}
+	}
+
+	err = recordVersion(ctx, tx, playlistID, model.PlaylistChangeDuplicated, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, &transactionCommitError{err}
+	}
+
+	return playlistID, nil
 }
 
-func (p *PlaylistRepository) DeleteByID(ctx context.Context, id int) error {
-	_, err := p.db.ExecContext(ctx, "DELETE FROM playlist WHERE playlist_id = $1", id)
+// Trash moves the playlist to the trash. It's kept with its songs until it's restored or purged.
+func (p *PlaylistRepository) Trash(ctx context.Context, id int) error {
+	_, err := p.db.ExecContext(
+		ctx,
+		"UPDATE playlist SET deleted_at = $2 WHERE playlist_id = $1 AND deleted_at IS NULL",
+		id,
+		time.Now().UTC(),
+	)
 	if err != nil {
 		return &execError{err}
 	}
@@ -88,12 +294,322 @@ func (p *PlaylistRepository) DeleteByID(ctx context.Context, id int) error {
 	return nil
 }
 
+// SelectTrash returns the playlists of the user in the trash, from the latest deleted.
+func (p *PlaylistRepository) SelectTrash(ctx context.Context, userID string) ([]model.Playlist, error) {
+	var playlistsOutDB []model.PlaylistOutDB
+	err := p.db.SelectContext(
+		ctx,
+		&playlistsOutDB,
+		selectPlaylistQuery+" WHERE pl.deleted_at IS NOT NULL AND pl.user_id = $1 ORDER BY pl.deleted_at DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, &selectError{err}
+	}
+
+	playlists, err := p.mapPlaylistDBToAPI(playlistsOutDB)
+	if err != nil {
+		return nil, err
+	}
+
+	return playlists, nil
+}
+
+// RestoreFromTrash takes the playlist of the user out of the trash.
+// The returned bool is false when the user has no such playlist in the trash.
+func (p *PlaylistRepository) RestoreFromTrash(ctx context.Context, id int, userID string) (bool, error) {
+	res, err := p.db.ExecContext(
+		ctx,
+		"UPDATE playlist SET deleted_at = NULL WHERE playlist_id = $1 AND user_id = $2 AND deleted_at IS NOT NULL",
+		id,
+		userID,
+	)
+	if err != nil {
+		return false, &execError{err}
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, &execError{err}
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// SelectExpiredTrash returns the IDs of the playlists moved to the trash before trashedBefore.
+func (p *PlaylistRepository) SelectExpiredTrash(ctx context.Context, trashedBefore time.Time) ([]int, error) {
+	var playlistIDs []int
+	err := p.db.SelectContext(
+		ctx,
+		&playlistIDs,
+		"SELECT playlist_id FROM playlist WHERE deleted_at < $1 ORDER BY deleted_at",
+		trashedBefore.UTC(),
+	)
+	if err != nil {
+		return nil, &selectError{err}
+	}
+
+	return playlistIDs, nil
+}
+
+// PurgeTrashed deletes the playlist in the trash for good, along with its cover image.
+// userID limits it to the playlists of the user, it purges the playlist of any user when it's empty.
+// The returned bool is false when there's no such playlist in the trash.
+func (p *PlaylistRepository) PurgeTrashed(ctx context.Context, id int, userID string) (bool, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction purge playlist: %v\n", err)
+		}
+	}()
+
+	var imageName string
+	err = tx.QueryRowxContext(
+		ctx,
+		`DELETE FROM playlist
+		WHERE playlist_id = $1 AND deleted_at IS NOT NULL AND ($2 = '' OR user_id = $2)
+		RETURNING image_name`,
+		id,
+		userID,
+	).Scan(&imageName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, &rowScanError{err}
+	}
+
+	// the row stays locked until the cover is removed, a failure keeps the playlist in the trash to be purged again
+	err = p.DeletePlaylistPicture(ctx, imageName)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, &transactionCommitError{err}
+	}
+
+	return true, nil
+}
+
+// Discard deletes the playlist for good, along with its cover image. It undoes a playlist whose creation failed.
+func (p *PlaylistRepository) Discard(ctx context.Context, id int) error {
+	var imageName string
+	err := p.db.QueryRowxContext(ctx, "DELETE FROM playlist WHERE playlist_id = $1 RETURNING image_name", id).Scan(&imageName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return &rowScanError{err}
+	}
+
+	return p.DeletePlaylistPicture(ctx, imageName)
+}
+
+// UpdateSmartRules replaces the rules of the smart playlist.
+// The returned bool is false when there's no such smart playlist.
+func (p *PlaylistRepository) UpdateSmartRules(ctx context.Context, id int, rules model.SmartPlaylistRules) (bool, error) {
+	smartRules, err := encodeSmartRules(&rules)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := p.db.ExecContext(
+		ctx,
+		"UPDATE playlist SET smart_rules = $2 WHERE playlist_id = $1 AND smart_rules IS NOT NULL AND deleted_at IS NULL",
+		id,
+		smartRules,
+	)
+	if err != nil {
+		return false, &execError{err}
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, &execError{err}
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// Freeze turns the smart playlist into a playlist with the songs currently matching its rules, added by addedBy,
+// and records it as a version of the playlist. The returned bool is false when there's no such smart playlist.
+func (p *PlaylistRepository) Freeze(ctx context.Context, id int, addedBy string) (bool, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction freeze smart playlist: %v\n", err)
+		}
+	}()
+
+	var playlist struct {
+		SmartRules []byte `db:"smart_rules"`
+		UserID     string `db:"user_id"`
+	}
+	err = tx.QueryRowxContext(
+		ctx,
+		"SELECT smart_rules, user_id FROM playlist WHERE playlist_id = $1 AND deleted_at IS NULL FOR UPDATE",
+		id,
+	).StructScan(&playlist)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, &structScanError{err}
+	}
+
+	rules, err := decodeSmartRules(playlist.SmartRules)
+	if err != nil {
+		return false, err
+	}
+	if rules == nil {
+		return false, nil
+	}
+
+	songsQuery, songsArgs := smartPlaylistSongsQuery(*rules, playlist.UserID)
+	args := append([]any{id, sql.NullString{String: addedBy, Valid: addedBy != ""}}, songsArgs...)
+
+	query, args, err := sqlx.In(
+		fmt.Sprintf(`INSERT INTO playlist_song (playlist_id, song_id, position, added_by)
+			SELECT ?::INT, song_id, position, ?::TEXT FROM (%s) AS smart`, songsQuery),
+		args...,
+	)
+	if err != nil {
+		return false, fmt.Errorf("prepare freeze smart playlist query: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	if err != nil {
+		return false, &execError{err}
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE playlist SET smart_rules = NULL WHERE playlist_id = $1", id)
+	if err != nil {
+		return false, &execError{err}
+	}
+
+	err = recordVersion(ctx, tx, id, model.PlaylistChangeFrozen, 0)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, &transactionCommitError{err}
+	}
+
+	return true, nil
+}
+
+// Update changes the given playlist fields, leaving nil fields untouched,
+// and returns the image name the playlist had before the update.
+// The cover isn't part of the history, a version is only recorded when the name or description changed.
+func (p *PlaylistRepository) Update(ctx context.Context, id int, playlistModel model.PlaylistUpdateInDB) (string, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction update playlist: %v\n", err)
+		}
+	}()
+
+	row := tx.QueryRowxContext(
+		ctx,
+		`UPDATE playlist AS pl
+		SET playlist_name = COALESCE($1, pl.playlist_name),
+			playlist_description = COALESCE($2, pl.playlist_description),
+			image_name = COALESCE($3, pl.image_name)
+		FROM (SELECT playlist_id, image_name FROM playlist WHERE playlist_id = $4 FOR UPDATE) AS old
+		WHERE pl.playlist_id = old.playlist_id
+		RETURNING old.image_name`,
+		playlistModel.Name,
+		playlistModel.PlaylistDescription,
+		playlistModel.ImageName,
+		id,
+	)
+
+	var oldImageName string
+	err = row.Scan(&oldImageName)
+	if err != nil {
+		return "", &rowScanError{err}
+	}
+
+	err = recordVersion(ctx, tx, id, model.PlaylistChangeUpdated, 0)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", &transactionCommitError{err}
+	}
+
+	return oldImageName, nil
+}
+
 func (p *PlaylistRepository) AddPlaylistPicture(ctx context.Context, file multipart.File, header *multipart.FileHeader) (string, error) {
+	return p.uploadPlaylistPicture(ctx, file, header.Filename)
+}
+
+// AddPlaylistPictureFromURL uploads the image at the URL as a playlist cover.
+// Images larger than maxPlaylistPictureSize are refused.
+func (p *PlaylistRepository) AddPlaylistPictureFromURL(ctx context.Context, imageURL string) (string, error) {
+	fetchCtx, cancel := context.WithTimeout(ctx, playlistPictureFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(fetchCtx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return "", &requestMarshalError{err}
+	}
+
+	res, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching playlist picture: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching playlist picture: unexpected status %s", res.Status)
+	}
+
+	picture, err := io.ReadAll(io.LimitReader(res.Body, maxPlaylistPictureSize+1))
+	if err != nil {
+		return "", fmt.Errorf("fetching playlist picture: %w", err)
+	}
+	if len(picture) > maxPlaylistPictureSize {
+		return "", fmt.Errorf("fetching playlist picture: larger than %d bytes", maxPlaylistPictureSize)
+	}
+
+	return p.uploadPlaylistPicture(ctx, bytes.NewReader(picture), path.Base(req.URL.Path))
+}
+
+// AddDefaultPlaylistPicture uploads the plain cover of playlists that come without an image.
+// Every playlist owns its cover, so each call uploads a new copy.
+func (p *PlaylistRepository) AddDefaultPlaylistPicture(ctx context.Context) (string, error) {
+	picture, err := defaultPlaylistPicture()
+	if err != nil {
+		return "", err
+	}
+
+	return p.uploadPlaylistPicture(ctx, bytes.NewReader(picture), "default.png")
+}
+
+func (p *PlaylistRepository) uploadPlaylistPicture(ctx context.Context, r io.Reader, filename string) (string, error) {
 	bucketName := os.Getenv("GCS_BUCKET_NAME")
 
-	timestamp := time.Now().Format(time.RFC3339)
-	uuid := uuid.New().String()
-	objectName := fmt.Sprintf("playlist_cover/%s_%s_%s", timestamp, uuid, header.Filename)
+	objectName := newPlaylistPictureName(filename)
 
 	object := p.gcsClient.Bucket(bucketName).Object(objectName)
 
@@ -102,7 +618,7 @@ func (p *PlaylistRepository) AddPlaylistPicture(ctx context.Context, file multip
 	})
 
 	wc := object.NewWriter(ctx)
-	if _, err := io.Copy(wc, file); err != nil {
+	if _, err := io.Copy(wc, r); err != nil {
 		return "", &gcsIOCopyError{err}
 	}
 
@@ -112,3 +628,46 @@ func (p *PlaylistRepository) AddPlaylistPicture(ctx context.Context, file multip
 
 	return objectName, nil
 }
+
+// CopyPlaylistPicture copies the cover of the playlist for another playlist and returns the name of the copy.
+// It returns model.ErrPlaylistNotFound when the playlist doesn't exist or is in the trash.
+func (p *PlaylistRepository) CopyPlaylistPicture(ctx context.Context, id int) (string, error) {
+	var imageName string
+	err := p.db.QueryRowxContext(ctx, "SELECT image_name FROM playlist WHERE playlist_id = $1 AND deleted_at IS NULL", id).Scan(&imageName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", model.ErrPlaylistNotFound
+	}
+	if err != nil {
+		return "", &rowScanError{err}
+	}
+
+	return p.copyPictureObject(ctx, imageName)
+}
+
+// copyPictureObject copies the cover to a new object and returns its name, which is unique like every cover.
+func (p *PlaylistRepository) copyPictureObject(ctx context.Context, objectName string) (string, error) {
+	bucket := p.gcsClient.Bucket(os.Getenv("GCS_BUCKET_NAME"))
+
+	copyName := newPlaylistPictureName(playlistPictureFilename(objectName))
+	dst := bucket.Object(copyName).If(storage.Conditions{
+		DoesNotExist: true,
+	})
+
+	_, err := dst.CopierFrom(bucket.Object(objectName)).Run(ctx)
+	if err != nil {
+		return "", &gcsCopyObjectError{err}
+	}
+
+	return copyName, nil
+}
+
+func (p *PlaylistRepository) DeletePlaylistPicture(ctx context.Context, objectName string) error {
+	bucketName := os.Getenv("GCS_BUCKET_NAME")
+
+	err := p.gcsClient.Bucket(bucketName).Object(objectName).Delete(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return &gcsDeleteObjectError{err}
+	}
+
+	return nil
+}
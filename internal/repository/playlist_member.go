@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type PlaylistMemberRepository struct {
+	db *sqlx.DB
+}
+
+func NewPlaylistMemberRepository(db *sqlx.DB) *PlaylistMemberRepository {
+	return &PlaylistMemberRepository{db: db}
+}
+
+// SelectRole returns the role of the user on the playlist, empty when they aren't a member.
+// The returned bool is false when the playlist doesn't exist or is in the trash.
+func (m *PlaylistMemberRepository) SelectRole(ctx context.Context, playlistID int, userID string) (model.PlaylistRole, bool, error) {
+	var role sql.NullString
+	err := m.db.QueryRowxContext(
+		ctx,
+		`SELECT m.role
+		FROM playlist AS pl
+		LEFT JOIN playlist_member AS m ON m.playlist_id = pl.playlist_id AND m.user_id = $2
+		WHERE pl.playlist_id = $1 AND pl.deleted_at IS NULL`,
+		playlistID,
+		userID,
+	).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, &rowScanError{err}
+	}
+
+	return model.PlaylistRole(role.String), true, nil
+}
+
+func (m *PlaylistMemberRepository) SelectAll(ctx context.Context, playlistID int) ([]model.PlaylistMember, error) {
+	var membersOutDB []model.PlaylistMemberOutDB
+	err := m.db.SelectContext(
+		ctx,
+		&membersOutDB,
+		`SELECT m.user_id, u.display_name, m.role, m.created_at, m.updated_at
+		FROM playlist_member AS m
+		JOIN app_user AS u ON u.user_id = m.user_id
+		WHERE m.playlist_id = $1
+		ORDER BY m.created_at, m.user_id`,
+		playlistID,
+	)
+	if err != nil {
+		return nil, &selectError{err}
+	}
+
+	members := make([]model.PlaylistMember, len(membersOutDB))
+	for i, memberOutDB := range membersOutDB {
+		members[i] = model.PlaylistMember{
+			UserID:      memberOutDB.UserID,
+			DisplayName: memberOutDB.DisplayName,
+			Role:        model.PlaylistRole(memberOutDB.Role),
+			Timestamp:   memberOutDB.Timestamp,
+		}
+	}
+
+	return members, nil
+}
+
+// Save adds the user to the playlist or changes their role.
+func (m *PlaylistMemberRepository) Save(ctx context.Context, playlistID int, userID string, role model.PlaylistRole) error {
+	_, err := m.db.ExecContext(
+		ctx,
+		`INSERT INTO playlist_member (playlist_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (playlist_id, user_id) DO UPDATE SET role = EXCLUDED.role`,
+		playlistID,
+		userID,
+		role,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+func (m *PlaylistMemberRepository) Delete(ctx context.Context, playlistID int, userID string) error {
+	_, err := m.db.ExecContext(
+		ctx,
+		"DELETE FROM playlist_member WHERE playlist_id = $1 AND user_id = $2",
+		playlistID,
+		userID,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+func (m *PlaylistMemberRepository) InsertInvite(ctx context.Context, invite model.PlaylistInvite) error {
+	_, err := m.db.NamedExecContext(
+		ctx,
+		`INSERT INTO playlist_invite (token, playlist_id, role, created_by, expires_at)
+		VALUES (:token, :playlist_id, :role, :created_by, :expires_at)`,
+		invite,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+// SelectInvite returns the invite with the token.
+// The returned bool is false when it doesn't exist, expired or its playlist is in the trash.
+func (m *PlaylistMemberRepository) SelectInvite(ctx context.Context, token string) (model.PlaylistInvite, bool, error) {
+	var invite model.PlaylistInvite
+	err := m.db.QueryRowxContext(
+		ctx,
+		`SELECT i.token, i.playlist_id, i.role, i.created_by, i.expires_at
+		FROM playlist_invite AS i
+		JOIN playlist AS pl ON pl.playlist_id = i.playlist_id
+		WHERE i.token = $1 AND i.expires_at > (CURRENT_TIMESTAMP AT TIME ZONE 'UTC') AND pl.deleted_at IS NULL`,
+		token,
+	).StructScan(&invite)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.PlaylistInvite{}, false, nil
+	}
+	if err != nil {
+		return model.PlaylistInvite{}, false, &structScanError{err}
+	}
+
+	return invite, true, nil
+}
+
+func (m *PlaylistMemberRepository) DeleteInvite(ctx context.Context, playlistID int, token string) error {
+	_, err := m.db.ExecContext(
+		ctx,
+		"DELETE FROM playlist_invite WHERE playlist_id = $1 AND token = $2",
+		playlistID,
+		token,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
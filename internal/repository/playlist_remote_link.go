@@ -0,0 +1,313 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tuannamnguyen/playlist-manager/internal/encryption"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+// PlaylistRemoteLinkRepository stores the links of playlists to providers,
+// with the provider metadata kept for scheduled sync encrypted with cipher.
+type PlaylistRemoteLinkRepository struct {
+	db     *sqlx.DB
+	cipher *encryption.Cipher
+}
+
+func NewPlaylistRemoteLinkRepository(db *sqlx.DB, cipher *encryption.Cipher) *PlaylistRemoteLinkRepository {
+	return &PlaylistRemoteLinkRepository{db: db, cipher: cipher}
+}
+
+// Select returns the link of the playlist to the provider.
+// The returned bool is false when the playlist was never exported to the provider.
+func (r *PlaylistRemoteLinkRepository) Select(ctx context.Context, playlistID int, provider string) (model.PlaylistRemoteLink, bool, error) {
+	var linkOutDB model.PlaylistRemoteLinkOutDB
+	err := r.db.QueryRowxContext(
+		ctx,
+		"SELECT * FROM playlist_remote_link WHERE playlist_id = $1 AND provider = $2",
+		playlistID,
+		provider,
+	).StructScan(&linkOutDB)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.PlaylistRemoteLink{}, false, nil
+	}
+	if err != nil {
+		return model.PlaylistRemoteLink{}, false, &structScanError{err}
+	}
+
+	link, err := mapRemoteLinkDBToAPI(linkOutDB)
+	if err != nil {
+		return model.PlaylistRemoteLink{}, false, err
+	}
+
+	return link, true, nil
+}
+
+// Save creates or replaces the link of the playlist to the provider.
+// A zero SyncedJobID means the tracks were changed by a job that didn't finish.
+func (r *PlaylistRemoteLinkRepository) Save(ctx context.Context, link model.PlaylistRemoteLink) error {
+	linkInDB, err := mapRemoteLinkAPIToDB(link)
+	if err != nil {
+		return err
+	}
+
+	// song_track_ids is merged so songs matched by earlier exports keep their track
+	_, err = r.db.NamedExecContext(
+		ctx,
+		`INSERT INTO playlist_remote_link (playlist_id, provider, remote_playlist_id, remote_playlist_name, track_ids, synced_job_id, synced_at, song_track_ids)
+		VALUES (:playlist_id, :provider, :remote_playlist_id, :remote_playlist_name, :track_ids, :synced_job_id, :synced_at, :song_track_ids)
+		ON CONFLICT (playlist_id, provider) DO UPDATE
+		SET remote_playlist_id = EXCLUDED.remote_playlist_id,
+			remote_playlist_name = EXCLUDED.remote_playlist_name,
+			track_ids = EXCLUDED.track_ids,
+			synced_job_id = EXCLUDED.synced_job_id,
+			synced_at = EXCLUDED.synced_at,
+			song_track_ids = playlist_remote_link.song_track_ids || EXCLUDED.song_track_ids`,
+		linkInDB,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+// UpdateSyncStatus stores the outcome of the job on the link of the job's playlist to the job's provider.
+// It does nothing when the playlist has no link to the provider.
+func (r *PlaylistRemoteLinkRepository) UpdateSyncStatus(ctx context.Context, jobID int, status model.JobStatus, errMessage string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`UPDATE playlist_remote_link AS l
+		SET last_job_id = j.job_id, last_sync_status = $1, last_sync_error = NULLIF($2, '')
+		FROM conversion_job AS j
+		WHERE j.job_id = $3 AND l.playlist_id = j.playlist_id AND l.provider = j.provider`,
+		status,
+		errMessage,
+		jobID,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+// SaveTwoWayState records the state both playlists were merged into by a two-way sync.
+func (r *PlaylistRemoteLinkRepository) SaveTwoWayState(ctx context.Context, link model.PlaylistRemoteLink, status model.JobStatus) error {
+	linkInDB, err := mapRemoteLinkAPIToDB(link)
+	if err != nil {
+		return err
+	}
+
+	encodedConflicts, err := json.Marshal(link.Conflicts)
+	if err != nil {
+		return fmt.Errorf("marshalling remote playlist sync conflicts: %w", err)
+	}
+
+	_, err = r.db.ExecContext(
+		ctx,
+		`UPDATE playlist_remote_link
+		SET track_ids = $1,
+			song_track_ids = $2,
+			snapshot_id = NULLIF($3, ''),
+			conflicts = $4,
+			synced_at = CURRENT_TIMESTAMP,
+			two_way_synced_at = CURRENT_TIMESTAMP,
+			last_sync_status = $5,
+			last_sync_error = NULL
+		WHERE playlist_id = $6 AND provider = $7`,
+		linkInDB.TrackIDs,
+		linkInDB.SongTrackIDs,
+		link.SnapshotID,
+		string(encodedConflicts),
+		status,
+		link.PlaylistID,
+		link.Provider,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+// SaveTwoWayError records a failed two-way sync. The scheduled sync waits for the next interval to retry.
+func (r *PlaylistRemoteLinkRepository) SaveTwoWayError(ctx context.Context, playlistID int, provider string, errMessage string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`UPDATE playlist_remote_link
+		SET two_way_synced_at = CURRENT_TIMESTAMP, last_sync_status = $1, last_sync_error = $2
+		WHERE playlist_id = $3 AND provider = $4`,
+		model.JobStatusFailed,
+		errMessage,
+		playlistID,
+		provider,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+// UpdateAutoSync turns the scheduled two-way sync of the link on or off.
+// The provider metadata is only kept while the scheduled sync is on.
+func (r *PlaylistRemoteLinkRepository) UpdateAutoSync(
+	ctx context.Context,
+	playlistID int,
+	provider string,
+	autoSync bool,
+	providerMetadata model.ConverterServiceProviderMetadata,
+) error {
+	var encodedMetadata *string
+	if autoSync {
+		metadataJSON, err := sealProviderMetadata(r.cipher, providerMetadata)
+		if err != nil {
+			return err
+		}
+		encodedMetadata = &metadataJSON
+	}
+
+	_, err := r.db.ExecContext(
+		ctx,
+		`UPDATE playlist_remote_link SET auto_sync = $1, provider_metadata = $2 WHERE playlist_id = $3 AND provider = $4`,
+		autoSync,
+		encodedMetadata,
+		playlistID,
+		provider,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+func (r *PlaylistRemoteLinkRepository) SelectProviderMetadata(
+	ctx context.Context,
+	playlistID int,
+	provider string,
+) (model.ConverterServiceProviderMetadata, error) {
+	var encodedMetadata []byte
+	err := r.db.QueryRowxContext(
+		ctx,
+		"SELECT provider_metadata FROM playlist_remote_link WHERE playlist_id = $1 AND provider = $2",
+		playlistID,
+		provider,
+	).Scan(&encodedMetadata)
+	if err != nil {
+		return model.ConverterServiceProviderMetadata{}, &rowScanError{err}
+	}
+
+	if encodedMetadata == nil {
+		return model.ConverterServiceProviderMetadata{}, nil
+	}
+
+	return openProviderMetadata(r.cipher, encodedMetadata)
+}
+
+// SelectAutoSyncDue returns the links with scheduled sync turned on that were not synced since syncedBefore
+// and are not being synced. Links of playlists in the trash are left out.
+func (r *PlaylistRemoteLinkRepository) SelectAutoSyncDue(ctx context.Context, syncedBefore time.Time) ([]model.PlaylistRemoteLink, error) {
+	var linksOutDB []model.PlaylistRemoteLinkOutDB
+	err := r.db.SelectContext(
+		ctx,
+		&linksOutDB,
+		`SELECT * FROM playlist_remote_link
+		WHERE auto_sync
+		AND (two_way_synced_at IS NULL OR two_way_synced_at < $1)
+		AND (sync_locked_until IS NULL OR sync_locked_until < CURRENT_TIMESTAMP)
+		AND playlist_id IN (SELECT playlist_id FROM playlist WHERE deleted_at IS NULL)
+		ORDER BY two_way_synced_at NULLS FIRST`,
+		syncedBefore,
+	)
+	if err != nil {
+		return nil, &selectError{err}
+	}
+
+	links := make([]model.PlaylistRemoteLink, 0, len(linksOutDB))
+	for _, linkOutDB := range linksOutDB {
+		link, err := mapRemoteLinkDBToAPI(linkOutDB)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// Lock reserves the link for a two-way sync for at most ttl.
+// The returned bool is false when another sync holds the link.
+func (r *PlaylistRemoteLinkRepository) Lock(ctx context.Context, playlistID int, provider string, ttl time.Duration) (bool, error) {
+	res, err := r.db.ExecContext(
+		ctx,
+		`UPDATE playlist_remote_link SET sync_locked_until = $1
+		WHERE playlist_id = $2 AND provider = $3
+		AND (sync_locked_until IS NULL OR sync_locked_until < CURRENT_TIMESTAMP)`,
+		time.Now().Add(ttl),
+		playlistID,
+		provider,
+	)
+	if err != nil {
+		return false, &execError{err}
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, &execError{err}
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (r *PlaylistRemoteLinkRepository) Unlock(ctx context.Context, playlistID int, provider string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`UPDATE playlist_remote_link SET sync_locked_until = NULL WHERE playlist_id = $1 AND provider = $2`,
+		playlistID,
+		provider,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+// selectRemoteLinks returns the links of the playlists, keyed by playlist ID.
+func selectRemoteLinks(ctx context.Context, db *sqlx.DB, playlistIDs []int) (map[int][]model.PlaylistRemoteLink, error) {
+	links := make(map[int][]model.PlaylistRemoteLink)
+	if len(playlistIDs) == 0 {
+		return links, nil
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM playlist_remote_link WHERE playlist_id IN (?) ORDER BY provider", playlistIDs)
+	if err != nil {
+		return nil, &prepareInQueryError{err}
+	}
+	query = db.Rebind(query)
+
+	var linksOutDB []model.PlaylistRemoteLinkOutDB
+	err = db.SelectContext(ctx, &linksOutDB, query, args...)
+	if err != nil {
+		return nil, &selectError{err}
+	}
+
+	for _, linkOutDB := range linksOutDB {
+		link, err := mapRemoteLinkDBToAPI(linkOutDB)
+		if err != nil {
+			return nil, err
+		}
+
+		links[link.PlaylistID] = append(links[link.PlaylistID], link)
+	}
+
+	return links, nil
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type PlaylistShareRepository struct {
+	db *sqlx.DB
+}
+
+func NewPlaylistShareRepository(db *sqlx.DB) *PlaylistShareRepository {
+	return &PlaylistShareRepository{db: db}
+}
+
+func (s *PlaylistShareRepository) Insert(ctx context.Context, token string, playlistID int, createdBy string) (model.PlaylistShare, error) {
+	var share model.PlaylistShare
+	err := s.db.QueryRowxContext(
+		ctx,
+		`INSERT INTO playlist_share (token, playlist_id, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING *`,
+		token,
+		playlistID,
+		createdBy,
+	).StructScan(&share)
+	if err != nil {
+		return model.PlaylistShare{}, &structScanError{err}
+	}
+
+	return share, nil
+}
+
+func (s *PlaylistShareRepository) SelectAll(ctx context.Context, playlistID int) ([]model.PlaylistShare, error) {
+	shares := []model.PlaylistShare{}
+	err := s.db.SelectContext(
+		ctx,
+		&shares,
+		"SELECT * FROM playlist_share WHERE playlist_id = $1 ORDER BY created_at",
+		playlistID,
+	)
+	if err != nil {
+		return nil, &selectError{err}
+	}
+
+	return shares, nil
+}
+
+// SelectPlaylistID returns the playlist shared with the token.
+// The returned bool is false when the token was revoked or the playlist is in the trash.
+func (s *PlaylistShareRepository) SelectPlaylistID(ctx context.Context, token string) (int, bool, error) {
+	var playlistID int
+	err := s.db.QueryRowxContext(
+		ctx,
+		`SELECT s.playlist_id
+		FROM playlist_share AS s
+		JOIN playlist AS pl ON pl.playlist_id = s.playlist_id
+		WHERE s.token = $1 AND pl.deleted_at IS NULL`,
+		token,
+	).Scan(&playlistID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, &rowScanError{err}
+	}
+
+	return playlistID, true, nil
+}
+
+func (s *PlaylistShareRepository) Delete(ctx context.Context, playlistID int, token string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		"DELETE FROM playlist_share WHERE playlist_id = $1 AND token = $2",
+		playlistID,
+		token,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -23,7 +24,16 @@ func NewPlaylistSongRepository(db *sqlx.DB) *PlaylistSongRepository {
 	}
 }
 
-func (ps *PlaylistSongRepository) BulkInsert(ctx context.Context, playlistID int, songsID []int) error {
+func (ps *PlaylistSongRepository) BulkInsert(ctx context.Context, playlistID int, songsID []int, addedBy string) error {
+	return ps.InsertAt(ctx, playlistID, songsID, -1, addedBy)
+}
+
+// InsertAt adds songs to a playlist before the given position.
+// A negative or out of range position appends the songs to the end of the playlist.
+// Songs that are already in the playlist keep their current position.
+// addedBy is the user adding the songs, empty when they were added by a sync.
+// The change is recorded as a version of the playlist.
+func (ps *PlaylistSongRepository) InsertAt(ctx context.Context, playlistID int, songsID []int, position int, addedBy string) error {
 	tx, err := ps.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return &beginTransactionError{err}
@@ -35,14 +45,38 @@ func (ps *PlaylistSongRepository) BulkInsert(ctx context.Context, playlistID int
 		}
 	}()
 
-	query := `INSERT INTO playlist_song (playlist_id, song_id)
+	err = checkStaticPlaylist(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+
+	order, err := selectOrderedSongIDs(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+
+	newOrder := insertSongIDsAt(order, songsID, position)
+	if len(newOrder) == len(order) {
+		return nil
+	}
+
+	query := `INSERT INTO playlist_song (playlist_id, song_id, position, added_by)
 			VALUES %s ON CONFLICT DO NOTHING`
 
-	valueStrings := make([]string, 0, len(songsID))
-	valueArgs := make([]any, 0, len(songsID)*2)
-	for _, songID := range songsID {
-		valueStrings = append(valueStrings, "(?, ?)")
-		valueArgs = append(valueArgs, playlistID, songID)
+	inPlaylist := make(map[int]bool, len(order))
+	for _, songID := range order {
+		inPlaylist[songID] = true
+	}
+
+	valueStrings := make([]string, 0, len(newOrder)-len(order))
+	valueArgs := make([]any, 0, (len(newOrder)-len(order))*4)
+	addedByUser := sql.NullString{String: addedBy, Valid: addedBy != ""}
+	for index, songID := range newOrder {
+		if inPlaylist[songID] {
+			continue
+		}
+		valueStrings = append(valueStrings, "(?, ?, ?, ?)")
+		valueArgs = append(valueArgs, playlistID, songID, index, addedByUser)
 	}
 
 	query = sqlx.Rebind(
@@ -55,6 +89,64 @@ func (ps *PlaylistSongRepository) BulkInsert(ctx context.Context, playlistID int
 		return &execError{err}
 	}
 
+	err = updatePositions(ctx, tx, playlistID, newOrder)
+	if err != nil {
+		return err
+	}
+
+	err = recordVersion(ctx, tx, playlistID, model.PlaylistChangeSongsAdded, 0)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &transactionCommitError{err}
+	}
+
+	return nil
+}
+
+// MoveRange moves rangeLength songs starting at rangeStart so that they are placed
+// before the song currently at insertBefore, mirroring Spotify's reorder semantics.
+// The change is recorded as a version of the playlist.
+func (ps *PlaylistSongRepository) MoveRange(ctx context.Context, playlistID int, rangeStart int, rangeLength int, insertBefore int) error {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction move playlist songs: %v\n", err)
+		}
+	}()
+
+	err = checkStaticPlaylist(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+
+	order, err := selectOrderedSongIDs(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+
+	newOrder, err := moveSongIDRange(order, rangeStart, rangeLength, insertBefore)
+	if err != nil {
+		return err
+	}
+
+	err = updatePositions(ctx, tx, playlistID, newOrder)
+	if err != nil {
+		return err
+	}
+
+	err = recordVersion(ctx, tx, playlistID, model.PlaylistChangeSongsMoved, 0)
+	if err != nil {
+		return err
+	}
+
 	err = tx.Commit()
 	if err != nil {
 		return &transactionCommitError{err}
@@ -63,29 +155,80 @@ func (ps *PlaylistSongRepository) BulkInsert(ctx context.Context, playlistID int
 	return nil
 }
 
+// Reorder replaces the order of a playlist. songsID must contain every song of the playlist exactly once.
+// The change is recorded as a version of the playlist.
+func (ps *PlaylistSongRepository) Reorder(ctx context.Context, playlistID int, songsID []int) error {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction reorder playlist songs: %v\n", err)
+		}
+	}()
+
+	err = checkStaticPlaylist(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+
+	order, err := selectOrderedSongIDs(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+
+	err = validateSongIDsOrder(order, songsID)
+	if err != nil {
+		return err
+	}
+
+	err = updatePositions(ctx, tx, playlistID, songsID)
+	if err != nil {
+		return err
+	}
+
+	err = recordVersion(ctx, tx, playlistID, model.PlaylistChangeSongsReordered, 0)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &transactionCommitError{err}
+	}
+
+	return nil
+}
+
+// GetAll returns the songs of the playlist. The songs of a smart playlist are the songs of the catalog matching its rules.
 func (ps *PlaylistSongRepository) GetAll(ctx context.Context, playlistID int, sortBy string, sortOrder string) ([]model.SongOutAPI, error) {
-	var query string
+	rules, ownerID, err := selectSmartRules(ctx, ps.db, playlistID)
+	if err != nil {
+		return nil, err
+	}
 
-	if sortBy == "" && sortOrder == "" {
-		query = `SELECT pls.song_id, s.song_name, s.image_url, s.duration, s.isrc, al.album_name, ar.artist_name, pls.created_at, pls.updated_at
-				FROM playlist_song AS pls
-				JOIN playlist AS pl
-				ON pl.playlist_id = pls.playlist_id
-				JOIN song AS s
-				ON pls.song_id = s.song_id
-				JOIN album AS al
-				ON al.album_id = s.album_id
-				JOIN artist_song AS ars
-				ON s.song_id = ars.song_id
-				JOIN artist AS ar
-				ON ars.artist_id = ar.artist_id
-				WHERE pl.playlist_id = $1
-				ORDER BY song_id, ar.artist_id`
-	} else {
-		query = fmt.Sprintf(`SELECT pls.song_id, s.song_name, s.image_url, s.duration, s.isrc, al.album_name, ar.artist_name, pls.created_at, pls.updated_at
-				FROM playlist_song AS pls
-				JOIN playlist AS pl
-				ON pl.playlist_id = pls.playlist_id
+	songsQuery := "SELECT song_id, position, added_by, created_at, updated_at FROM playlist_song WHERE playlist_id = ?"
+	args := []any{playlistID}
+	if rules != nil {
+		songsQuery, args = smartPlaylistSongsQuery(*rules, ownerID)
+	}
+
+	orderBy := "pls.position, ars.artist_insertion_order"
+	if sortBy != "" || sortOrder != "" {
+		orderBy = fmt.Sprintf("%s %s, %s", sortBy, sortOrder, orderBy)
+	}
+
+	return selectPlaylistSongs(ctx, ps.db, songsQuery, args, orderBy)
+}
+
+// selectPlaylistSongs returns the songs picked by songsQuery, which selects the playlist_song columns, ordered by orderBy.
+func selectPlaylistSongs(ctx context.Context, q sqlx.QueryerContext, songsQuery string, args []any, orderBy string) ([]model.SongOutAPI, error) {
+	query, args, err := sqlx.In(
+		fmt.Sprintf(`WITH pls AS (%s)
+				SELECT pls.song_id, s.song_name, s.image_url, s.duration, s.isrc, al.album_name, ar.artist_name, pls.position, pls.added_by, pls.created_at, pls.updated_at
+				FROM pls
 				JOIN song AS s
 				ON pls.song_id = s.song_id
 				JOIN album AS al
@@ -94,12 +237,15 @@ func (ps *PlaylistSongRepository) GetAll(ctx context.Context, playlistID int, so
 				ON s.song_id = ars.song_id
 				JOIN artist AS ar
 				ON ars.artist_id = ar.artist_id
-				WHERE pl.playlist_id = $1
-				ORDER BY %s %s`, sortBy, sortOrder)
+				ORDER BY %s`, songsQuery, orderBy),
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select playlist songs query: %w", err)
 	}
 
 	var rows []model.SongOutDB
-	err := ps.db.SelectContext(ctx, &rows, query, playlistID)
+	err = sqlx.SelectContext(ctx, q, &rows, sqlx.Rebind(sqlx.DOLLAR, query), args...)
 	if err != nil {
 		return nil, &selectError{err}
 	}
@@ -107,14 +253,296 @@ func (ps *PlaylistSongRepository) GetAll(ctx context.Context, playlistID int, so
 	return parsePlaylistSongData(rows), nil
 }
 
+// Rewrite replaces the songs of the playlist with the songs rewrite returns for its current songs
+// and records the change as a version of the playlist, in one transaction.
+// Songs that were not in the playlist are added by addedBy, empty when they were added by a sync.
+func (ps *PlaylistSongRepository) Rewrite(
+	ctx context.Context,
+	playlistID int,
+	addedBy string,
+	change model.PlaylistChange,
+	rewrite func(songs []model.SongOutAPI) ([]int, error),
+) error {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction rewrite playlist songs: %v\n", err)
+		}
+	}()
+
+	err = checkStaticPlaylist(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+
+	order, err := selectOrderedSongIDs(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+
+	songs, err := selectPlaylistSongs(
+		ctx,
+		tx,
+		"SELECT song_id, position, added_by, created_at, updated_at FROM playlist_song WHERE playlist_id = ?",
+		[]any{playlistID},
+		"pls.position, pls.created_at, pls.song_id, ars.artist_insertion_order",
+	)
+	if err != nil {
+		return err
+	}
+
+	newOrder, err := rewrite(songs)
+	if err != nil {
+		return err
+	}
+	if slices.Equal(order, newOrder) {
+		return nil
+	}
+
+	inNewOrder := make(map[int]bool, len(newOrder))
+	for _, songID := range newOrder {
+		if inNewOrder[songID] {
+			return fmt.Errorf("song %d is more than once in the new order of playlist %d", songID, playlistID)
+		}
+		inNewOrder[songID] = true
+	}
+
+	inPlaylist := make(map[int]bool, len(order))
+	var removed []int
+	for _, songID := range order {
+		inPlaylist[songID] = true
+		if !inNewOrder[songID] {
+			removed = append(removed, songID)
+		}
+	}
+
+	if len(removed) > 0 {
+		query, args, err := sqlx.In("DELETE FROM playlist_song WHERE playlist_id = (?) AND song_id IN (?)", playlistID, removed)
+		if err != nil {
+			return fmt.Errorf("prepare delete songs in playlist query: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+		if err != nil {
+			return &execError{err}
+		}
+	}
+
+	var valueStrings []string
+	var valueArgs []any
+	addedByUser := sql.NullString{String: addedBy, Valid: addedBy != ""}
+	for index, songID := range newOrder {
+		if inPlaylist[songID] {
+			continue
+		}
+		valueStrings = append(valueStrings, "(?, ?, ?, ?)")
+		valueArgs = append(valueArgs, playlistID, songID, index, addedByUser)
+	}
+
+	if len(valueStrings) > 0 {
+		query := sqlx.Rebind(
+			sqlx.DOLLAR,
+			fmt.Sprintf(
+				`INSERT INTO playlist_song (playlist_id, song_id, position, added_by) VALUES %s`,
+				strings.Join(valueStrings, ","),
+			),
+		)
+
+		_, err = tx.ExecContext(ctx, query, valueArgs...)
+		if err != nil {
+			return &execError{err}
+		}
+	}
+
+	err = updatePositions(ctx, tx, playlistID, newOrder)
+	if err != nil {
+		return err
+	}
+
+	err = recordVersion(ctx, tx, playlistID, change, 0)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &transactionCommitError{err}
+	}
+
+	return nil
+}
+
+// GetAllOfUser returns the songs of every playlist the user is a member of by playlist ID, in the playlist order.
+// Smart playlists are left out since their songs come from the catalog, and so are playlists in the trash.
+func (ps *PlaylistSongRepository) GetAllOfUser(ctx context.Context, userID string) (map[int][]model.SongOutAPI, error) {
+	var rows []struct {
+		PlaylistID int `db:"playlist_id"`
+		model.SongOutDB
+	}
+	err := ps.db.SelectContext(
+		ctx,
+		&rows,
+		`SELECT pls.playlist_id, pls.song_id, s.song_name, s.image_url, s.duration, s.isrc, al.album_name, ar.artist_name, pls.position, pls.added_by, pls.created_at, pls.updated_at
+		FROM playlist_song AS pls
+		JOIN playlist AS pl
+		ON pl.playlist_id = pls.playlist_id
+		JOIN playlist_member AS pm
+		ON pm.playlist_id = pl.playlist_id
+		JOIN song AS s
+		ON pls.song_id = s.song_id
+		JOIN album AS al
+		ON al.album_id = s.album_id
+		JOIN artist_song AS ars
+		ON s.song_id = ars.song_id
+		JOIN artist AS ar
+		ON ars.artist_id = ar.artist_id
+		WHERE pm.user_id = $1 AND pl.deleted_at IS NULL AND pl.smart_rules IS NULL
+		ORDER BY pls.playlist_id, pls.position, ars.artist_insertion_order`,
+		userID,
+	)
+	if err != nil {
+		return nil, &selectError{err}
+	}
+
+	rowsByPlaylist := make(map[int][]model.SongOutDB)
+	for _, row := range rows {
+		rowsByPlaylist[row.PlaylistID] = append(rowsByPlaylist[row.PlaylistID], row.SongOutDB)
+	}
+
+	songsByPlaylist := make(map[int][]model.SongOutAPI, len(rowsByPlaylist))
+	for playlistID, playlistRows := range rowsByPlaylist {
+		songsByPlaylist[playlistID] = parsePlaylistSongData(playlistRows)
+	}
+
+	return songsByPlaylist, nil
+}
+
+// BulkDelete removes the songs from the playlist and records the change as a version of the playlist.
 func (ps *PlaylistSongRepository) BulkDelete(ctx context.Context, playlistID int, songsID []int) error {
+	tx, err := ps.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction delete playlist songs: %v\n", err)
+		}
+	}()
+
+	err = checkStaticPlaylist(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+
 	query, args, err := sqlx.In("DELETE FROM playlist_song WHERE playlist_id = (?) AND song_id IN (?)", playlistID, songsID)
 	if err != nil {
 		return fmt.Errorf("prepare delete songs in playlist query: %w", err)
 	}
 	query = sqlx.Rebind(sqlx.DOLLAR, query)
 
-	_, err = ps.db.ExecContext(ctx, query, args...)
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return &execError{err}
+	}
+
+	err = recordVersion(ctx, tx, playlistID, model.PlaylistChangeSongsRemoved, 0)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &transactionCommitError{err}
+	}
+
+	return nil
+}
+
+// selectSmartRules returns the rules and the owner of the playlist. The rules are nil when it isn't a smart playlist.
+func selectSmartRules(ctx context.Context, q sqlx.QueryerContext, playlistID int) (*model.SmartPlaylistRules, string, error) {
+	var playlist struct {
+		SmartRules []byte `db:"smart_rules"`
+		UserID     string `db:"user_id"`
+	}
+	err := q.QueryRowxContext(ctx, "SELECT smart_rules, user_id FROM playlist WHERE playlist_id = $1", playlistID).StructScan(&playlist)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", &structScanError{err}
+	}
+
+	rules, err := decodeSmartRules(playlist.SmartRules)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return rules, playlist.UserID, nil
+}
+
+// checkStaticPlaylist returns model.ErrSmartPlaylistReadOnly for a smart playlist, whose songs can't be changed.
+// It locks the playlist until the transaction ends, so changes to its songs and its versions happen one at a time.
+func checkStaticPlaylist(ctx context.Context, q sqlx.QueryerContext, playlistID int) error {
+	var smart bool
+	err := q.QueryRowxContext(ctx, "SELECT smart_rules IS NOT NULL FROM playlist WHERE playlist_id = $1 FOR UPDATE", playlistID).Scan(&smart)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return &rowScanError{err}
+	}
+
+	if smart {
+		return model.ErrSmartPlaylistReadOnly
+	}
+
+	return nil
+}
+
+func selectOrderedSongIDs(ctx context.Context, tx *sqlx.Tx, playlistID int) ([]int, error) {
+	var songsID []int
+	err := tx.SelectContext(
+		ctx,
+		&songsID,
+		`SELECT song_id FROM playlist_song WHERE playlist_id = $1 ORDER BY position, created_at, song_id FOR UPDATE`,
+		playlistID,
+	)
+	if err != nil {
+		return nil, &selectError{err}
+	}
+
+	return songsID, nil
+}
+
+func updatePositions(ctx context.Context, tx *sqlx.Tx, playlistID int, songsID []int) error {
+	if len(songsID) == 0 {
+		return nil
+	}
+
+	query := `UPDATE playlist_song AS pls
+			SET position = v.position
+			FROM (VALUES %s) AS v(song_id, position)
+			WHERE pls.playlist_id = ? AND pls.song_id = v.song_id AND pls.position <> v.position`
+
+	valueStrings := make([]string, 0, len(songsID))
+	valueArgs := make([]any, 0, len(songsID)*2+1)
+	for index, songID := range songsID {
+		valueStrings = append(valueStrings, "(?::INT, ?::INT)")
+		valueArgs = append(valueArgs, songID, index)
+	}
+	valueArgs = append(valueArgs, playlistID)
+
+	query = sqlx.Rebind(
+		sqlx.DOLLAR,
+		fmt.Sprintf(query, strings.Join(valueStrings, ",")),
+	)
+
+	_, err := tx.ExecContext(ctx, query, valueArgs...)
 	if err != nil {
 		return &execError{err}
 	}
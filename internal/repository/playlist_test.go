@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+func TestPlaylistRepositorySmartPlaylist(t *testing.T) {
+	db, cleanup := setupTestDB(t, "test_init_script.sql")
+	defer cleanup()
+
+	ctx := context.Background()
+	const ownerID = "auth0|owner"
+
+	err := NewUserRepository(db).Insert(ctx, model.UserInDB{ID: ownerID, DisplayName: "owner"})
+	require.NoError(t, err)
+
+	albumID, err := NewAlbumRepository(db).InsertAndGetID(ctx, "Graduation")
+	require.NoError(t, err)
+	insertArtist := func(name string) int {
+		artistIDs, err := NewArtistRepository(db).BulkInsertAndGetIDs(ctx, []string{name})
+		require.NoError(t, err)
+		return artistIDs[0]
+	}
+	kanyeWest, daftPunk := insertArtist("Kanye West"), insertArtist("Daft Punk")
+
+	insertSong := func(name string, duration int, artistIDs ...int) int {
+		songID, err := NewSongRepository(db).InsertAndGetID(ctx, model.SongInDB{Name: name, AlbumID: albumID, Duration: duration})
+		require.NoError(t, err)
+		err = NewArtistSongRepository(db).Insert(ctx, songID, artistIDs)
+		require.NoError(t, err)
+		return songID
+	}
+	stronger := insertSong("Stronger", 311000, kanyeWest, daftPunk)
+	insertSong("Good Life", 207000, kanyeWest)
+	oneMoreTime := insertSong("One More Time", 320000, daftPunk)
+
+	playlistRepo := NewPlaylistRepository(db, nil, nil)
+	playlistSongRepo := NewPlaylistSongRepository(db)
+
+	staticID, err := playlistRepo.Insert(ctx, model.PlaylistInDB{Name: "Discovery", UserID: ownerID, ImageName: "discovery.png"})
+	require.NoError(t, err)
+	err = playlistSongRepo.BulkInsert(ctx, staticID, []int{oneMoreTime}, ownerID)
+	require.NoError(t, err)
+
+	minDuration := 250000
+	smartID, err := playlistRepo.Insert(ctx, model.PlaylistInDB{
+		Name:      "Long songs",
+		UserID:    ownerID,
+		ImageName: "smart.png",
+		SmartRules: &model.SmartPlaylistRules{
+			Rules: []model.SmartPlaylistRule{
+				{Field: model.SmartRuleDuration, MinDuration: &minDuration},
+				{Field: model.SmartRuleArtist, Values: []string{"Kanye West", "Daft Punk"}},
+			},
+			OrderBy: "song_name",
+		},
+	})
+	require.NoError(t, err)
+
+	songIDs := func(playlistID int) []int {
+		songs, err := playlistSongRepo.GetAll(ctx, playlistID, "", "")
+		require.NoError(t, err)
+		ids := make([]int, 0, len(songs))
+		for _, song := range songs {
+			ids = append(ids, song.ID)
+		}
+		return ids
+	}
+
+	songs, err := playlistSongRepo.GetAll(ctx, smartID, "", "")
+	require.NoError(t, err)
+	require.Len(t, songs, 2)
+	assert.Equal(t, oneMoreTime, songs[0].ID)
+	assert.Equal(t, stronger, songs[1].ID)
+	assert.Equal(t, []string{"Kanye West", "Daft Punk"}, songs[1].ArtistNames)
+	assert.Equal(t, 1, songs[1].Position)
+
+	frozen, err := playlistRepo.Freeze(ctx, smartID, ownerID)
+	require.NoError(t, err)
+	require.True(t, frozen)
+	assert.Equal(t, []int{oneMoreTime, stronger}, songIDs(smartID))
+
+	// a frozen playlist keeps its songs when new songs match its rules
+	insertSong("Flashing Lights", 600000, kanyeWest)
+	assert.Equal(t, []int{oneMoreTime, stronger}, songIDs(smartID))
+
+	frozen, err = playlistRepo.Freeze(ctx, smartID, ownerID)
+	require.NoError(t, err)
+	assert.False(t, frozen)
+
+	// the in_playlist rule only matches the songs of playlists the owner is a member of
+	inPlaylistID, err := playlistRepo.Insert(ctx, model.PlaylistInDB{
+		Name:      "From my playlists",
+		UserID:    ownerID,
+		ImageName: "in-playlist.png",
+		SmartRules: &model.SmartPlaylistRules{
+			Rules: []model.SmartPlaylistRule{
+				{Field: model.SmartRuleInPlaylist, PlaylistIDs: []int{staticID}},
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int{oneMoreTime}, songIDs(inPlaylistID))
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type PlaylistVersionRepository struct {
+	db *sqlx.DB
+}
+
+func NewPlaylistVersionRepository(db *sqlx.DB) *PlaylistVersionRepository {
+	return &PlaylistVersionRepository{db: db}
+}
+
+// recordVersion saves the state of the playlist in the transaction as its next version,
+// unless it's the same as the latest version. restoredFrom is zero when the change isn't a restore.
+func recordVersion(ctx context.Context, tx *sqlx.Tx, playlistID int, change model.PlaylistChange, restoredFrom int) error {
+	// concurrent changes wait for each other so they get different version numbers
+	_, err := tx.ExecContext(ctx, "SELECT 1 FROM playlist WHERE playlist_id = $1 FOR UPDATE", playlistID)
+	if err != nil {
+		return &execError{err}
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO playlist_version (playlist_id, version, change, restored_from, playlist_name, playlist_description, songs)
+		SELECT pl.playlist_id, COALESCE(latest.version, 0) + 1, $2, $3, pl.playlist_name, pl.playlist_description, current.songs
+		FROM playlist AS pl
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(
+				jsonb_agg(
+					jsonb_build_object('song_id', pls.song_id, 'added_by', pls.added_by, 'added_at', pls.created_at AT TIME ZONE 'UTC')
+					ORDER BY pls.position
+				),
+				'[]'
+			) AS songs
+			FROM playlist_song AS pls
+			WHERE pls.playlist_id = pl.playlist_id
+		) AS current
+		LEFT JOIN LATERAL (
+			SELECT * FROM playlist_version WHERE playlist_id = pl.playlist_id ORDER BY version DESC LIMIT 1
+		) AS latest ON TRUE
+		WHERE pl.playlist_id = $1
+		AND (
+			latest.version IS NULL
+			OR latest.playlist_name IS DISTINCT FROM pl.playlist_name
+			OR latest.playlist_description IS DISTINCT FROM pl.playlist_description
+			OR latest.songs <> current.songs
+		)`,
+		playlistID,
+		change,
+		sql.NullInt64{Int64: int64(restoredFrom), Valid: restoredFrom != 0},
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+// SelectAll returns the versions of the playlist from the latest, without their songs.
+func (v *PlaylistVersionRepository) SelectAll(ctx context.Context, playlistID int) ([]model.PlaylistVersion, error) {
+	var versionsOutDB []model.PlaylistVersionOutDB
+	err := v.db.SelectContext(
+		ctx,
+		&versionsOutDB,
+		`SELECT playlist_id, version, change, restored_from, playlist_name, playlist_description,
+			jsonb_array_length(songs) AS song_count, created_at, updated_at
+		FROM playlist_version
+		WHERE playlist_id = $1
+		ORDER BY version DESC`,
+		playlistID,
+	)
+	if err != nil {
+		return nil, &selectError{err}
+	}
+
+	versions := make([]model.PlaylistVersion, len(versionsOutDB))
+	for i, versionOutDB := range versionsOutDB {
+		versions[i], err = mapPlaylistVersionDBToAPI(versionOutDB)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return versions, nil
+}
+
+// Select returns the version of the playlist with its songs. The returned bool is false when it doesn't exist.
+func (v *PlaylistVersionRepository) Select(ctx context.Context, playlistID int, version int) (model.PlaylistVersion, bool, error) {
+	var versionOutDB model.PlaylistVersionOutDB
+	err := v.db.QueryRowxContext(
+		ctx,
+		`SELECT playlist_id, version, change, restored_from, playlist_name, playlist_description,
+			jsonb_array_length(songs) AS song_count, songs, created_at, updated_at
+		FROM playlist_version
+		WHERE playlist_id = $1 AND version = $2`,
+		playlistID,
+		version,
+	).StructScan(&versionOutDB)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.PlaylistVersion{}, false, nil
+	}
+	if err != nil {
+		return model.PlaylistVersion{}, false, &structScanError{err}
+	}
+
+	playlistVersion, err := mapPlaylistVersionDBToAPI(versionOutDB)
+	if err != nil {
+		return model.PlaylistVersion{}, false, err
+	}
+
+	return playlistVersion, true, nil
+}
+
+// Restore puts the playlist back to the metadata and songs of the version and records it as a new version.
+// Songs that are still in the playlist keep when they were added, the others get it back from the version.
+func (v *PlaylistVersionRepository) Restore(ctx context.Context, playlistVersion model.PlaylistVersion) error {
+	tx, err := v.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction restore playlist version: %v\n", err)
+		}
+	}()
+
+	playlistID := playlistVersion.PlaylistID
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE playlist SET playlist_name = $2, playlist_description = $3 WHERE playlist_id = $1",
+		playlistID,
+		playlistVersion.Name,
+		playlistVersion.PlaylistDescription,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	order, err := selectOrderedSongIDs(ctx, tx, playlistID)
+	if err != nil {
+		return err
+	}
+
+	newOrder := make([]int, len(playlistVersion.Songs))
+	inVersion := make(map[int]bool, len(playlistVersion.Songs))
+	for i, song := range playlistVersion.Songs {
+		newOrder[i] = song.SongID
+		inVersion[song.SongID] = true
+	}
+
+	inPlaylist := make(map[int]bool, len(order))
+	var removed []int
+	for _, songID := range order {
+		inPlaylist[songID] = true
+		if !inVersion[songID] {
+			removed = append(removed, songID)
+		}
+	}
+
+	if len(removed) > 0 {
+		query, args, err := sqlx.In("DELETE FROM playlist_song WHERE playlist_id = (?) AND song_id IN (?)", playlistID, removed)
+		if err != nil {
+			return fmt.Errorf("prepare delete songs in playlist query: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+		if err != nil {
+			return &execError{err}
+		}
+	}
+
+	// added_by is only restored for users that still exist
+	query := `INSERT INTO playlist_song (playlist_id, song_id, position, added_by, created_at)
+			SELECT v.playlist_id, v.song_id, v.position, u.user_id, v.created_at
+			FROM (VALUES %s) AS v(playlist_id, song_id, position, added_by, created_at)
+			LEFT JOIN app_user AS u ON u.user_id = v.added_by
+			ON CONFLICT DO NOTHING`
+
+	var valueStrings []string
+	var valueArgs []any
+	for index, song := range playlistVersion.Songs {
+		if inPlaylist[song.SongID] {
+			continue
+		}
+		valueStrings = append(valueStrings, "(?::INT, ?::INT, ?::INT, ?::TEXT, ?::TIMESTAMP)")
+		valueArgs = append(valueArgs, playlistID, song.SongID, index, song.AddedBy, song.AddedAt.UTC())
+	}
+
+	if len(valueStrings) > 0 {
+		query = sqlx.Rebind(
+			sqlx.DOLLAR,
+			fmt.Sprintf(query, strings.Join(valueStrings, ",")),
+		)
+
+		_, err = tx.ExecContext(ctx, query, valueArgs...)
+		if err != nil {
+			return &execError{err}
+		}
+	}
+
+	err = updatePositions(ctx, tx, playlistID, newOrder)
+	if err != nil {
+		return err
+	}
+
+	err = recordVersion(ctx, tx, playlistID, model.PlaylistChangeRestored, playlistVersion.Version)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &transactionCommitError{err}
+	}
+
+	return nil
+}
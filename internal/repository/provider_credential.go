@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tuannamnguyen/playlist-manager/internal/encryption"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"golang.org/x/oauth2"
+)
+
+// ProviderCredentialRepository stores the OAuth tokens of users, encrypted with cipher.
+type ProviderCredentialRepository struct {
+	db     *sqlx.DB
+	cipher *encryption.Cipher
+}
+
+func NewProviderCredentialRepository(db *sqlx.DB, cipher *encryption.Cipher) *ProviderCredentialRepository {
+	return &ProviderCredentialRepository{db: db, cipher: cipher}
+}
+
+// Select returns the credential of the user for the provider.
+// The returned bool is false when the user never logged in to the provider.
+func (r *ProviderCredentialRepository) Select(ctx context.Context, userID string, provider string) (model.ProviderCredential, bool, error) {
+	return r.selectCredential(ctx, r.db, "SELECT * FROM provider_credential WHERE user_id = $1 AND provider = $2", userID, provider)
+}
+
+// Refresh locks the credential of the user for the provider while refresh runs, so concurrent refreshes of the
+// same credential don't use a refresh token the provider already rotated. The token refresh returns is saved,
+// and when it returns nil the stored token is kept. Refresh returns the token of the credential afterwards.
+// The returned bool is false when the user never logged in to the provider.
+func (r *ProviderCredentialRepository) Refresh(
+	ctx context.Context,
+	userID string,
+	provider string,
+	refresh func(credential model.ProviderCredential) (*oauth2.Token, error),
+) (*oauth2.Token, bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, false, &beginTransactionError{err}
+	}
+	defer func() {
+		err = tx.Rollback()
+		if err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("error rolling back transaction refresh provider credential: %v\n", err)
+		}
+	}()
+
+	credential, found, err := r.selectCredential(
+		ctx,
+		tx,
+		"SELECT * FROM provider_credential WHERE user_id = $1 AND provider = $2 FOR UPDATE",
+		userID,
+		provider,
+	)
+	if err != nil || !found {
+		return nil, found, err
+	}
+
+	token, err := refresh(credential)
+	if err != nil {
+		return nil, true, err
+	}
+	if token == nil {
+		return credential.Token, true, nil
+	}
+
+	credential.Token = token
+	err = r.saveCredential(ctx, tx, credential)
+	if err != nil {
+		return nil, true, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, true, &transactionCommitError{err}
+	}
+
+	return token, true, nil
+}
+
+func (r *ProviderCredentialRepository) selectCredential(
+	ctx context.Context,
+	q sqlx.QueryerContext,
+	query string,
+	userID string,
+	provider string,
+) (model.ProviderCredential, bool, error) {
+	var credentialOutDB model.ProviderCredentialOutDB
+	err := q.QueryRowxContext(ctx, query, userID, provider).StructScan(&credentialOutDB)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.ProviderCredential{}, false, nil
+	}
+	if err != nil {
+		return model.ProviderCredential{}, false, &structScanError{err}
+	}
+
+	credential, err := r.mapCredentialDBToAPI(credentialOutDB.ProviderCredentialInDB)
+	if err != nil {
+		return model.ProviderCredential{}, false, err
+	}
+
+	return credential, true, nil
+}
+
+// SelectProviders returns the providers the user is logged in to.
+func (r *ProviderCredentialRepository) SelectProviders(ctx context.Context, userID string) ([]string, error) {
+	providers := []string{}
+	err := r.db.SelectContext(
+		ctx,
+		&providers,
+		"SELECT provider FROM provider_credential WHERE user_id = $1 ORDER BY provider",
+		userID,
+	)
+	if err != nil {
+		return nil, &selectError{err}
+	}
+
+	return providers, nil
+}
+
+// Save creates or replaces the credential of the user for the provider.
+func (r *ProviderCredentialRepository) Save(ctx context.Context, credential model.ProviderCredential) error {
+	return r.saveCredential(ctx, r.db, credential)
+}
+
+func (r *ProviderCredentialRepository) saveCredential(ctx context.Context, e sqlx.ExtContext, credential model.ProviderCredential) error {
+	credentialInDB, err := r.mapCredentialAPIToDB(credential)
+	if err != nil {
+		return err
+	}
+
+	_, err = sqlx.NamedExecContext(
+		ctx,
+		e,
+		`INSERT INTO provider_credential (user_id, provider, provider_user_id, access_token, refresh_token, expires_at)
+		VALUES (:user_id, :provider, :provider_user_id, :access_token, :refresh_token, :expires_at)
+		ON CONFLICT (user_id, provider) DO UPDATE
+		SET provider_user_id = EXCLUDED.provider_user_id,
+			access_token = EXCLUDED.access_token,
+			refresh_token = EXCLUDED.refresh_token,
+			expires_at = EXCLUDED.expires_at`,
+		credentialInDB,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+func (r *ProviderCredentialRepository) Delete(ctx context.Context, userID string, provider string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"DELETE FROM provider_credential WHERE user_id = $1 AND provider = $2",
+		userID,
+		provider,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/tuannamnguyen/playlist-manager/internal/model"
@@ -48,3 +49,35 @@ func (s *SongRepository) InsertAndGetID(ctx context.Context, song model.SongInDB
 
 	return lastInsertID, nil
 }
+
+// SelectWithIDs returns the songs with their album and artists, in no particular order.
+func (s *SongRepository) SelectWithIDs(ctx context.Context, songsID []int) ([]model.SongOutAPI, error) {
+	if len(songsID) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(
+		`SELECT s.song_id, s.song_name, s.image_url, s.duration, s.isrc, al.album_name, ar.artist_name, s.created_at, s.updated_at
+		FROM song AS s
+		JOIN album AS al
+		ON al.album_id = s.album_id
+		JOIN artist_song AS ars
+		ON s.song_id = ars.song_id
+		JOIN artist AS ar
+		ON ars.artist_id = ar.artist_id
+		WHERE s.song_id IN (?)
+		ORDER BY s.song_id, ars.artist_insertion_order`,
+		songsID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("prepare select songs query: %w", err)
+	}
+
+	var rows []model.SongOutDB
+	err = s.db.SelectContext(ctx, &rows, sqlx.Rebind(sqlx.DOLLAR, query), args...)
+	if err != nil {
+		return nil, &selectError{err}
+	}
+
+	return parsePlaylistSongData(rows), nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type UserRepository struct {
+	db *sqlx.DB
+}
+
+func NewUserRepository(db *sqlx.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// Insert creates the user, leaving an existing user with the same ID untouched.
+func (u *UserRepository) Insert(ctx context.Context, user model.UserInDB) error {
+	_, err := u.db.NamedExecContext(
+		ctx,
+		`INSERT INTO app_user (user_id, display_name, avatar_url)
+		VALUES (:user_id, :display_name, :avatar_url)
+		ON CONFLICT (user_id) DO NOTHING`,
+		user,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
+
+// SelectWithID returns the user. The returned bool is false when the user doesn't exist.
+func (u *UserRepository) SelectWithID(ctx context.Context, id string) (model.User, bool, error) {
+	var userOutDB model.UserOutDB
+	err := u.db.QueryRowxContext(ctx, "SELECT * FROM app_user WHERE user_id = $1", id).StructScan(&userOutDB)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.User{}, false, nil
+	}
+	if err != nil {
+		return model.User{}, false, &structScanError{err}
+	}
+
+	return model.User{
+		ID:          userOutDB.ID,
+		DisplayName: userOutDB.DisplayName,
+		AvatarURL:   userOutDB.AvatarURL.String,
+		Timestamp:   userOutDB.Timestamp,
+	}, true, nil
+}
+
+// Update changes the given profile fields, leaving nil fields untouched. An empty avatar URL removes the avatar.
+func (u *UserRepository) Update(ctx context.Context, id string, user model.UserUpdate) error {
+	_, err := u.db.ExecContext(
+		ctx,
+		`UPDATE app_user
+		SET display_name = COALESCE($1, display_name),
+			avatar_url = CASE WHEN $2::TEXT IS NULL THEN avatar_url ELSE NULLIF($2, '') END
+		WHERE user_id = $3`,
+		user.DisplayName,
+		user.AvatarURL,
+		id,
+	)
+	if err != nil {
+		return &execError{err}
+	}
+
+	return nil
+}
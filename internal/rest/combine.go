@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type PlaylistCombiner interface {
+	Combine(ctx context.Context, userID string, combineIn model.PlaylistCombineIn) (model.Playlist, error)
+}
+
+type CombineHandler struct {
+	service   PlaylistCombiner
+	playlists PlaylistRoleChecker
+}
+
+func NewCombineHandler(svc PlaylistCombiner, playlists PlaylistRoleChecker) *CombineHandler {
+	return &CombineHandler{
+		service:   svc,
+		playlists: playlists,
+	}
+}
+
+// Combine writes the union, intersection, difference or symmetric difference of the songs of playlists
+// to a new playlist, or to a playlist the user can edit.
+func (h *CombineHandler) Combine(c echo.Context) error {
+	var combineIn model.PlaylistCombineIn
+	err := c.Bind(&combineIn)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(combineIn); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	for _, playlistID := range combineIn.SourceIDs {
+		if err := checkPlaylistRole(c, h.playlists, playlistID, model.PlaylistRoleViewer); err != nil {
+			return err
+		}
+	}
+
+	status := http.StatusCreated
+	if combineIn.TargetID != 0 {
+		if err := checkPlaylistRole(c, h.playlists, combineIn.TargetID, model.PlaylistRoleEditor); err != nil {
+			return err
+		}
+		status = http.StatusOK
+	}
+
+	playlist, err := h.service.Combine(c.Request().Context(), userID, combineIn)
+	if errors.Is(err, model.ErrPlaylistNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return playlistSongsHTTPError(err)
+	}
+
+	return c.JSON(status, playlist)
+}
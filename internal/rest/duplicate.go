@@ -0,0 +1,104 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type DuplicateService interface {
+	FindInPlaylist(ctx context.Context, playlistID int, query model.DuplicateQuery) ([]model.DuplicateGroup, error)
+	FindAcrossPlaylists(ctx context.Context, userID string, query model.DuplicateQuery) ([]model.DuplicateGroup, error)
+	Dedupe(ctx context.Context, playlistID int, query model.DuplicateQuery) (model.DedupeResult, error)
+}
+
+type DuplicateHandler struct {
+	service DuplicateService
+}
+
+func NewDuplicateHandler(svc DuplicateService) *DuplicateHandler {
+	return &DuplicateHandler{
+		service: svc,
+	}
+}
+
+// GetInPlaylist returns the versions of the same songs in the playlist.
+func (d *DuplicateHandler) GetInPlaylist(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	query, err := bindDuplicateQuery(c)
+	if err != nil {
+		return err
+	}
+
+	groups, err := d.service.FindInPlaylist(c.Request().Context(), playlistID, query)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, groups)
+}
+
+// GetAcrossPlaylists returns the different versions of the same songs in the playlists of the user.
+func (d *DuplicateHandler) GetAcrossPlaylists(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	query, err := bindDuplicateQuery(c)
+	if err != nil {
+		return err
+	}
+
+	groups, err := d.service.FindAcrossPlaylists(c.Request().Context(), userID, query)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, groups)
+}
+
+// Dedupe keeps only the preferred version of every song in the playlist.
+func (d *DuplicateHandler) Dedupe(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	query, err := bindDuplicateQuery(c)
+	if err != nil {
+		return err
+	}
+
+	result, err := d.service.Dedupe(c.Request().Context(), playlistID, query)
+	if err != nil {
+		return playlistSongsHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+func bindDuplicateQuery(c echo.Context) (model.DuplicateQuery, error) {
+	query := model.DuplicateQuery{
+		Tolerance: model.DefaultDuplicateTolerance,
+		Prefer:    model.DuplicatePreferAlbum,
+	}
+
+	err := (&echo.DefaultBinder{}).BindQueryParams(c, &query)
+	if err != nil {
+		return model.DuplicateQuery{}, echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(query); err != nil {
+		return model.DuplicateQuery{}, echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	return query, nil
+}
@@ -1,24 +1,33 @@
 package rest
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/gorilla/sessions"
 	"github.com/labstack/echo/v4"
-	"github.com/markbates/goth"
 	"github.com/tuannamnguyen/playlist-manager/internal/model"
-	"golang.org/x/oauth2"
+	"github.com/tuannamnguyen/playlist-manager/internal/rest/middleware"
 )
 
+const userIDSessionKey = "user_id"
+
 func saveOauthSessionValues(req *http.Request, res http.ResponseWriter, store sessions.Store, sessionValues map[any]any) error {
 	session, err := store.Get(req, "oauth-session")
 	if err != nil {
 		return err
 	}
 
-	session.Values = sessionValues
+	// values of the other providers the user is logged in to are kept
+	for key, value := range sessionValues {
+		session.Values[key] = value
+	}
 
 	err = session.Save(req, res)
 	if err != nil {
@@ -39,6 +48,38 @@ func getOauthSessionValues(req *http.Request, store sessions.Store) (map[any]any
 	return session.Values, nil
 }
 
+// getUserID returns the subject of the request token, which identifies the user.
+func getUserID(c echo.Context) (string, error) {
+	userID, _, ok := middleware.User(c.Request().Context())
+	if !ok {
+		return "", echo.NewHTTPError(http.StatusUnauthorized, "no user logged in")
+	}
+
+	return userID, nil
+}
+
+// checkPlaylistRole stops users without the role on the playlist from acting on it, unless they are admins.
+func checkPlaylistRole(c echo.Context, playlists PlaylistRoleChecker, playlistID int, role model.PlaylistRole) error {
+	userID, claims, ok := middleware.User(c.Request().Context())
+	if !ok {
+		return echo.NewHTTPError(http.StatusUnauthorized, "no user logged in")
+	}
+
+	err := playlists.CheckRole(c.Request().Context(), playlistID, userID, role)
+	switch {
+	case errors.Is(err, model.ErrPlaylistNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, model.ErrPlaylistForbidden) && claims.HasScope(middleware.ScopeAdmin):
+		return nil
+	case errors.Is(err, model.ErrPlaylistForbidden):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return nil
+}
+
 func getProvider(c echo.Context) (string, error) {
 	var providerParam model.ProviderParam
 	err := c.Bind(&providerParam)
@@ -55,32 +96,127 @@ func addQueryParams(c echo.Context, provider string) {
 	c.Request().URL.RawQuery = q.Encode()
 }
 
+func getProviderInfo(providers ProviderRegistry, provider string) (model.ProviderInfo, error) {
+	info, ok := providers.Get(provider)
+	if !ok {
+		return model.ProviderInfo{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("unknown provider %s", provider))
+	}
+
+	return info, nil
+}
+
+func checkProviderCanImport(providers ProviderRegistry, provider string) error {
+	info, err := getProviderInfo(providers, provider)
+	if err != nil {
+		return err
+	}
+
+	if !info.Capabilities.Import {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("importing from %s is not supported", provider))
+	}
+
+	return nil
+}
+
+// getProviderMetadata collects what the provider needs to act on behalf of the user: the user whose stored
+// credentials OAuth providers use, and the provider metadata fields from the request body or their header.
 func getProviderMetadata(
+	c echo.Context,
+	providers ProviderRegistry,
 	provider string,
-	sessionValues map[any]any,
-	reqBody model.ConverterRequestData,
-) (providerMetadata model.ConverterServiceProviderMetadata) {
-	switch provider {
-	case "spotify":
-		user := (sessionValues[fmt.Sprintf("%s_user_info", provider)]).(goth.User)
-		token := &oauth2.Token{
-			AccessToken:  user.AccessToken,
-			RefreshToken: user.RefreshToken,
-			Expiry:       user.ExpiresAt,
+	reqMetadata model.ConverterProviderMetadata,
+) (model.ConverterServiceProviderMetadata, error) {
+	info, err := getProviderInfo(providers, provider)
+	if err != nil {
+		return model.ConverterServiceProviderMetadata{}, err
+	}
+
+	var providerMetadata model.ConverterServiceProviderMetadata
+
+	if info.Auth == model.ProviderAuthOAuth {
+		providerMetadata.UserID, err = getUserID(c)
+		if err != nil {
+			return model.ConverterServiceProviderMetadata{}, err
+		}
+
+		// the token is only checked here: it's looked up again, and refreshed if needed, when the provider is used
+		_, err := providers.Authorize(c.Request().Context(), provider, providerMetadata)
+		if errors.Is(err, model.ErrProviderNotConnected) {
+			return model.ConverterServiceProviderMetadata{}, echo.NewHTTPError(http.StatusUnauthorized, fmt.Sprintf("not authenticated with %s", provider))
 		}
-		providerMetadata = model.ConverterServiceProviderMetadata{
-			Spotify: model.SpotifyMetadata{
-				Token: token,
-			},
+		if err != nil {
+			return model.ConverterServiceProviderMetadata{}, echo.NewHTTPError(http.StatusInternalServerError, err)
 		}
+	}
 
-	case "applemusic":
-		providerMetadata = model.ConverterServiceProviderMetadata{
-			AppleMusic: model.AppleMusicMetadata{
-				MusicUserToken: reqBody.ProviderMetadata.AppleMusic.MusicUserToken,
-			},
+	providerMetadata.Values = make(map[string]string, len(info.Metadata))
+	for _, field := range info.Metadata {
+		value := reqMetadata[provider][field.Name]
+		if value == "" && field.Header != "" {
+			value = c.Request().Header.Get(field.Header)
 		}
+
+		if value == "" {
+			if field.Required {
+				return model.ConverterServiceProviderMetadata{}, echo.NewHTTPError(
+					http.StatusBadRequest,
+					fmt.Sprintf("missing provider metadata %s.%s", provider, field.Name),
+				)
+			}
+			continue
+		}
+
+		providerMetadata.Values[field.Name] = value
+	}
+
+	return providerMetadata, nil
+}
+
+func openPlaylistCoverImage(header *multipart.FileHeader) (multipart.File, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	buff := make([]byte, 512)
+	if _, err := file.Read(buff); err != nil {
+		file.Close()
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	fileType := http.DetectContentType(buff)
+	log.Println(fileType)
+
+	if fileType != "image/jpeg" && fileType != "image/png" {
+		file.Close()
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "invalid file type for playlist cover")
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return file, nil
+}
+
+// formatDuration writes a song duration in milliseconds as minutes and seconds.
+func formatDuration(durationMs int) string {
+	seconds := durationMs / 1000
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// shareTokenFromURL returns the token of a share page URL.
+func shareTokenFromURL(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false
+	}
+
+	token, ok := strings.CutPrefix(u.Path, sharePagePath)
+	if !ok || token == "" || strings.Contains(token, "/") {
+		return "", false
 	}
 
-	return providerMetadata
+	return token, true
 }
@@ -0,0 +1,159 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type ConversionJobService interface {
+	Enqueue(ctx context.Context, playlistID int, provider string, providerMetadata model.ConverterServiceProviderMetadata, playlistName string, selections map[int]string) (model.ConversionJob, error)
+	Sync(ctx context.Context, playlistID int, provider string, providerMetadata model.ConverterServiceProviderMetadata) (model.ConversionJob, error)
+	Preview(ctx context.Context, playlistID int, provider string, providerMetadata model.ConverterServiceProviderMetadata, limit int) (model.ConversionPreview, error)
+	GetByID(ctx context.Context, id int) (model.ConversionJob, error)
+}
+
+type ConversionJobHandler struct {
+	service      ConversionJobService
+	sessionStore sessions.Store
+	providers    ProviderRegistry
+	playlists    PlaylistRoleChecker
+}
+
+func NewConversionJobHandler(
+	svc ConversionJobService,
+	store sessions.Store,
+	providers ProviderRegistry,
+	playlists PlaylistRoleChecker,
+) *ConversionJobHandler {
+	return &ConversionJobHandler{
+		service:      svc,
+		sessionStore: store,
+		providers:    providers,
+		playlists:    playlists,
+	}
+}
+
+func (j *ConversionJobHandler) ConvertHandler(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	type QueryParams struct {
+		Preview    bool `query:"preview"`
+		Candidates int  `query:"candidates" validate:"omitempty,min=1,max=10"`
+	}
+	var qParams QueryParams
+
+	err = (&echo.DefaultBinder{}).BindQueryParams(c, &qParams)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(qParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	var reqBody model.ConverterRequestData
+	err = c.Bind(&reqBody)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	// a preview doesn't create a playlist so it doesn't need a playlist name
+	if qParams.Preview {
+		err = c.Validate(reqBody.ProviderParam)
+	} else {
+		err = c.Validate(reqBody)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	provider := reqBody.Provider
+	providerMetadata, err := getProviderMetadata(c, j.providers, provider, reqBody.ProviderMetadata)
+	if err != nil {
+		return err
+	}
+
+	if qParams.Preview {
+		if qParams.Candidates == 0 {
+			qParams.Candidates = 3
+		}
+
+		preview, err := j.service.Preview(c.Request().Context(), playlistID, provider, providerMetadata, qParams.Candidates)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+
+		return c.JSON(http.StatusOK, preview)
+	}
+
+	job, err := j.service.Enqueue(c.Request().Context(), playlistID, provider, providerMetadata, reqBody.PlaylistName, reqBody.Selections)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// SyncHandler queues a job that updates the remote playlist the playlist was exported to.
+func (j *ConversionJobHandler) SyncHandler(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	var reqBody model.SyncRequestData
+	err = c.Bind(&reqBody)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := c.Validate(reqBody); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	provider := reqBody.Provider
+	providerMetadata, err := getProviderMetadata(c, j.providers, provider, reqBody.ProviderMetadata)
+	if err != nil {
+		return err
+	}
+
+	job, err := j.service.Sync(c.Request().Context(), playlistID, provider, providerMetadata)
+	if errors.Is(err, model.ErrRemoteLinkNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusAccepted, job)
+}
+
+func (j *ConversionJobHandler) GetByID(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	job, err := j.service.GetByID(c.Request().Context(), id)
+	if errors.Is(err, model.ErrJobNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := checkPlaylistRole(c, j.playlists, job.PlaylistID, model.PlaylistRoleViewer); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
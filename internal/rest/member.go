@@ -0,0 +1,191 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+// PlaylistRoleChecker returns model.ErrPlaylistNotFound or model.ErrPlaylistForbidden
+// when the user doesn't have the role on the playlist.
+type PlaylistRoleChecker interface {
+	CheckRole(ctx context.Context, playlistID int, userID string, role model.PlaylistRole) error
+}
+
+type MemberService interface {
+	PlaylistRoleChecker
+
+	GetAll(ctx context.Context, playlistID int) ([]model.PlaylistMember, error)
+	UpdateRole(ctx context.Context, playlistID int, userID string, role model.PlaylistRole) error
+	Remove(ctx context.Context, playlistID int, userID string) error
+	Invite(ctx context.Context, playlistID int, createdBy string, inviteIn model.PlaylistInviteIn) (model.PlaylistInvite, error)
+	RevokeInvite(ctx context.Context, playlistID int, token string) error
+	AcceptInvite(ctx context.Context, token string, userID string) (model.PlaylistInvite, error)
+}
+
+type MemberHandler struct {
+	service MemberService
+}
+
+func NewMemberHandler(svc MemberService) *MemberHandler {
+	return &MemberHandler{
+		service: svc,
+	}
+}
+
+// RequireRole only lets the members with the role on the playlist in the :id or :playlist_id path param through.
+func (m *MemberHandler) RequireRole(role model.PlaylistRole) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			param := c.Param("playlist_id")
+			if param == "" {
+				param = c.Param("id")
+			}
+
+			playlistID, err := strconv.Atoi(param)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid playlist id")
+			}
+
+			if err := checkPlaylistRole(c, m.service, playlistID, role); err != nil {
+				return err
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func (m *MemberHandler) GetAll(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	members, err := m.service.GetAll(c.Request().Context(), playlistID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, members)
+}
+
+func (m *MemberHandler) UpdateRole(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	var memberUpdate model.PlaylistMemberUpdate
+	err = c.Bind(&memberUpdate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(memberUpdate); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	err = m.service.UpdateRole(c.Request().Context(), playlistID, c.Param("user_id"), memberUpdate.Role)
+	if err := memberHTTPError(err); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, memberUpdate)
+}
+
+func (m *MemberHandler) Remove(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	err = m.service.Remove(c.Request().Context(), playlistID, c.Param("user_id"))
+	if err := memberHTTPError(err); err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Invite creates an invite link token for the playlist.
+func (m *MemberHandler) Invite(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	var inviteIn model.PlaylistInviteIn
+	err = c.Bind(&inviteIn)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(inviteIn); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	invite, err := m.service.Invite(c.Request().Context(), playlistID, userID, inviteIn)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, invite)
+}
+
+func (m *MemberHandler) RevokeInvite(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	err = m.service.RevokeInvite(c.Request().Context(), playlistID, c.Param("token"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// AcceptInvite makes the user a member of the playlist of the invite.
+func (m *MemberHandler) AcceptInvite(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	invite, err := m.service.AcceptInvite(c.Request().Context(), c.Param("token"), userID)
+	if errors.Is(err, model.ErrInviteNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"playlist_id": invite.PlaylistID,
+		"role":        invite.Role,
+	})
+}
+
+func memberHTTPError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, model.ErrPlaylistNotFound), errors.Is(err, model.ErrMemberNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, model.ErrOwnerRoleReserved):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+}
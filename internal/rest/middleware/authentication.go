@@ -1,13 +1,21 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 
-	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
-	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/labstack/echo/v4"
 )
 
+// Scopes the API checks in access tokens.
+const (
+	ScopePlaylistsRead    = "playlists:read"
+	ScopePlaylistsWrite   = "playlists:write"
+	ScopePlaylistsConvert = "playlists:convert"
+	// ScopeAdmin grants every other scope and access to the playlists of every user
+	ScopeAdmin = "admin"
+)
+
 type ScopeValidator struct {
 	Scopes []string
 }
@@ -16,16 +24,25 @@ func NewScopeValidator(scopes ...string) *ScopeValidator {
 	return &ScopeValidator{Scopes: scopes}
 }
 
+// RequireScopes only lets requests through when their token has every scope.
+func RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return NewScopeValidator(scopes...).CheckTokenHasScopes
+}
+
 func (v *ScopeValidator) CheckTokenHasScopes(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		token := c.Request().Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+		_, claims, ok := User(c.Request().Context())
+		if !ok {
+			return echo.NewHTTPError(http.StatusUnauthorized, "no user logged in")
+		}
+
+		if claims.HasScope(ScopeAdmin) {
+			return next(c)
+		}
 
-		claims := token.CustomClaims.(*CustomClaims)
 		for _, scope := range v.Scopes {
 			if !claims.HasScope(scope) {
-				return c.JSON(http.StatusForbidden, map[string]string{
-					"message": "Insufficient scope.",
-				})
+				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("missing scope %s", scope))
 			}
 		}
 
@@ -15,11 +15,16 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-var EnsureValidTokenMiddleware = echo.WrapMiddleware(EnsureValidToken())
+// EnsureValidTokenMiddleware is built when it's used, as the Auth0 settings are only loaded from .env at startup.
+func EnsureValidTokenMiddleware() echo.MiddlewareFunc {
+	return echo.WrapMiddleware(EnsureValidToken())
+}
 
 // CustomClaims contains custom data we want from the token.
 type CustomClaims struct {
-	Scope string `json:"scope"`
+	Scope   string `json:"scope"`
+	Name    string `json:"name"`
+	Picture string `json:"picture"`
 }
 
 // Validate does nothing for this example, but we need
@@ -45,13 +50,18 @@ func EnsureValidToken() func(next http.Handler) http.Handler {
 		log.Fatalf("Failed to parse the issuer url: %v", err)
 	}
 
+	return ensureValidToken(issuerUrl, os.Getenv("AUTH0_AUDIENCE"))
+}
+
+// ensureValidToken validates tokens signed with the keys the issuer publishes at its JWKS endpoint.
+func ensureValidToken(issuerUrl *url.URL, audience string) func(next http.Handler) http.Handler {
 	provider := jwks.NewCachingProvider(issuerUrl, 5*time.Minute)
 
 	jwtValidator, err := validator.New(
 		provider.KeyFunc,
 		validator.RS256,
 		issuerUrl.String(),
-		[]string{os.Getenv("AUTH0_AUDIENCE")},
+		[]string{audience},
 		validator.WithCustomClaims(
 			func() validator.CustomClaims {
 				return &CustomClaims{}
@@ -83,3 +93,18 @@ func EnsureValidToken() func(next http.Handler) http.Handler {
 		return middleware.CheckJWT(next)
 	}
 }
+
+// User returns the subject and custom claims of the token validated for the request.
+func User(ctx context.Context) (string, *CustomClaims, bool) {
+	claims, ok := ctx.Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims)
+	if !ok || claims.RegisteredClaims.Subject == "" {
+		return "", nil, false
+	}
+
+	customClaims, ok := claims.CustomClaims.(*CustomClaims)
+	if !ok {
+		customClaims = &CustomClaims{}
+	}
+
+	return claims.RegisteredClaims.Subject, customClaims, true
+}
@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/go-jose/go-jose.v2"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
+)
+
+const testAudience = "playlist-manager-test"
+
+// jwksStandIn publishes a signing key the way Auth0 does, so tokens can be signed locally.
+type jwksStandIn struct {
+	server *httptest.Server
+	signer jose.Signer
+}
+
+func newJWKSStandIn(t *testing.T) *jwksStandIn {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test-key"),
+	)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   server.URL + "/",
+			"jwks_uri": server.URL + "/.well-known/jwks.json",
+		})
+	})
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "test-key", Algorithm: "RS256", Use: "sig"}},
+		})
+	})
+
+	return &jwksStandIn{server: server, signer: signer}
+}
+
+func (j *jwksStandIn) issuer(t *testing.T) *url.URL {
+	issuerURL, err := url.Parse(j.server.URL + "/")
+	require.NoError(t, err)
+	return issuerURL
+}
+
+func (j *jwksStandIn) token(t *testing.T, claims jwt.Claims, scope string) string {
+	token, err := jwt.Signed(j.signer).
+		Claims(claims).
+		Claims(map[string]any{"scope": scope}).
+		CompactSerialize()
+	require.NoError(t, err)
+	return token
+}
+
+func TestAuthorization(t *testing.T) {
+	jwks := newJWKSStandIn(t)
+
+	e := echo.New()
+	api := e.Group("/api", echo.WrapMiddleware(ensureValidToken(jwks.issuer(t), testAudience)))
+	ok := func(c echo.Context) error {
+		userID, _, _ := User(c.Request().Context())
+		return c.String(http.StatusOK, userID)
+	}
+	api.GET("/playlists", ok, RequireScopes(ScopePlaylistsRead))
+	api.POST("/playlists", ok, RequireScopes(ScopePlaylistsWrite))
+	api.POST("/playlists/import", ok, RequireScopes(ScopePlaylistsConvert, ScopePlaylistsWrite))
+
+	now := time.Now()
+	validClaims := jwt.Claims{
+		Subject:  "auth0|user",
+		Issuer:   jwks.server.URL + "/",
+		Audience: jwt.Audience{testAudience},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+	expiredClaims := validClaims
+	expiredClaims.Expiry = jwt.NewNumericDate(now.Add(-time.Hour))
+	otherAudienceClaims := validClaims
+	otherAudienceClaims.Audience = jwt.Audience{"other-api"}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		token       string
+		wantStatus  int
+		wantMessage string
+	}{
+		{
+			name:       "no token",
+			method:     http.MethodGet,
+			path:       "/api/playlists",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "expired token",
+			method:     http.MethodGet,
+			path:       "/api/playlists",
+			token:      jwks.token(t, expiredClaims, ScopePlaylistsRead),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "token for another API",
+			method:     http.MethodGet,
+			path:       "/api/playlists",
+			token:      jwks.token(t, otherAudienceClaims, ScopePlaylistsRead),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "scope granted",
+			method:     http.MethodGet,
+			path:       "/api/playlists",
+			token:      jwks.token(t, validClaims, ScopePlaylistsRead),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:        "scope missing",
+			method:      http.MethodPost,
+			path:        "/api/playlists",
+			token:       jwks.token(t, validClaims, ScopePlaylistsRead),
+			wantStatus:  http.StatusForbidden,
+			wantMessage: "missing scope playlists:write",
+		},
+		{
+			name:        "one of several scopes missing",
+			method:      http.MethodPost,
+			path:        "/api/playlists/import",
+			token:       jwks.token(t, validClaims, ScopePlaylistsConvert),
+			wantStatus:  http.StatusForbidden,
+			wantMessage: "missing scope playlists:write",
+		},
+		{
+			name:       "all scopes granted",
+			method:     http.MethodPost,
+			path:       "/api/playlists/import",
+			token:      jwks.token(t, validClaims, ScopePlaylistsConvert+" "+ScopePlaylistsWrite),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "admin has every scope",
+			method:     http.MethodPost,
+			path:       "/api/playlists/import",
+			token:      jwks.token(t, validClaims, ScopeAdmin),
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, validClaims.Subject, rec.Body.String())
+			}
+			if tt.wantMessage != "" {
+				var body map[string]string
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+				assert.Equal(t, tt.wantMessage, body["message"])
+			}
+		})
+	}
+}
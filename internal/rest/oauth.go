@@ -1,6 +1,8 @@
 package rest
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,24 +12,56 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/markbates/goth"
 	"github.com/markbates/goth/gothic"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"golang.org/x/oauth2"
 )
 
+type CredentialService interface {
+	Connect(ctx context.Context, userID string, user goth.User) error
+	Disconnect(ctx context.Context, userID string, provider string) error
+	ConnectedProviders(ctx context.Context, userID string) ([]string, error)
+	Token(ctx context.Context, userID string, provider string) (*oauth2.Token, error)
+}
+
 type OAuthHandler struct {
+	credentials  CredentialService
 	sessionStore sessions.Store
 }
 
-func NewOAuthHandler(store sessions.Store) *OAuthHandler {
+func NewOAuthHandler(credentials CredentialService, store sessions.Store) *OAuthHandler {
 	return &OAuthHandler{
+		credentials:  credentials,
 		sessionStore: store,
 	}
 }
 
+// SessionHandler remembers the user of the request token in the session, so the provider login,
+// which is a browser redirect without the token, knows who to connect the provider to.
+func (o *OAuthHandler) SessionHandler(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = saveOauthSessionValues(c.Request(), c.Response(), o.sessionStore, map[any]any{userIDSessionKey: userID})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("error saving session values: %w", err))
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LoginHandler redirects to the provider login for the user remembered by SessionHandler.
 func (o *OAuthHandler) LoginHandler(c echo.Context) error {
 	provider, err := getProvider(c)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err)
 	}
 
+	if _, err := o.getSessionUserID(c); err != nil {
+		return err
+	}
+
 	addQueryParams(c, provider)
 
 	gothic.BeginAuthHandler(c.Response(), c.Request())
@@ -45,19 +79,19 @@ func (o *OAuthHandler) CallbackHandler(c echo.Context) error {
 
 	addQueryParams(c, provider)
 
+	userID, err := o.getSessionUserID(c)
+	if err != nil {
+		return err
+	}
+
 	user, err := gothic.CompleteUserAuth(c.Response(), c.Request())
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("error complete user auth: %w", err))
 	}
 
-	sessionValues := make(map[any]any)
-	sessionValues[fmt.Sprintf("%s_user_info", provider)] = user
-
-	store := o.sessionStore
-
-	err = saveOauthSessionValues(c.Request(), c.Response(), store, sessionValues)
+	err = o.credentials.Connect(c.Request().Context(), userID, user)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("error saving session values: %w", err))
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("error saving %s credentials: %w", provider, err))
 	}
 
 	return c.Redirect(http.StatusTemporaryRedirect, os.Getenv("FRONTEND_URL"))
@@ -69,22 +103,37 @@ func (o *OAuthHandler) CheckAuthHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err)
 	}
 
-	addQueryParams(c, provider)
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
 
-	sessionValues, err := getOauthSessionValues(c.Request(), o.sessionStore)
+	_, err = o.credentials.Token(c.Request().Context(), userID, provider)
+	if errors.Is(err, model.ErrProviderNotConnected) {
+		return c.String(http.StatusUnauthorized, fmt.Sprintf("not authenticated with %s", provider))
+	}
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("error getting session values: %v", err))
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	userInfo, ok := sessionValues[fmt.Sprintf("%s_user_info", provider)]
-	if ok {
-		user := userInfo.(goth.User)
-		log.Printf("user logged in. email: %s, name: %s, provider: %s", user.Email, user.Name, user.Provider)
+	return c.String(http.StatusOK, fmt.Sprintf("user has authenticated with %s", provider))
+}
+
+// ConnectionsHandler returns the providers the user is logged in to.
+func (o *OAuthHandler) ConnectionsHandler(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
 
-		return c.String(http.StatusOK, fmt.Sprintf("user has authenticated with %s", provider))
+	providers, err := o.credentials.ConnectedProviders(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	return c.String(http.StatusUnauthorized, fmt.Sprintf("not authenticated with %s", provider))
+	return c.JSON(http.StatusOK, map[string][]string{
+		"providers": providers,
+	})
 }
 
 func (o *OAuthHandler) LogoutHandler(c echo.Context) error {
@@ -95,6 +144,16 @@ func (o *OAuthHandler) LogoutHandler(c echo.Context) error {
 
 	addQueryParams(c, provider)
 
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = o.credentials.Disconnect(c.Request().Context(), userID, provider)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("error deleting %s credentials: %w", provider, err))
+	}
+
 	err = gothic.Logout(c.Response(), c.Request())
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("error logging out from %v: %v", provider, err))
@@ -109,16 +168,34 @@ func (o *OAuthHandler) GetAccessTokenHandler(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, err)
 	}
 
-	addQueryParams(c, provider)
-
-	sessionValues, err := getOauthSessionValues(c.Request(), o.sessionStore)
+	userID, err := getUserID(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("error getting session values: %v", err))
+		return err
 	}
 
-	user := sessionValues[fmt.Sprintf("%s_user_info", provider)].(goth.User)
+	token, err := o.credentials.Token(c.Request().Context(), userID, provider)
+	if errors.Is(err, model.ErrProviderNotConnected) {
+		return echo.NewHTTPError(http.StatusUnauthorized, fmt.Sprintf("not authenticated with %s", provider))
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
 
 	return c.JSON(http.StatusOK, map[string]string{
-		"access_token": user.AccessToken,
+		"access_token": token.AccessToken,
 	})
 }
+
+func (o *OAuthHandler) getSessionUserID(c echo.Context) (string, error) {
+	sessionValues, err := getOauthSessionValues(c.Request(), o.sessionStore)
+	if err != nil {
+		return "", echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("error getting session values: %v", err))
+	}
+
+	userID, ok := sessionValues[userIDSessionKey].(string)
+	if !ok || userID == "" {
+		return "", echo.NewHTTPError(http.StatusUnauthorized, "no user logged in")
+	}
+
+	return userID, nil
+}
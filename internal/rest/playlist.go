@@ -3,6 +3,8 @@ package rest
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"mime/multipart"
@@ -21,14 +23,22 @@ type PlaylistService interface {
 	GetAll(ctx context.Context, userID string) ([]model.Playlist, error)
 	GetByID(ctx context.Context, id int) (model.Playlist, error)
 	DeleteByID(ctx context.Context, id int) error
+	Duplicate(ctx context.Context, id int, userID string, duplicateIn model.PlaylistDuplicateIn) (model.Playlist, error)
+	Update(ctx context.Context, id int, playlistModel model.PlaylistUpdate, imageFile multipart.File, imageHeader *multipart.FileHeader) (model.Playlist, error)
+	UpdateSmartRules(ctx context.Context, id int, userID string, rules model.SmartPlaylistRules) (model.Playlist, error)
+	Freeze(ctx context.Context, id int, userID string) (model.Playlist, error)
 
 	// playlist-song operations
-	AddSongsToPlaylist(ctx context.Context, playlistID int, songs []model.SongInAPI) error
+	AddSongsToPlaylist(ctx context.Context, playlistID int, songs []model.SongInAPI, addedBy string) error
+	AddSongsToPlaylistAt(ctx context.Context, playlistID int, songs []model.SongInAPI, position int, addedBy string) error
 	GetAllSongsFromPlaylist(ctx context.Context, playlistID int, sortBy string, sortOrder string) ([]model.SongOutAPI, error)
 	DeleteSongsFromPlaylist(ctx context.Context, playlistID int, songsID []int) error
+	MoveSongsInPlaylist(ctx context.Context, playlistID int, rangeStart int, rangeLength int, insertBefore int) error
+	ReorderSongsInPlaylist(ctx context.Context, playlistID int, songsID []int) error
 
-	// convert operation
-	Convert(ctx context.Context, provider string, providerMetadata model.ConverterServiceProviderMetadata, playlistName string, songs []model.SongOutAPI) error
+	// import operation
+	ListRemotePlaylists(ctx context.Context, provider string, providerMetadata model.ConverterServiceProviderMetadata) ([]model.RemotePlaylist, error)
+	Import(ctx context.Context, provider string, providerMetadata model.ConverterServiceProviderMetadata, remotePlaylistID string, playlistModel model.PlaylistIn) (model.Playlist, error)
 
 	// csv
 	ConvertSongsToCsv(songs []model.SongOutAPI) (bytes.Buffer, error)
@@ -38,21 +48,35 @@ type PlaylistService interface {
 type PlaylistHandler struct {
 	service      PlaylistService
 	sessionStore sessions.Store
+	providers    ProviderRegistry
 }
 
-func NewPlaylistHandler(svc PlaylistService, store sessions.Store) *PlaylistHandler {
+func NewPlaylistHandler(svc PlaylistService, store sessions.Store, providers ProviderRegistry) *PlaylistHandler {
 	return &PlaylistHandler{
 		service:      svc,
 		sessionStore: store,
+		providers:    providers,
 	}
 }
 
 func (p *PlaylistHandler) Add(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
 	playlist := model.PlaylistIn{
 		Name:                c.FormValue("playlist_name"),
 		PlaylistDescription: c.FormValue("playlist_description"),
-		UserID:              c.FormValue("user_id"),
-		Username:            c.FormValue("user_name"),
+		UserID:              userID,
+	}
+
+	// the playlist is a smart playlist when the form has its rules as JSON
+	if smartRules := c.FormValue("smart_rules"); smartRules != "" {
+		playlist.SmartRules = &model.SmartPlaylistRules{}
+		if err := json.Unmarshal([]byte(smartRules), playlist.SmartRules); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "smart_rules must be JSON")
+		}
 	}
 
 	if err := c.Validate(playlist); err != nil {
@@ -64,29 +88,19 @@ func (p *PlaylistHandler) Add(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	file, err := header.Open()
+	file, err := openPlaylistCoverImage(header)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
 	}
 	defer file.Close()
 
-	buff := make([]byte, 512)
-	if _, err := file.Read(buff); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
-	}
-
-	fileType := http.DetectContentType(buff)
-	log.Println(fileType)
-
-	if fileType != "image/jpeg" && fileType != "image/png" {
-		return echo.NewHTTPError(http.StatusBadRequest, "invalid file type for playlist cover")
+	err = p.service.Add(c.Request().Context(), playlist, file, header)
+	if errors.Is(err, model.ErrInvalidSmartRules) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
-
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	if errors.Is(err, model.ErrPlaylistForbidden) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
 	}
-
-	err = p.service.Add(c.Request().Context(), playlist, file, header)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
@@ -95,7 +109,10 @@ func (p *PlaylistHandler) Add(c echo.Context) error {
 }
 
 func (p *PlaylistHandler) GetAll(c echo.Context) error {
-	userID := c.QueryParam("user_id")
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
 
 	playlists, err := p.service.GetAll(c.Request().Context(), userID)
 	if err != nil {
@@ -135,21 +152,181 @@ func (p *PlaylistHandler) DeleteByID(c echo.Context) error {
 	})
 }
 
+// Duplicate copies the playlist to a new playlist of the user, which remembers where it was forked from.
+func (p *PlaylistHandler) Duplicate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	var duplicateIn model.PlaylistDuplicateIn
+	err = c.Bind(&duplicateIn)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlist, err := p.service.Duplicate(c.Request().Context(), id, userID, duplicateIn)
+	if errors.Is(err, model.ErrPlaylistNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusCreated, playlist)
+}
+
+func (p *PlaylistHandler) Update(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// PUT replaces the playlist metadata while PATCH only changes the fields that are sent
+	var playlistUpdate model.PlaylistUpdate
+	if c.Request().Method == http.MethodPut {
+		name := c.FormValue("playlist_name")
+		description := c.FormValue("playlist_description")
+		playlistUpdate = model.PlaylistUpdate{
+			Name:                &name,
+			PlaylistDescription: &description,
+		}
+	} else {
+		if values, ok := form.Value["playlist_name"]; ok && len(values) > 0 {
+			playlistUpdate.Name = &values[0]
+		}
+		if values, ok := form.Value["playlist_description"]; ok && len(values) > 0 {
+			playlistUpdate.PlaylistDescription = &values[0]
+		}
+	}
+
+	if err := c.Validate(playlistUpdate); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	var file multipart.File
+	var header *multipart.FileHeader
+	if headers, ok := form.File["playlist_cover_image"]; ok && len(headers) > 0 {
+		header = headers[0]
+
+		file, err = openPlaylistCoverImage(header)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+	}
+
+	playlist, err := p.service.Update(c.Request().Context(), id, playlistUpdate, file, header)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, playlist)
+}
+
+// UpdateSmartRules replaces the rules of a smart playlist.
+func (p *PlaylistHandler) UpdateSmartRules(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	var rules model.SmartPlaylistRules
+	err = c.Bind(&rules)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(rules); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlist, err := p.service.UpdateSmartRules(c.Request().Context(), playlistID, userID, rules)
+	if errors.Is(err, model.ErrInvalidSmartRules) || errors.Is(err, model.ErrPlaylistNotSmart) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, model.ErrPlaylistForbidden) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, playlist)
+}
+
+// Freeze turns a smart playlist into a playlist with the songs currently matching its rules.
+func (p *PlaylistHandler) Freeze(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlist, err := p.service.Freeze(c.Request().Context(), playlistID, userID)
+	if errors.Is(err, model.ErrPlaylistNotSmart) || errors.Is(err, model.ErrPlaylistNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if errors.Is(err, model.ErrInvalidSmartRules) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, model.ErrPlaylistForbidden) {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, playlist)
+}
+
 func (p *PlaylistHandler) AddSongsToPlaylist(c echo.Context) error {
 	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
+	position := -1
+	if c.QueryParam("position") != "" {
+		position, err = strconv.Atoi(c.QueryParam("position"))
+		if err != nil || position < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "position must be a non-negative integer")
+		}
+	}
+
 	var songs []model.SongInAPI
 	err = c.Bind(&songs)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	err = p.service.AddSongsToPlaylist(c.Request().Context(), playlistID, songs)
+	userID, err := getUserID(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
+	}
+
+	err = p.service.AddSongsToPlaylistAt(c.Request().Context(), playlistID, songs, position, userID)
+	if err != nil {
+		return playlistSongsHTTPError(err)
 	}
 
 	return c.JSON(http.StatusOK, songs)
@@ -157,7 +334,7 @@ func (p *PlaylistHandler) AddSongsToPlaylist(c echo.Context) error {
 
 func (p *PlaylistHandler) GetAllSongsFromPlaylist(c echo.Context) error {
 	type QueryParams struct {
-		SortBy    string `query:"sort_by" validate:"omitempty,oneof=s.song_name al.album_name pls.created_at"`
+		SortBy    string `query:"sort_by" validate:"omitempty,oneof=pls.position s.song_name al.album_name pls.created_at"`
 		SortOrder string `query:"sort_order" validate:"required_with=SortBy,omitempty,oneof=ASC DESC"`
 	}
 	var qParams QueryParams
@@ -200,55 +377,137 @@ func (p *PlaylistHandler) DeleteSongsFromPlaylist(c echo.Context) error {
 
 	err = p.service.DeleteSongsFromPlaylist(c.Request().Context(), playlistID, songsID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return playlistSongsHTTPError(err)
 	}
 
 	return c.JSON(http.StatusOK, reqBody)
 }
 
-func (p *PlaylistHandler) ConvertHandler(c echo.Context) error {
+func (p *PlaylistHandler) MoveSongsInPlaylist(c echo.Context) error {
 	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	var reqBody model.ConverterRequestData
+	var reqBody struct {
+		RangeStart   int `json:"range_start" validate:"min=0"`
+		RangeLength  int `json:"range_length" validate:"min=1"`
+		InsertBefore int `json:"insert_before" validate:"min=0"`
+	}
 	err = c.Bind(&reqBody)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(reqBody); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	err = p.service.MoveSongsInPlaylist(c.Request().Context(), playlistID, reqBody.RangeStart, reqBody.RangeLength, reqBody.InsertBefore)
+	if err != nil {
+		return playlistSongsHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, reqBody)
+}
+
+func (p *PlaylistHandler) ReorderSongsInPlaylist(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	err = c.Validate(reqBody)
+	var reqBody map[string][]int
+	err = c.Bind(&reqBody)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err)
 	}
 
-	songs, err := p.service.GetAllSongsFromPlaylist(c.Request().Context(), playlistID, "", "")
+	songsID := reqBody["songs_id"]
+
+	err = p.service.ReorderSongsInPlaylist(c.Request().Context(), playlistID, songsID)
+	if err != nil {
+		return playlistSongsHTTPError(err)
+	}
+
+	return c.JSON(http.StatusOK, reqBody)
+}
+
+func (p *PlaylistHandler) ListRemotePlaylistsHandler(c echo.Context) error {
+	provider, err := getProvider(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(model.ProviderParam{Provider: provider}); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := checkProviderCanImport(p.providers, provider); err != nil {
+		return err
+	}
+
+	// listing is a GET request so the provider metadata comes from the headers
+	providerMetadata, err := getProviderMetadata(c, p.providers, provider, nil)
+	if err != nil {
+		return err
+	}
+
+	playlists, err := p.service.ListRemotePlaylists(c.Request().Context(), provider, providerMetadata)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	sessionValues, err := getOauthSessionValues(c.Request(), p.sessionStore)
+	return c.JSON(http.StatusOK, playlists)
+}
+
+func (p *PlaylistHandler) ImportHandler(c echo.Context) error {
+	var reqBody model.ImporterRequestData
+	err := c.Bind(&reqBody)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	provider := c.Param("provider")
-	providerMetadata := getProviderMetadata(provider, sessionValues, reqBody)
+	err = c.Validate(reqBody)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
 
-	err = p.service.Convert(c.Request().Context(), provider, providerMetadata, reqBody.PlaylistName, songs)
+	if err := checkProviderCanImport(p.providers, reqBody.Provider); err != nil {
+		return err
+	}
+
+	userID, err := getUserID(c)
 	if err != nil {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
-		"message": "Converted successfully",
-	})
+	provider := reqBody.Provider
+	providerMetadata, err := getProviderMetadata(c, p.providers, provider, reqBody.ProviderMetadata)
+	if err != nil {
+		return err
+	}
+
+	playlist, err := p.service.Import(
+		c.Request().Context(),
+		provider,
+		providerMetadata,
+		reqBody.RemotePlaylistID,
+		model.PlaylistIn{
+			Name:   reqBody.PlaylistName,
+			UserID: userID,
+		},
+	)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, playlist)
 }
 
 func (p *PlaylistHandler) GetAllSongsFromPlaylistToCsv(c echo.Context) error {
 	type QueryParams struct {
-		SortBy    string `query:"sort_by" validate:"omitempty,oneof=s.song_name al.album_name pls.created_at"`
+		SortBy    string `query:"sort_by" validate:"omitempty,oneof=pls.position s.song_name al.album_name pls.created_at"`
 		SortOrder string `query:"sort_order" validate:"required_with=SortBy,omitempty,oneof=ASC DESC"`
 	}
 	var qParams QueryParams
@@ -325,12 +584,29 @@ func (p *PlaylistHandler) AddSongsToPlaylistFromCsv(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err)
 	}
 
-	err = p.service.AddSongsToPlaylist(c.Request().Context(), playlistID, songs)
+	userID, err := getUserID(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err)
+		return err
+	}
+
+	err = p.service.AddSongsToPlaylist(c.Request().Context(), playlistID, songs, userID)
+	if err != nil {
+		return playlistSongsHTTPError(err)
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{
 		"message": "successfully added songs from csv",
 	})
 }
+
+// playlistSongsHTTPError reports the changes to the songs of a smart playlist, which come from its rules, as conflicts,
+// and moves or orders that don't fit the songs of the playlist as bad requests.
+func playlistSongsHTTPError(err error) error {
+	if errors.Is(err, model.ErrSmartPlaylistReadOnly) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if errors.Is(err, model.ErrInvalidSongOrder) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err)
+}
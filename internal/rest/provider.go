@@ -0,0 +1,30 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type ProviderRegistry interface {
+	Get(name string) (model.ProviderInfo, bool)
+	List() []model.ProviderInfo
+	Authorize(ctx context.Context, provider string, providerMetadata model.ConverterServiceProviderMetadata) (model.ConverterServiceProviderMetadata, error)
+}
+
+type ProviderHandler struct {
+	providers ProviderRegistry
+}
+
+func NewProviderHandler(providers ProviderRegistry) *ProviderHandler {
+	return &ProviderHandler{
+		providers: providers,
+	}
+}
+
+// ListHandler returns the providers playlists can be exported to, with how users authenticate and what they support.
+func (p *ProviderHandler) ListHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, p.providers.List())
+}
@@ -0,0 +1,294 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+const sharePagePath = "/share/"
+
+var sharePageTemplate = template.Must(template.New("share").Funcs(template.FuncMap{
+	"duration": formatDuration,
+	"join":     strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Playlist.Name}}</title>
+<meta property="og:type" content="music.playlist">
+<meta property="og:title" content="{{.Playlist.Name}}">
+<meta property="og:description" content="{{.Playlist.PlaylistDescription}}">
+<meta property="og:url" content="{{.PageURL}}">
+<meta property="og:image" content="{{.CoverURL}}">
+<link rel="alternate" type="application/json+oembed" href="{{.OEmbedURL}}" title="{{.Playlist.Name}}">
+</head>
+<body>
+<header>
+<img src="{{.CoverURL}}" alt="" width="200" height="200">
+<h1>{{.Playlist.Name}}</h1>
+<p>by {{.Playlist.Username}} · {{len .Songs}} songs</p>
+{{with .Playlist.PlaylistDescription}}<p>{{.}}</p>{{end}}
+</header>
+<ol>
+{{range .Songs}}<li>{{.Name}} · {{join .ArtistNames ", "}} · {{.AlbumName}} · {{duration .Duration}}</li>
+{{end}}</ol>
+</body>
+</html>
+`))
+
+type ShareService interface {
+	Create(ctx context.Context, playlistID int, createdBy string) (model.PlaylistShare, error)
+	GetAll(ctx context.Context, playlistID int) ([]model.PlaylistShare, error)
+	Revoke(ctx context.Context, playlistID int, token string) error
+	GetPlaylistID(ctx context.Context, token string) (int, error)
+	GetPlaylist(ctx context.Context, token string) (model.Playlist, error)
+	GetSongs(ctx context.Context, token string, sortBy string, sortOrder string) ([]model.SongOutAPI, error)
+}
+
+type ShareHandler struct {
+	service ShareService
+	// baseURL is the public address of the API, without a trailing slash, that share links are built from
+	baseURL string
+}
+
+func NewShareHandler(svc ShareService, baseURL string) *ShareHandler {
+	return &ShareHandler{
+		service: svc,
+		baseURL: baseURL,
+	}
+}
+
+// Create makes a share link giving anonymous read-only access to the playlist.
+func (s *ShareHandler) Create(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	share, err := s.service.Create(c.Request().Context(), playlistID, userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+	share.URL = s.shareURL(share.Token)
+
+	return c.JSON(http.StatusCreated, share)
+}
+
+func (s *ShareHandler) GetAll(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	shares, err := s.service.GetAll(c.Request().Context(), playlistID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	for i := range shares {
+		shares[i].URL = s.shareURL(shares[i].Token)
+	}
+
+	return c.JSON(http.StatusOK, shares)
+}
+
+func (s *ShareHandler) Revoke(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	err = s.service.Revoke(c.Request().Context(), playlistID, c.Param("token"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// OrShared lets requests with the share_token query param of the playlist in the :id path param through,
+// and the other requests through the middleware.
+func (s *ShareHandler) OrShared(middleware echo.MiddlewareFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		guarded := middleware(next)
+
+		return func(c echo.Context) error {
+			token := c.QueryParam("share_token")
+			if token == "" {
+				return guarded(c)
+			}
+
+			playlistID, err := strconv.Atoi(c.Param("id"))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid playlist id")
+			}
+
+			sharedID, err := s.service.GetPlaylistID(c.Request().Context(), token)
+			if errors.Is(err, model.ErrShareNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err)
+			}
+			if sharedID != playlistID {
+				return echo.NewHTTPError(http.StatusForbidden, "share link is for another playlist")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// GetPlaylist returns the shared playlist to anonymous viewers.
+func (s *ShareHandler) GetPlaylist(c echo.Context) error {
+	playlist, err := s.getPlaylist(c, c.Param("token"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, playlist)
+}
+
+// GetSongs returns the songs of the shared playlist to anonymous viewers.
+func (s *ShareHandler) GetSongs(c echo.Context) error {
+	type QueryParams struct {
+		SortBy    string `query:"sort_by" validate:"omitempty,oneof=pls.position s.song_name al.album_name pls.created_at"`
+		SortOrder string `query:"sort_order" validate:"required_with=SortBy,omitempty,oneof=ASC DESC"`
+	}
+	var qParams QueryParams
+
+	err := (&echo.DefaultBinder{}).BindQueryParams(c, &qParams)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(qParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	songs, err := s.service.GetSongs(c.Request().Context(), c.Param("token"), qParams.SortBy, qParams.SortOrder)
+	if errors.Is(err, model.ErrShareNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, songs)
+}
+
+// Cover redirects to a freshly signed URL of the playlist cover. Share pages and link
+// previews point to it because signed URLs expire long before the link is revoked.
+func (s *ShareHandler) Cover(c echo.Context) error {
+	playlist, err := s.getPlaylist(c, c.Param("token"))
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	return c.Redirect(http.StatusFound, playlist.ImageURL)
+}
+
+// Page renders the shared playlist for browsers and link previews.
+func (s *ShareHandler) Page(c echo.Context) error {
+	token := c.Param("token")
+
+	playlist, err := s.getPlaylist(c, token)
+	if err != nil {
+		return err
+	}
+
+	songs, err := s.service.GetSongs(c.Request().Context(), token, "", "")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	pageURL := s.shareURL(token)
+	data := map[string]any{
+		"Playlist":  playlist,
+		"Songs":     songs,
+		"PageURL":   pageURL,
+		"CoverURL":  s.shareCoverURL(token),
+		"OEmbedURL": s.baseURL + "/api/oembed?format=json&url=" + url.QueryEscape(pageURL),
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+	c.Response().WriteHeader(http.StatusOK)
+	return sharePageTemplate.Execute(c.Response(), data)
+}
+
+// OEmbed describes a share link so chat tools can unfurl it.
+func (s *ShareHandler) OEmbed(c echo.Context) error {
+	type QueryParams struct {
+		URL    string `query:"url" validate:"required,url"`
+		Format string `query:"format" validate:"omitempty,oneof=json xml"`
+	}
+	var qParams QueryParams
+
+	err := (&echo.DefaultBinder{}).BindQueryParams(c, &qParams)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(qParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// only json is implemented, which is what the spec asks for when the format is unsupported
+	if qParams.Format == "xml" {
+		return echo.NewHTTPError(http.StatusNotImplemented, "only the json format is supported")
+	}
+
+	token, ok := shareTokenFromURL(qParams.URL)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "not a share link")
+	}
+
+	playlist, err := s.getPlaylist(c, token)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, model.OEmbed{
+		Type:         "link",
+		Version:      "1.0",
+		Title:        playlist.Name,
+		AuthorName:   playlist.Username,
+		ProviderName: "Playlist Manager",
+		ProviderURL:  s.baseURL,
+	})
+}
+
+func (s *ShareHandler) getPlaylist(c echo.Context, token string) (model.Playlist, error) {
+	playlist, err := s.service.GetPlaylist(c.Request().Context(), token)
+	if errors.Is(err, model.ErrShareNotFound) {
+		return model.Playlist{}, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return model.Playlist{}, echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return playlist, nil
+}
+
+func (s *ShareHandler) shareURL(token string) string {
+	return s.baseURL + sharePagePath + token
+}
+
+func (s *ShareHandler) shareCoverURL(token string) string {
+	return s.baseURL + "/api/share/" + token + "/cover"
+}
@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type SyncService interface {
+	TwoWaySync(
+		ctx context.Context,
+		playlistID int,
+		provider string,
+		providerMetadata model.ConverterServiceProviderMetadata,
+		autoSync bool,
+		resolve model.SyncSide,
+	) (model.TwoWaySyncResult, error)
+}
+
+type SyncHandler struct {
+	service      SyncService
+	sessionStore sessions.Store
+	providers    ProviderRegistry
+}
+
+func NewSyncHandler(svc SyncService, store sessions.Store, providers ProviderRegistry) *SyncHandler {
+	return &SyncHandler{
+		service:      svc,
+		sessionStore: store,
+		providers:    providers,
+	}
+}
+
+// TwoWaySyncHandler merges the changes made on both the playlist and the remote playlist it was exported to.
+func (s *SyncHandler) TwoWaySyncHandler(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	var reqBody model.TwoWaySyncRequestData
+	err = c.Bind(&reqBody)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	if err := c.Validate(reqBody); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	provider := reqBody.Provider
+	providerMetadata, err := getProviderMetadata(c, s.providers, provider, reqBody.ProviderMetadata)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.service.TwoWaySync(c.Request().Context(), playlistID, provider, providerMetadata, reqBody.AutoSync, reqBody.Resolve)
+	switch {
+	case errors.Is(err, model.ErrRemoteLinkNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, model.ErrTwoWaySyncUnsupported):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, model.ErrSyncInProgress), errors.Is(err, model.ErrSmartPlaylistReadOnly):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case err != nil:
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type TrashService interface {
+	GetAll(ctx context.Context, userID string) ([]model.Playlist, error)
+	Restore(ctx context.Context, id int, userID string) error
+	Purge(ctx context.Context, id int, userID string) error
+}
+
+type TrashHandler struct {
+	service TrashService
+}
+
+func NewTrashHandler(svc TrashService) *TrashHandler {
+	return &TrashHandler{
+		service: svc,
+	}
+}
+
+// GetAll returns the playlists of the user in the trash.
+func (t *TrashHandler) GetAll(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	playlists, err := t.service.GetAll(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, playlists)
+}
+
+func (t *TrashHandler) Restore(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid playlist id")
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = t.service.Restore(c.Request().Context(), id, userID)
+	if errors.Is(err, model.ErrPlaylistNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Purge deletes the playlist in the trash for good, along with its songs and cover.
+func (t *TrashHandler) Purge(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid playlist id")
+	}
+
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	err = t.service.Purge(c.Request().Context(), id, userID)
+	if errors.Is(err, model.ErrPlaylistNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
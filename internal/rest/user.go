@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/rest/middleware"
+)
+
+type UserService interface {
+	Register(ctx context.Context, userID string, displayName string, avatarURL string) error
+	Get(ctx context.Context, userID string) (model.User, error)
+	Update(ctx context.Context, userID string, user model.UserUpdate) (model.User, error)
+}
+
+type UserHandler struct {
+	service UserService
+}
+
+func NewUserHandler(svc UserService) *UserHandler {
+	return &UserHandler{
+		service: svc,
+	}
+}
+
+// RegisterUser creates the user of the request token the first time they call the API.
+func (u *UserHandler) RegisterUser(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userID, claims, ok := middleware.User(c.Request().Context())
+		if !ok {
+			return echo.NewHTTPError(http.StatusUnauthorized, "no user logged in")
+		}
+
+		err := u.service.Register(c.Request().Context(), userID, claims.Name, claims.Picture)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err)
+		}
+
+		return next(c)
+	}
+}
+
+func (u *UserHandler) GetMe(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := u.service.Get(c.Request().Context(), userID)
+	if errors.Is(err, model.ErrUserNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// UpdateMe changes the fields of the profile that are sent.
+func (u *UserHandler) UpdateMe(c echo.Context) error {
+	userID, err := getUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var userUpdate model.UserUpdate
+	err = c.Bind(&userUpdate)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(userUpdate); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	user, err := u.service.Update(c.Request().Context(), userID, userUpdate)
+	if errors.Is(err, model.ErrUserNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
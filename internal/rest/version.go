@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type VersionService interface {
+	GetAll(ctx context.Context, playlistID int) ([]model.PlaylistVersion, error)
+	Diff(ctx context.Context, playlistID int, from int, to int) (model.PlaylistVersionDiff, error)
+	Restore(ctx context.Context, playlistID int, version int) (model.PlaylistVersion, error)
+}
+
+type VersionHandler struct {
+	service VersionService
+}
+
+func NewVersionHandler(svc VersionService) *VersionHandler {
+	return &VersionHandler{
+		service: svc,
+	}
+}
+
+// GetAll returns the history of the playlist from its latest version.
+func (v *VersionHandler) GetAll(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	versions, err := v.service.GetAll(c.Request().Context(), playlistID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, versions)
+}
+
+// Diff returns what changed between the from and to versions of the playlist.
+func (v *VersionHandler) Diff(c echo.Context) error {
+	type QueryParams struct {
+		From int `query:"from" validate:"required,min=1"`
+		To   int `query:"to" validate:"required,min=1"`
+	}
+	var qParams QueryParams
+
+	err := (&echo.DefaultBinder{}).BindQueryParams(c, &qParams)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := c.Validate(qParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	diff, err := v.service.Diff(c.Request().Context(), playlistID, qParams.From, qParams.To)
+	if errors.Is(err, model.ErrVersionNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, diff)
+}
+
+// Restore puts the playlist back to a version. The restore is itself a new version, which is returned.
+func (v *VersionHandler) Restore(c echo.Context) error {
+	playlistID, err := strconv.Atoi(c.Param("playlist_id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid version")
+	}
+
+	playlistVersion, err := v.service.Restore(c.Request().Context(), playlistID, version)
+	if errors.Is(err, model.ErrVersionNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err)
+	}
+
+	return c.JSON(http.StatusOK, playlistVersion)
+}
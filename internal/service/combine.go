@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+// Combine applies the set operation to the songs of the source playlists and writes them to the target playlist,
+// or to a new playlist of the user with a copy of the cover of the first source playlist. It returns the playlist written to.
+func (p *PlaylistService) Combine(ctx context.Context, userID string, combineIn model.PlaylistCombineIn) (model.Playlist, error) {
+	sources := make([][]model.SongOutAPI, len(combineIn.SourceIDs))
+	for i, playlistID := range combineIn.SourceIDs {
+		songs, err := p.playlistSongRepo.GetAll(ctx, playlistID, "", "")
+		if err != nil {
+			return model.Playlist{}, err
+		}
+		sources[i] = songs
+	}
+
+	songs := orderCombinedSongs(combineSongs(combineIn.Operation, sources), combineIn.Order)
+
+	if combineIn.TargetID == 0 {
+		return p.combineIntoNewPlaylist(ctx, userID, combineIn, songs)
+	}
+
+	return p.combineIntoPlaylist(ctx, userID, combineIn.TargetID, combineIn.Replace, songs)
+}
+
+func (p *PlaylistService) combineIntoNewPlaylist(
+	ctx context.Context,
+	userID string,
+	combineIn model.PlaylistCombineIn,
+	songs []model.SongOutAPI,
+) (model.Playlist, error) {
+	imageName, err := p.playlistRepo.CopyPlaylistPicture(ctx, combineIn.SourceIDs[0])
+	if err != nil {
+		return model.Playlist{}, err
+	}
+
+	playlistID, err := p.playlistRepo.Insert(ctx, model.PlaylistInDB{
+		Name:                combineIn.Name,
+		PlaylistDescription: combineIn.PlaylistDescription,
+		UserID:              userID,
+		ImageName:           imageName,
+	})
+	if err != nil {
+		// the copied cover is not referenced by any playlist so remove it
+		if deleteErr := p.playlistRepo.DeletePlaylistPicture(ctx, imageName); deleteErr != nil {
+			log.Printf("error removing unused playlist cover %s: %v", imageName, deleteErr)
+		}
+		return model.Playlist{}, err
+	}
+
+	playlist, err := p.combineIntoPlaylist(ctx, userID, playlistID, false, songs)
+	if err != nil {
+		p.discardPlaylist(ctx, playlistID)
+		return model.Playlist{}, err
+	}
+
+	return playlist, nil
+}
+
+// combineIntoPlaylist adds the songs to the playlist after its songs, or makes them its only songs when replace is set.
+// Songs of the playlist that are the same as one of the songs stay in the playlist instead of being added again.
+// The playlist is changed in one transaction, with the songs it has then.
+func (p *PlaylistService) combineIntoPlaylist(
+	ctx context.Context,
+	userID string,
+	playlistID int,
+	replace bool,
+	songs []model.SongOutAPI,
+) (model.Playlist, error) {
+	err := p.playlistSongRepo.Rewrite(ctx, playlistID, userID, model.PlaylistChangeCombined, func(current []model.SongOutAPI) ([]int, error) {
+		order, missing := mergeSongsIntoPlaylist(current, songs)
+		if replace {
+			return order, nil
+		}
+
+		newOrder := make([]int, 0, len(current)+len(missing))
+		for _, song := range current {
+			newOrder = append(newOrder, song.ID)
+		}
+		return append(newOrder, missing...), nil
+	})
+	if err != nil {
+		return model.Playlist{}, err
+	}
+
+	return p.playlistRepo.SelectWithID(ctx, playlistID)
+}
@@ -2,6 +2,7 @@ package applemusicconverter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -9,8 +10,12 @@ import (
 
 	applemusic "github.com/minchao/go-apple-music"
 	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/matcher"
 )
 
+// candidateLimit is the number of search results the matcher picks from
+const candidateLimit = 5
+
 type AppleMusicConverter struct {
 	client *applemusic.Client
 }
@@ -25,13 +30,8 @@ func New(ctx context.Context, musicUserToken string) *AppleMusicConverter {
 	return &AppleMusicConverter{client: client}
 }
 
-func (a *AppleMusicConverter) Export(ctx context.Context, playlistName string, songs []model.SongOutAPI) error {
-	libraryPlaylistTracks, err := a.parseSongToPlaylistTracks(ctx, songs)
-	if err != nil {
-		return fmt.Errorf("parse song models to playlist tracks: %w", err)
-	}
-
-	_, _, err = a.client.Me.CreateLibraryPlaylist(
+func (a *AppleMusicConverter) CreatePlaylist(ctx context.Context, playlistName string, trackIDs []string) (string, error) {
+	libraryPlaylists, _, err := a.client.Me.CreateLibraryPlaylist(
 		ctx,
 		applemusic.CreateLibraryPlaylist{
 			Attributes: applemusic.CreateLibraryPlaylistAttributes{
@@ -40,7 +40,7 @@ func (a *AppleMusicConverter) Export(ctx context.Context, playlistName string, s
 			},
 			Relationships: &applemusic.CreateLibraryPlaylistRelationships{
 				Tracks: applemusic.CreateLibraryPlaylistTrackData{
-					Data: libraryPlaylistTracks,
+					Data: mapTrackIDsToLibraryPlaylistTracks(trackIDs),
 				},
 			},
 		},
@@ -48,66 +48,148 @@ func (a *AppleMusicConverter) Export(ctx context.Context, playlistName string, s
 	)
 
 	if err != nil {
-		return fmt.Errorf("create apple music playlist: %w", err)
+		return "", fmt.Errorf("create apple music playlist: %w", err)
+	}
+
+	if len(libraryPlaylists.Data) == 0 {
+		return "", nil
+	}
+
+	return libraryPlaylists.Data[0].Id, nil
+}
+
+// AddTracks appends the catalog songs to the end of the library playlist.
+func (a *AppleMusicConverter) AddTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error {
+	_, err := a.client.Me.AddLibraryTracksToPlaylist(
+		ctx,
+		remotePlaylistID,
+		applemusic.CreateLibraryPlaylistTrackData{Data: mapTrackIDsToLibraryPlaylistTracks(trackIDs)},
+	)
+	if err != nil {
+		return fmt.Errorf("add tracks to apple music playlist: %w", err)
 	}
 
 	return nil
 }
 
-func (a *AppleMusicConverter) parseSongToPlaylistTracks(ctx context.Context, songs []model.SongOutAPI) ([]applemusic.CreateLibraryPlaylistTrack, error) {
-	libraryPlaylistTracks := make([]applemusic.CreateLibraryPlaylistTrack, len(songs))
+// RemoveTracks always fails with errors.ErrUnsupported because the Apple Music API
+// can't remove tracks from a library playlist.
+func (a *AppleMusicConverter) RemoveTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error {
+	return fmt.Errorf("remove tracks from apple music playlist: %w", errors.ErrUnsupported)
+}
 
-	for i, song := range songs {
-		amTrack, err := a.searchAndMatch(ctx, song)
-		if err != nil {
-			return nil, fmt.Errorf("search and match apple music track: %w", err)
+func (a *AppleMusicConverter) SearchAndMatch(ctx context.Context, song model.SongOutAPI) model.SongMatchResult {
+	candidates, err := a.SearchCandidates(ctx, song, candidateLimit)
+	if err != nil {
+		return model.SongMatchResult{
+			Song:   song,
+			Status: model.MatchStatusUnmatched,
+			Error:  err.Error(),
 		}
-
-		libraryPlaylistTracks[i] = amTrack
 	}
 
-	return libraryPlaylistTracks, nil
+	return matcher.Match(song, candidates)
 }
 
-func (a *AppleMusicConverter) searchAndMatch(ctx context.Context, song model.SongOutAPI) (applemusic.CreateLibraryPlaylistTrack, error) {
-	var id, songType string
+// SearchCandidates returns up to limit catalog songs that could match the song, ISRC matches first.
+func (a *AppleMusicConverter) SearchCandidates(ctx context.Context, song model.SongOutAPI, limit int) ([]model.TrackCandidate, error) {
+	var candidates []model.TrackCandidate
+	seen := make(map[string]bool)
+
+	addSongs := func(amSongs []applemusic.Song, strategy model.MatchStrategy) {
+		for _, amSong := range amSongs {
+			if seen[amSong.Id] || len(candidates) >= limit {
+				continue
+			}
+			seen[amSong.Id] = true
+			candidates = append(candidates, mapCatalogSongToCandidate(amSong, strategy))
+		}
+	}
 
 	if song.ISRC != "" {
+		// a failed ISRC lookup still leaves the text search to find the song
 		amTrack, _, err := a.client.Catalog.GetSongsByIsrcs(ctx, "vn", []string{song.ISRC}, &applemusic.Options{})
 		if err != nil {
-			return applemusic.CreateLibraryPlaylistTrack{}, fmt.Errorf("get songs by ISRC: %w", err)
-		}
-		if len(amTrack.Data) == 0 {
-			return applemusic.CreateLibraryPlaylistTrack{}, fmt.Errorf("no track found for ISRC: %s", song.ISRC)
+			log.Printf("error getting apple music songs by ISRC %s: %v", song.ISRC, err)
+		} else {
+			addSongs(amTrack.Data, model.MatchStrategyISRC)
 		}
+	}
 
-		id = amTrack.Data[0].Id
-		songType = amTrack.Data[0].Type
-	} else {
+	if len(candidates) < limit {
 		artistSearch := strings.Join(song.ArtistNames, " ")
-		searchTerm := fmt.Sprintf("%s %s %s", song.Name, artistSearch, song.AlbumName)
+		searchTerm := fmt.Sprintf("%s %s %s", matcher.CleanTitle(song.Name), artistSearch, song.AlbumName)
 
 		log.Printf("apple music search term: %s", searchTerm)
 
 		searchResult, _, err := a.client.Catalog.Search(ctx, "vn", &applemusic.SearchOptions{
 			Term:  searchTerm,
 			Types: "songs",
+			Limit: limit,
 		})
 		if err != nil {
-			return applemusic.CreateLibraryPlaylistTrack{}, fmt.Errorf("search songs: %w", err)
+			return nil, fmt.Errorf("search songs: %w", err)
 		}
 
-		songs := searchResult.Results.Songs
-		if songs == nil {
-			return applemusic.CreateLibraryPlaylistTrack{}, fmt.Errorf("no track found for search term: %s", searchTerm)
+		if searchResult.Results.Songs != nil {
+			addSongs(searchResult.Results.Songs.Data, model.MatchStrategyTextSearch)
 		}
+	}
 
-		id = searchResult.Results.Songs.Data[0].Id
-		songType = searchResult.Results.Songs.Data[0].Type
+	return candidates, nil
+}
+
+func (a *AppleMusicConverter) ListPlaylists(ctx context.Context) ([]model.RemotePlaylist, error) {
+	var playlists []model.RemotePlaylist
+
+	opt := &applemusic.PageOptions{Limit: 100}
+	for {
+		libraryPlaylists, _, err := a.client.Me.GetAllLibraryPlaylists(ctx, opt)
+		if err != nil {
+			return nil, fmt.Errorf("get apple music library playlists: %w", err)
+		}
+
+		for _, playlist := range libraryPlaylists.Data {
+			playlists = append(playlists, mapLibraryPlaylistToRemotePlaylist(playlist))
+		}
+
+		if libraryPlaylists.Next == "" || len(libraryPlaylists.Data) == 0 {
+			break
+		}
+		opt.Offset += len(libraryPlaylists.Data)
 	}
 
-	return applemusic.CreateLibraryPlaylistTrack{
-		Id:   id,
-		Type: songType,
+	return playlists, nil
+}
+
+func (a *AppleMusicConverter) Import(ctx context.Context, playlistID string) (model.ImportedPlaylist, error) {
+	libraryPlaylists, _, err := a.client.Me.GetLibraryPlaylist(ctx, playlistID, &applemusic.Options{})
+	if err != nil {
+		return model.ImportedPlaylist{}, fmt.Errorf("get apple music library playlist: %w", err)
+	}
+	if len(libraryPlaylists.Data) == 0 {
+		return model.ImportedPlaylist{}, fmt.Errorf("no library playlist found for id: %s", playlistID)
+	}
+
+	// the catalog relationship carries the ISRC, which library songs don't have
+	tracks, _, err := a.client.Me.GetLibraryPlaylistTracks(ctx, playlistID, &applemusic.PageOptions{
+		Options: applemusic.Options{Include: "catalog"},
+	})
+	if err != nil {
+		return model.ImportedPlaylist{}, fmt.Errorf("get apple music library playlist tracks: %w", err)
+	}
+
+	songs := make([]model.SongInAPI, 0, len(tracks))
+	for _, track := range tracks {
+		songs = append(songs, mapLibrarySongToSong(track))
+	}
+
+	remotePlaylist := mapLibraryPlaylistToRemotePlaylist(libraryPlaylists.Data[0])
+
+	return model.ImportedPlaylist{
+		Name:        remotePlaylist.Name,
+		Description: remotePlaylist.Description,
+		ImageURL:    remotePlaylist.ImageURL,
+		Songs:       songs,
 	}, nil
 }
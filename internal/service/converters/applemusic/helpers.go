@@ -0,0 +1,96 @@
+package applemusicconverter
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	applemusic "github.com/minchao/go-apple-music"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+const artworkSize = 600
+
+var artistSeparator = regexp.MustCompile(`\s*(?:,|&)\s*`)
+
+func mapLibraryPlaylistToRemotePlaylist(playlist applemusic.LibraryPlaylist) model.RemotePlaylist {
+	var description, imageURL string
+	if playlist.Attributes.Description != nil {
+		description = playlist.Attributes.Description.Standard
+	}
+	if playlist.Attributes.Artwork != nil {
+		imageURL = formatArtworkURL(*playlist.Attributes.Artwork)
+	}
+
+	return model.RemotePlaylist{
+		ID:          playlist.Id,
+		Name:        playlist.Attributes.Name,
+		Description: description,
+		ImageURL:    imageURL,
+	}
+}
+
+func mapLibrarySongToSong(track applemusic.Song) model.SongInAPI {
+	attributes := track.Attributes
+
+	// prefer the catalog version of the song since it has the ISRC and full metadata
+	if catalog := track.Relationships.Catalog; catalog != nil && len(catalog.Data) > 0 {
+		attributes = catalog.Data[0].Attributes
+	}
+
+	return model.SongInAPI{
+		Name:        attributes.Name,
+		ArtistNames: splitArtistNames(attributes.ArtistName),
+		AlbumName:   attributes.AlbumName,
+		Duration:    int(attributes.DurationInMillis),
+		ImageURL:    formatArtworkURL(attributes.Artwork),
+		ISRC:        attributes.ISRC,
+	}
+}
+
+func mapCatalogSongToCandidate(amSong applemusic.Song, strategy model.MatchStrategy) model.TrackCandidate {
+	song := mapLibrarySongToSong(amSong)
+
+	return model.TrackCandidate{
+		ProviderTrackID: amSong.Id,
+		Name:            song.Name,
+		ArtistNames:     song.ArtistNames,
+		AlbumName:       song.AlbumName,
+		Duration:        song.Duration,
+		ImageURL:        song.ImageURL,
+		ISRC:            song.ISRC,
+		Strategy:        strategy,
+	}
+}
+
+func formatArtworkURL(artwork applemusic.Artwork) string {
+	size := strconv.Itoa(artworkSize)
+
+	return strings.NewReplacer("{w}", size, "{h}", size).Replace(artwork.URL)
+}
+
+func splitArtistNames(artistName string) []string {
+	var artistNames []string
+	for _, name := range artistSeparator.Split(artistName, -1) {
+		if name != "" {
+			artistNames = append(artistNames, name)
+		}
+	}
+
+	if len(artistNames) == 0 {
+		return []string{artistName}
+	}
+
+	return artistNames
+}
+
+func mapTrackIDsToLibraryPlaylistTracks(trackIDs []string) []applemusic.CreateLibraryPlaylistTrack {
+	libraryPlaylistTracks := make([]applemusic.CreateLibraryPlaylistTrack, len(trackIDs))
+	for i, trackID := range trackIDs {
+		libraryPlaylistTracks[i] = applemusic.CreateLibraryPlaylistTrack{
+			Id:   trackID,
+			Type: "songs",
+		}
+	}
+	return libraryPlaylistTracks
+}
@@ -0,0 +1,56 @@
+// Package convertertest has what the tests of converters share: a fake provider API and the song they look for on it.
+package convertertest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// AccessToken is the token of the user converters act for
+	AccessToken = "test-token"
+	// ISRC is the ISRC of Song
+	ISRC = "USUM71027417"
+)
+
+// Song returns the song converters are asked to find.
+func Song() model.SongOutAPI {
+	return model.SongOutAPI{
+		Name:        "Runaway",
+		ArtistNames: []string{"Kanye West"},
+		ISRC:        ISRC,
+	}
+}
+
+// Token returns a token for AccessToken that doesn't expire during the test.
+func Token() *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken: AccessToken,
+		Expiry:      time.Now().Add(time.Hour),
+	}
+}
+
+// Serve starts a fake provider API with the handler until the test ends,
+// and sets the environment variable the converter reads the API URL from to its URL followed by path.
+func Serve(t *testing.T, handler http.Handler, urlEnv string, path string) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	t.Setenv(urlEnv, server.URL+path)
+}
+
+// WriteJSON answers a request of the converter with the JSON body.
+func WriteJSON(t *testing.T, w http.ResponseWriter, body string) {
+	t.Helper()
+
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.Write([]byte(body))
+	require.NoError(t, err)
+}
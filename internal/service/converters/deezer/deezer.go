@@ -0,0 +1,231 @@
+package deezerconverter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/matcher"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// candidateLimit is the number of search results the matcher picks from
+	candidateLimit = 5
+
+	defaultAPIURL = "https://api.deezer.com"
+
+	// errorCodeDataNotFound is returned by the API when a resource such as an ISRC doesn't exist
+	errorCodeDataNotFound = 800
+)
+
+// Scopes are the permissions needed to export playlists. offline_access makes the access token never expire.
+var Scopes = []string{"basic_access", "manage_library", "delete_library", "offline_access"}
+
+type DeezerConverter struct {
+	client      *http.Client
+	apiURL      string
+	accessToken string
+}
+
+// New creates a converter calling the Deezer API, or the API at DEEZER_API_URL when it's set.
+func New(ctx context.Context, token *oauth2.Token) *DeezerConverter {
+	apiURL := os.Getenv("DEEZER_API_URL")
+	if apiURL == "" {
+		apiURL = defaultAPIURL
+	}
+
+	var accessToken string
+	if token != nil {
+		accessToken = token.AccessToken
+	}
+
+	return &DeezerConverter{
+		client:      http.DefaultClient,
+		apiURL:      strings.TrimSuffix(apiURL, "/"),
+		accessToken: accessToken,
+	}
+}
+
+func (d *DeezerConverter) CreatePlaylist(ctx context.Context, playlistName string, trackIDs []string) (string, error) {
+	var created struct {
+		ID int64 `json:"id"`
+	}
+	err := d.do(ctx, http.MethodPost, "/user/me/playlists", url.Values{"title": {playlistName}}, &created)
+	if err != nil {
+		return "", fmt.Errorf("create deezer playlist: %w", err)
+	}
+	playlistID := strconv.FormatInt(created.ID, 10)
+
+	// playlists are public when they are created
+	err = d.do(ctx, http.MethodPost, "/playlist/"+playlistID, url.Values{"public": {"false"}}, nil)
+	if err != nil {
+		return playlistID, fmt.Errorf("make deezer playlist private: %w", err)
+	}
+
+	err = d.AddTracks(ctx, playlistID, trackIDs)
+	if err != nil {
+		return playlistID, err
+	}
+
+	return playlistID, nil
+}
+
+// AddTracks appends the tracks to the end of the playlist.
+func (d *DeezerConverter) AddTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error {
+	for _, IDs := range chunkBy(trackIDs, 100) {
+		if len(IDs) == 0 {
+			continue
+		}
+
+		err := d.do(ctx, http.MethodPost, "/playlist/"+remotePlaylistID+"/tracks", url.Values{"songs": {strings.Join(IDs, ",")}}, nil)
+		if err != nil {
+			return fmt.Errorf("add track to deezer playlist: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RemoveTracks removes the tracks from the playlist.
+func (d *DeezerConverter) RemoveTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error {
+	for _, IDs := range chunkBy(trackIDs, 100) {
+		if len(IDs) == 0 {
+			continue
+		}
+
+		err := d.do(ctx, http.MethodDelete, "/playlist/"+remotePlaylistID+"/tracks", url.Values{"songs": {strings.Join(IDs, ",")}}, nil)
+		if err != nil {
+			return fmt.Errorf("remove track from deezer playlist: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (d *DeezerConverter) SearchAndMatch(ctx context.Context, song model.SongOutAPI) model.SongMatchResult {
+	candidates, err := d.SearchCandidates(ctx, song, candidateLimit)
+	if err != nil {
+		return model.SongMatchResult{
+			Song:   song,
+			Status: model.MatchStatusUnmatched,
+			Error:  err.Error(),
+		}
+	}
+
+	return matcher.Match(song, candidates)
+}
+
+// SearchCandidates returns up to limit tracks that could match the song, the ISRC match first.
+func (d *DeezerConverter) SearchCandidates(ctx context.Context, song model.SongOutAPI, limit int) ([]model.TrackCandidate, error) {
+	var candidates []model.TrackCandidate
+	seen := make(map[int64]bool)
+
+	if song.ISRC != "" {
+		isrcTrack, found, err := d.trackByISRC(ctx, song.ISRC)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			seen[isrcTrack.ID] = true
+			candidates = append(candidates, mapTrackToCandidate(isrcTrack, model.MatchStrategyISRC))
+		}
+	}
+
+	if len(candidates) < limit {
+		searchQuery := formatSearchQuery(song)
+		log.Printf("deezer search query: %s", searchQuery)
+
+		var result struct {
+			Data []track `json:"data"`
+		}
+		err := d.do(ctx, http.MethodGet, "/search/track", url.Values{
+			"q":     {searchQuery},
+			"limit": {strconv.Itoa(limit)},
+		}, &result)
+		if err != nil {
+			return nil, fmt.Errorf("search for song in deezer: %w", err)
+		}
+
+		for _, searchTrack := range result.Data {
+			if seen[searchTrack.ID] || len(candidates) >= limit {
+				continue
+			}
+			seen[searchTrack.ID] = true
+			candidates = append(candidates, mapTrackToCandidate(searchTrack, model.MatchStrategyTextSearch))
+		}
+	}
+
+	return candidates, nil
+}
+
+func (d *DeezerConverter) trackByISRC(ctx context.Context, ISRC string) (track, bool, error) {
+	var result track
+	err := d.do(ctx, http.MethodGet, "/track/isrc:"+url.PathEscape(ISRC), nil, &result)
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.Code == errorCodeDataNotFound {
+		return track{}, false, nil
+	}
+	if err != nil {
+		return track{}, false, fmt.Errorf("get deezer track by ISRC: %w", err)
+	}
+
+	return result, true, nil
+}
+
+// do calls the API and decodes the response into out when it isn't nil.
+// The API answers most errors with a 200 status and an error object, so the body is always checked.
+func (d *DeezerConverter) do(ctx context.Context, method string, path string, query url.Values, out any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("access_token", d.accessToken)
+
+	req, err := http.NewRequestWithContext(ctx, method, d.apiURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	var body json.RawMessage
+	err = json.NewDecoder(res.Body).Decode(&body)
+	if err != nil {
+		return fmt.Errorf("decode response with status %d: %w", res.StatusCode, err)
+	}
+
+	var errorBody struct {
+		Error *apiError `json:"error"`
+	}
+	// successful responses can be a bare boolean, which isn't an error object
+	if json.Unmarshal(body, &errorBody) == nil && errorBody.Error != nil {
+		return errorBody.Error
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("deezer responded with status %d", res.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(body, out)
+	if err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	return nil
+}
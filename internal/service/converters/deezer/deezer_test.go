@@ -0,0 +1,142 @@
+package deezerconverter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/converters/convertertest"
+)
+
+func newTestConverter(t *testing.T, handler http.Handler) *DeezerConverter {
+	convertertest.Serve(t, handler, "DEEZER_API_URL", "")
+
+	return New(context.Background(), convertertest.Token())
+}
+
+func TestSearchCandidates(t *testing.T) {
+	tests := []struct {
+		name           string
+		isrcResponse   string
+		wantCandidates []model.TrackCandidate
+	}{
+		{
+			name: "ISRC match first",
+			isrcResponse: `{"id": 1, "title": "Runaway", "isrc": "USUM71027417", "duration": 548,
+				"contributors": [{"name": "Kanye West"}, {"name": "Pusha T"}],
+				"album": {"title": "My Beautiful Dark Twisted Fantasy", "cover_xl": "cover"}}`,
+			wantCandidates: []model.TrackCandidate{
+				{
+					ProviderTrackID: "1",
+					Name:            "Runaway",
+					ArtistNames:     []string{"Kanye West", "Pusha T"},
+					AlbumName:       "My Beautiful Dark Twisted Fantasy",
+					Duration:        548000,
+					ImageURL:        "cover",
+					ISRC:            convertertest.ISRC,
+					Strategy:        model.MatchStrategyISRC,
+				},
+				{
+					ProviderTrackID: "2",
+					Name:            "Runaway (Live)",
+					ArtistNames:     []string{"Kanye West"},
+					Duration:        600000,
+					Strategy:        model.MatchStrategyTextSearch,
+				},
+			},
+		},
+		{
+			name:         "unknown ISRC",
+			isrcResponse: `{"error": {"type": "DataException", "message": "no data", "code": 800}}`,
+			wantCandidates: []model.TrackCandidate{
+				{
+					ProviderTrackID: "1",
+					Name:            "Runaway",
+					ArtistNames:     []string{"Kanye West"},
+					Duration:        548000,
+					Strategy:        model.MatchStrategyTextSearch,
+				},
+				{
+					ProviderTrackID: "2",
+					Name:            "Runaway (Live)",
+					ArtistNames:     []string{"Kanye West"},
+					Duration:        600000,
+					Strategy:        model.MatchStrategyTextSearch,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /track/isrc:"+convertertest.ISRC, func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, convertertest.AccessToken, r.URL.Query().Get("access_token"))
+				convertertest.WriteJSON(t, w, tt.isrcResponse)
+			})
+			mux.HandleFunc("GET /search/track", func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, `track:"Runaway" artist:"Kanye West"`, r.URL.Query().Get("q"))
+				convertertest.WriteJSON(t, w, `{"data": [
+					{"id": 1, "title": "Runaway", "duration": 548, "artist": {"name": "Kanye West"}},
+					{"id": 2, "title": "Runaway (Live)", "duration": 600, "artist": {"name": "Kanye West"}}
+				]}`)
+			})
+
+			converter := newTestConverter(t, mux)
+
+			candidates, err := converter.SearchCandidates(context.Background(), convertertest.Song(), candidateLimit)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCandidates, candidates)
+		})
+	}
+}
+
+func TestCreatePlaylist(t *testing.T) {
+	var addedSongs []string
+	var madePrivate bool
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /user/me/playlists", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Road trip", r.URL.Query().Get("title"))
+		convertertest.WriteJSON(t, w, `{"id": 42}`)
+	})
+	mux.HandleFunc("POST /playlist/42", func(w http.ResponseWriter, r *http.Request) {
+		madePrivate = r.URL.Query().Get("public") == "false"
+		convertertest.WriteJSON(t, w, `true`)
+	})
+	mux.HandleFunc("POST /playlist/42/tracks", func(w http.ResponseWriter, r *http.Request) {
+		addedSongs = append(addedSongs, r.URL.Query().Get("songs"))
+		convertertest.WriteJSON(t, w, `true`)
+	})
+
+	converter := newTestConverter(t, mux)
+
+	trackIDs := make([]string, 150)
+	for i := range trackIDs {
+		trackIDs[i] = "1"
+	}
+
+	playlistID, err := converter.CreatePlaylist(context.Background(), "Road trip", trackIDs)
+
+	require.NoError(t, err)
+	assert.Equal(t, "42", playlistID)
+	assert.True(t, madePrivate)
+	assert.Len(t, addedSongs, 2)
+}
+
+func TestAddTracksError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /playlist/42/tracks", func(w http.ResponseWriter, r *http.Request) {
+		convertertest.WriteJSON(t, w, `{"error": {"type": "OAuthException", "message": "invalid token", "code": 300}}`)
+	})
+
+	converter := newTestConverter(t, mux)
+
+	err := converter.AddTracks(context.Background(), "42", []string{"1"})
+
+	assert.ErrorContains(t, err, "invalid token")
+}
@@ -0,0 +1,80 @@
+package deezerconverter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/matcher"
+)
+
+type track struct {
+	ID       int64  `json:"id"`
+	Title    string `json:"title"`
+	ISRC     string `json:"isrc"`
+	Duration int    `json:"duration"`
+	Artist   struct {
+		Name string `json:"name"`
+	} `json:"artist"`
+	// contributors are only returned when a single track is fetched
+	Contributors []struct {
+		Name string `json:"name"`
+	} `json:"contributors"`
+	Album struct {
+		Title   string `json:"title"`
+		CoverXL string `json:"cover_xl"`
+	} `json:"album"`
+}
+
+type apiError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("deezer %s (code %d): %s", e.Type, e.Code, e.Message)
+}
+
+func chunkBy[T any](items []T, chunkSize int) [][]T {
+	var chunks = make([][]T, 0, (len(items)/chunkSize)+1)
+	for chunkSize < len(items) {
+		items, chunks = items[chunkSize:], append(chunks, items[0:chunkSize:chunkSize])
+	}
+	return append(chunks, items)
+}
+
+func mapTrackToCandidate(track track, strategy model.MatchStrategy) model.TrackCandidate {
+	artistNames := []string{track.Artist.Name}
+	if len(track.Contributors) > 0 {
+		artistNames = make([]string, len(track.Contributors))
+		for i, contributor := range track.Contributors {
+			artistNames[i] = contributor.Name
+		}
+	}
+
+	return model.TrackCandidate{
+		ProviderTrackID: strconv.FormatInt(track.ID, 10),
+		Name:            track.Title,
+		ArtistNames:     artistNames,
+		AlbumName:       track.Album.Title,
+		Duration:        track.Duration * 1000,
+		ImageURL:        track.Album.CoverXL,
+		ISRC:            track.ISRC,
+		Strategy:        strategy,
+	}
+}
+
+// formatSearchQuery builds an advanced search query, which matches each field separately.
+func formatSearchQuery(song model.SongOutAPI) string {
+	queryParts := []string{fmt.Sprintf("track:%q", matcher.CleanTitle(song.Name))}
+	if len(song.ArtistNames) > 0 {
+		queryParts = append(queryParts, fmt.Sprintf("artist:%q", song.ArtistNames[0]))
+	}
+	if song.AlbumName != "" {
+		queryParts = append(queryParts, fmt.Sprintf("album:%q", song.AlbumName))
+	}
+
+	return strings.Join(queryParts, " ")
+}
@@ -1,5 +1,10 @@
 package spotifyconverter
 
+import (
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/zmb3/spotify/v2"
+)
+
 func chunkBy[T any](items []T, chunkSize int) [][]T {
 	var chunks = make([][]T, 0, (len(items)/chunkSize)+1)
 	for chunkSize < len(items) {
@@ -7,3 +12,47 @@ func chunkBy[T any](items []T, chunkSize int) [][]T {
 	}
 	return append(chunks, items)
 }
+
+func toSpotifyIDs(trackIDs []string) []spotify.ID {
+	IDs := make([]spotify.ID, len(trackIDs))
+	for i, trackID := range trackIDs {
+		IDs[i] = spotify.ID(trackID)
+	}
+	return IDs
+}
+
+func mapTrackToSong(track *spotify.FullTrack) model.SongInAPI {
+	artistNames := make([]string, len(track.Artists))
+	for i, artist := range track.Artists {
+		artistNames[i] = artist.Name
+	}
+
+	var imageURL string
+	if len(track.Album.Images) > 0 {
+		imageURL = track.Album.Images[0].URL
+	}
+
+	return model.SongInAPI{
+		Name:        track.Name,
+		ArtistNames: artistNames,
+		AlbumName:   track.Album.Name,
+		Duration:    int(track.Duration),
+		ImageURL:    imageURL,
+		ISRC:        track.ExternalIDs["isrc"],
+	}
+}
+
+func mapTrackToCandidate(track *spotify.FullTrack, strategy model.MatchStrategy) model.TrackCandidate {
+	song := mapTrackToSong(track)
+
+	return model.TrackCandidate{
+		ProviderTrackID: string(track.ID),
+		Name:            song.Name,
+		ArtistNames:     song.ArtistNames,
+		AlbumName:       song.AlbumName,
+		Duration:        song.Duration,
+		ImageURL:        song.ImageURL,
+		ISRC:            song.ISRC,
+		Strategy:        strategy,
+	}
+}
@@ -2,17 +2,22 @@ package spotifyconverter
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 
 	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/matcher"
 	"github.com/zmb3/spotify/v2"
 	spotifyauth "github.com/zmb3/spotify/v2/auth"
 	"golang.org/x/oauth2"
 )
 
+// candidateLimit is the number of search results the matcher picks from
+const candidateLimit = 5
+
 type SpotifyConverter struct {
 	client *spotify.Client
 }
@@ -33,41 +38,113 @@ func New(ctx context.Context, token *oauth2.Token) *SpotifyConverter {
 	return &SpotifyConverter{client: client}
 }
 
-func (s *SpotifyConverter) Export(ctx context.Context, playlistName string, songs []model.SongOutAPI) error {
+func (s *SpotifyConverter) CreatePlaylist(ctx context.Context, playlistName string, trackIDs []string) (string, error) {
 	playlistID, err := s.createPlaylist(ctx, playlistName)
 	if err != nil {
-		return fmt.Errorf("create playlist: %w", err)
+		return "", fmt.Errorf("create playlist: %w", err)
 	}
 
-	var tracksID []spotify.ID
-	for _, song := range songs {
-		searchQuery := s.formatSearchQuery(song)
-		log.Printf("spotify search query: %s", searchQuery)
+	err = s.AddTracks(ctx, playlistID, trackIDs)
+	if err != nil {
+		return playlistID, err
+	}
 
-		result, err := s.client.Search(
-			ctx,
-			searchQuery,
-			spotify.SearchTypeTrack,
-			spotify.Limit(1),
-		)
+	return playlistID, nil
+}
+
+// AddTracks appends the tracks to the end of the playlist.
+func (s *SpotifyConverter) AddTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error {
+	chunkedTracksID := chunkBy(toSpotifyIDs(trackIDs), 100)
+	for _, IDs := range chunkedTracksID {
+		_, err := s.client.AddTracksToPlaylist(ctx, spotify.ID(remotePlaylistID), IDs...)
 		if err != nil {
-			return fmt.Errorf("search for song in spotify: %w", err)
+			return fmt.Errorf("add track to playlist: %w", err)
 		}
-
-		tracksID = append(tracksID, result.Tracks.Tracks[0].ID)
 	}
 
-	chunkedTracksID := chunkBy(tracksID, 100)
+	return nil
+}
+
+// RemoveTracks removes every occurrence of the tracks from the playlist.
+func (s *SpotifyConverter) RemoveTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error {
+	chunkedTracksID := chunkBy(toSpotifyIDs(trackIDs), 100)
 	for _, IDs := range chunkedTracksID {
-		_, err = s.client.AddTracksToPlaylist(ctx, spotify.ID(playlistID), IDs...)
+		_, err := s.client.RemoveTracksFromPlaylist(ctx, spotify.ID(remotePlaylistID), IDs...)
 		if err != nil {
-			return fmt.Errorf("add track to playlist: %w", err)
+			return fmt.Errorf("remove track from playlist: %w", err)
 		}
 	}
 
 	return nil
 }
 
+func (s *SpotifyConverter) SearchAndMatch(ctx context.Context, song model.SongOutAPI) model.SongMatchResult {
+	candidates, err := s.SearchCandidates(ctx, song, candidateLimit)
+	if err != nil {
+		return model.SongMatchResult{
+			Song:   song,
+			Status: model.MatchStatusUnmatched,
+			Error:  err.Error(),
+		}
+	}
+
+	return matcher.Match(song, candidates)
+}
+
+// SearchCandidates returns up to limit tracks that could match the song, ISRC matches first.
+func (s *SpotifyConverter) SearchCandidates(ctx context.Context, song model.SongOutAPI, limit int) ([]model.TrackCandidate, error) {
+	var candidates []model.TrackCandidate
+	seen := make(map[spotify.ID]bool)
+
+	addTracks := func(tracks []spotify.FullTrack, strategy model.MatchStrategy) {
+		for i := range tracks {
+			if seen[tracks[i].ID] || len(candidates) >= limit {
+				continue
+			}
+			seen[tracks[i].ID] = true
+			candidates = append(candidates, mapTrackToCandidate(&tracks[i], strategy))
+		}
+	}
+
+	if song.ISRC != "" {
+		tracks, err := s.searchTracks(ctx, fmt.Sprintf("isrc:%s", song.ISRC), limit)
+		if err != nil {
+			return nil, err
+		}
+		addTracks(tracks, model.MatchStrategyISRC)
+	}
+
+	if len(candidates) < limit {
+		tracks, err := s.searchTracks(ctx, s.formatSearchQuery(song), limit)
+		if err != nil {
+			return nil, err
+		}
+		addTracks(tracks, model.MatchStrategyTextSearch)
+	}
+
+	return candidates, nil
+}
+
+func (s *SpotifyConverter) searchTracks(ctx context.Context, searchQuery string, limit int) ([]spotify.FullTrack, error) {
+	log.Printf("spotify search query: %s", searchQuery)
+
+	result, err := s.client.Search(
+		ctx,
+		searchQuery,
+		spotify.SearchTypeTrack,
+		spotify.Limit(limit),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("search for song in spotify: %w", err)
+	}
+
+	if result.Tracks == nil {
+		return nil, nil
+	}
+
+	return result.Tracks.Tracks, nil
+}
+
 func (s *SpotifyConverter) formatSearchQuery(song model.SongOutAPI) string {
 	artistQuery := make([]string, len(song.ArtistNames))
 	for i, artist := range song.ArtistNames {
@@ -75,17 +152,10 @@ func (s *SpotifyConverter) formatSearchQuery(song model.SongOutAPI) string {
 	}
 	artists := strings.Join(artistQuery, " ")
 
-	trackQuery := fmt.Sprintf("track:%s", song.Name)
+	trackQuery := fmt.Sprintf("track:%s", matcher.CleanTitle(song.Name))
 	albumQuery := fmt.Sprintf("album:%s", song.AlbumName)
-	isrcQuery := fmt.Sprintf("isrc:%s", song.ISRC)
-
-	var queryParts []string
-	if song.ISRC != "" {
-		queryParts = []string{isrcQuery}
 
-	} else {
-		queryParts = []string{trackQuery, artists, albumQuery}
-	}
+	queryParts := []string{trackQuery, artists, albumQuery}
 
 	return strings.Join(queryParts, " ")
 }
@@ -103,3 +173,149 @@ func (s *SpotifyConverter) createPlaylist(ctx context.Context, playlistName stri
 
 	return string(playlistDetail.ID), nil
 }
+
+func (s *SpotifyConverter) ListPlaylists(ctx context.Context) ([]model.RemotePlaylist, error) {
+	playlistPage, err := s.client.CurrentUsersPlaylists(ctx, spotify.Limit(50))
+	if err != nil {
+		return nil, fmt.Errorf("get current user playlists: %w", err)
+	}
+
+	var playlists []model.RemotePlaylist
+	for {
+		for _, playlist := range playlistPage.Playlists {
+			var imageURL string
+			if len(playlist.Images) > 0 {
+				imageURL = playlist.Images[0].URL
+			}
+
+			playlists = append(playlists, model.RemotePlaylist{
+				ID:          string(playlist.ID),
+				Name:        playlist.Name,
+				Description: playlist.Description,
+				ImageURL:    imageURL,
+			})
+		}
+
+		err = s.client.NextPage(ctx, playlistPage)
+		if errors.Is(err, spotify.ErrNoMorePages) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get next page of current user playlists: %w", err)
+		}
+	}
+
+	return playlists, nil
+}
+
+func (s *SpotifyConverter) Import(ctx context.Context, playlistID string) (model.ImportedPlaylist, error) {
+	playlist, err := s.client.GetPlaylist(ctx, spotify.ID(playlistID), spotify.Fields("name,description,images"))
+	if err != nil {
+		return model.ImportedPlaylist{}, fmt.Errorf("get spotify playlist: %w", err)
+	}
+
+	itemPage, err := s.client.GetPlaylistItems(ctx, spotify.ID(playlistID), spotify.Limit(100))
+	if err != nil {
+		return model.ImportedPlaylist{}, fmt.Errorf("get spotify playlist items: %w", err)
+	}
+
+	var songs []model.SongInAPI
+	for {
+		for _, item := range itemPage.Items {
+			// local files and podcast episodes can't be matched to the catalog
+			if item.IsLocal || item.Track.Track == nil {
+				continue
+			}
+
+			songs = append(songs, mapTrackToSong(item.Track.Track))
+		}
+
+		err = s.client.NextPage(ctx, itemPage)
+		if errors.Is(err, spotify.ErrNoMorePages) {
+			break
+		}
+		if err != nil {
+			return model.ImportedPlaylist{}, fmt.Errorf("get next page of spotify playlist items: %w", err)
+		}
+	}
+
+	var imageURL string
+	if len(playlist.Images) > 0 {
+		imageURL = playlist.Images[0].URL
+	}
+
+	return model.ImportedPlaylist{
+		Name:        playlist.Name,
+		Description: playlist.Description,
+		ImageURL:    imageURL,
+		Songs:       songs,
+	}, nil
+}
+
+// SnapshotID returns the version of the playlist, which changes every time the playlist is edited.
+func (s *SpotifyConverter) SnapshotID(ctx context.Context, remotePlaylistID string) (string, error) {
+	playlist, err := s.client.GetPlaylist(ctx, spotify.ID(remotePlaylistID), spotify.Fields("snapshot_id"))
+	if err != nil {
+		return "", fmt.Errorf("get spotify playlist snapshot: %w", err)
+	}
+
+	return playlist.SnapshotID, nil
+}
+
+// PlaylistTracks returns the version of the playlist and its tracks in order.
+func (s *SpotifyConverter) PlaylistTracks(ctx context.Context, remotePlaylistID string) (string, []model.RemoteTrack, error) {
+	snapshotID, err := s.SnapshotID(ctx, remotePlaylistID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	itemPage, err := s.client.GetPlaylistItems(ctx, spotify.ID(remotePlaylistID), spotify.Limit(100))
+	if err != nil {
+		return "", nil, fmt.Errorf("get spotify playlist items: %w", err)
+	}
+
+	var tracks []model.RemoteTrack
+	for {
+		for _, item := range itemPage.Items {
+			// local files and podcast episodes can't be matched to the catalog
+			if item.IsLocal || item.Track.Track == nil {
+				continue
+			}
+
+			tracks = append(tracks, model.RemoteTrack{
+				ProviderTrackID: string(item.Track.Track.ID),
+				Song:            mapTrackToSong(item.Track.Track),
+			})
+		}
+
+		err = s.client.NextPage(ctx, itemPage)
+		if errors.Is(err, spotify.ErrNoMorePages) {
+			break
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("get next page of spotify playlist items: %w", err)
+		}
+	}
+
+	return snapshotID, tracks, nil
+}
+
+// ReplaceTracks makes the playlist hold exactly the tracks, in order, and returns its new version.
+func (s *SpotifyConverter) ReplaceTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) (string, error) {
+	chunkedTracksID := chunkBy(toSpotifyIDs(trackIDs), 100)
+
+	// replacing is limited to 100 tracks so the rest is added after
+	err := s.client.ReplacePlaylistTracks(ctx, spotify.ID(remotePlaylistID), chunkedTracksID[0]...)
+	if err != nil {
+		return "", fmt.Errorf("replace playlist tracks: %w", err)
+	}
+
+	for _, IDs := range chunkedTracksID[1:] {
+		_, err = s.client.AddTracksToPlaylist(ctx, spotify.ID(remotePlaylistID), IDs...)
+		if err != nil {
+			return "", fmt.Errorf("add track to playlist: %w", err)
+		}
+	}
+
+	return s.SnapshotID(ctx, remotePlaylistID)
+}
@@ -0,0 +1,171 @@
+package tidalconverter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/matcher"
+)
+
+// document is a JSON:API response. Data is a single resource or a list depending on the endpoint.
+type document struct {
+	Data     json.RawMessage `json:"data"`
+	Included []resource      `json:"included"`
+	Links    struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+type requestDocument struct {
+	Data any `json:"data"`
+}
+
+type resource struct {
+	ID            string                  `json:"id"`
+	Type          string                  `json:"type"`
+	Attributes    json.RawMessage         `json:"attributes"`
+	Relationships map[string]relationship `json:"relationships"`
+}
+
+type relationship struct {
+	Data []resourceIdentifier `json:"data"`
+}
+
+type resourceIdentifier struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Meta *itemMeta `json:"meta,omitempty"`
+}
+
+// itemMeta identifies a track at one position of a playlist.
+type itemMeta struct {
+	ItemID string `json:"itemId"`
+}
+
+type newPlaylist struct {
+	Type       string             `json:"type"`
+	Attributes playlistAttributes `json:"attributes"`
+}
+
+type playlistAttributes struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	AccessType  string `json:"accessType"`
+}
+
+type trackAttributes struct {
+	Title    string `json:"title"`
+	Version  string `json:"version"`
+	ISRC     string `json:"isrc"`
+	Duration string `json:"duration"`
+}
+
+type artistAttributes struct {
+	Name string `json:"name"`
+}
+
+type albumAttributes struct {
+	Title      string `json:"title"`
+	ImageLinks []struct {
+		Href string `json:"href"`
+	} `json:"imageLinks"`
+}
+
+type apiError struct {
+	Status string `json:"status"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("tidal %s (status %s): %s", e.Code, e.Status, e.Detail)
+}
+
+func chunkBy[T any](items []T, chunkSize int) [][]T {
+	var chunks = make([][]T, 0, (len(items)/chunkSize)+1)
+	for chunkSize < len(items) {
+		items, chunks = items[chunkSize:], append(chunks, items[0:chunkSize:chunkSize])
+	}
+	return append(chunks, items)
+}
+
+func playlistItemsPath(playlistID string) string {
+	return "/playlists/" + url.PathEscape(playlistID) + "/relationships/items"
+}
+
+// nextPageCursor returns the cursor of the next page link, or an empty string on the last page.
+func nextPageCursor(next string) string {
+	if next == "" {
+		return ""
+	}
+
+	nextURL, err := url.Parse(next)
+	if err != nil {
+		return ""
+	}
+
+	return nextURL.Query().Get("page[cursor]")
+}
+
+// sortByIDs puts the tracks back in the order of the search results, which the API doesn't keep.
+func sortByIDs(tracks []model.TrackCandidate, trackIDs []string) []model.TrackCandidate {
+	tracksByID := make(map[string]model.TrackCandidate, len(tracks))
+	for _, track := range tracks {
+		tracksByID[track.ProviderTrackID] = track
+	}
+
+	sorted := make([]model.TrackCandidate, 0, len(tracks))
+	for _, trackID := range trackIDs {
+		if track, ok := tracksByID[trackID]; ok {
+			sorted = append(sorted, track)
+		}
+	}
+
+	return sorted
+}
+
+func mapTrackToCandidate(track resource, included []resource) (model.TrackCandidate, error) {
+	var attributes trackAttributes
+	err := json.Unmarshal(track.Attributes, &attributes)
+	if err != nil {
+		return model.TrackCandidate{}, fmt.Errorf("decode tidal track attributes: %w", err)
+	}
+
+	name := attributes.Title
+	if attributes.Version != "" {
+		name = fmt.Sprintf("%s (%s)", attributes.Title, attributes.Version)
+	}
+
+	candidate := model.TrackCandidate{
+		ProviderTrackID: track.ID,
+		Name:            name,
+		Duration:        matcher.ParseISODuration(attributes.Duration),
+		ISRC:            attributes.ISRC,
+	}
+
+	includedByKey := make(map[string]resource, len(included))
+	for _, includedResource := range included {
+		includedByKey[includedResource.Type+":"+includedResource.ID] = includedResource
+	}
+
+	for _, artistID := range track.Relationships["artists"].Data {
+		var artist artistAttributes
+		if err := json.Unmarshal(includedByKey["artists:"+artistID.ID].Attributes, &artist); err == nil && artist.Name != "" {
+			candidate.ArtistNames = append(candidate.ArtistNames, artist.Name)
+		}
+	}
+
+	if albums := track.Relationships["albums"].Data; len(albums) > 0 {
+		var album albumAttributes
+		if err := json.Unmarshal(includedByKey["albums:"+albums[0].ID].Attributes, &album); err == nil {
+			candidate.AlbumName = album.Title
+			if len(album.ImageLinks) > 0 {
+				candidate.ImageURL = album.ImageLinks[0].Href
+			}
+		}
+	}
+
+	return candidate, nil
+}
@@ -0,0 +1,182 @@
+package tidalconverter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/markbates/goth"
+	"golang.org/x/oauth2"
+)
+
+// Provider logs users in to TIDAL through goth, which has no TIDAL provider.
+// TIDAL requires PKCE, so the code verifier is kept in the session between the login and the callback.
+type Provider struct {
+	ClientKey    string
+	Secret       string
+	CallbackURL  string
+	HTTPClient   *http.Client
+	config       *oauth2.Config
+	providerName string
+}
+
+func NewProvider(clientKey string, secret string, callbackURL string, scopes ...string) *Provider {
+	p := &Provider{
+		ClientKey:    clientKey,
+		Secret:       secret,
+		CallbackURL:  callbackURL,
+		providerName: "tidal",
+	}
+	p.config = &oauth2.Config{
+		ClientID:     clientKey,
+		ClientSecret: secret,
+		RedirectURL:  callbackURL,
+		Endpoint:     Endpoint,
+		Scopes:       scopes,
+	}
+
+	return p
+}
+
+func (p *Provider) Name() string {
+	return p.providerName
+}
+
+func (p *Provider) SetName(name string) {
+	p.providerName = name
+}
+
+func (p *Provider) Client() *http.Client {
+	return goth.HTTPClientWithFallBack(p.HTTPClient)
+}
+
+func (p *Provider) Debug(debug bool) {}
+
+func (p *Provider) BeginAuth(state string) (goth.Session, error) {
+	verifier := oauth2.GenerateVerifier()
+
+	return &Session{
+		AuthURL:      p.config.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier)),
+		CodeVerifier: verifier,
+	}, nil
+}
+
+func (p *Provider) FetchUser(session goth.Session) (goth.User, error) {
+	sess := session.(*Session)
+	user := goth.User{
+		AccessToken:  sess.AccessToken,
+		RefreshToken: sess.RefreshToken,
+		ExpiresAt:    sess.ExpiresAt,
+		Provider:     p.Name(),
+	}
+
+	if user.AccessToken == "" {
+		return user, fmt.Errorf("%s cannot get user information without accessToken", p.providerName)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, apiURL()+"/users/me", nil)
+	if err != nil {
+		return user, err
+	}
+	req.Header.Set("Accept", mediaType)
+	req.Header.Set("Authorization", "Bearer "+sess.AccessToken)
+
+	res, err := p.Client().Do(req)
+	if err != nil {
+		return user, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return user, fmt.Errorf("%s responded with a %d trying to fetch user information", p.providerName, res.StatusCode)
+	}
+
+	var me struct {
+		Data struct {
+			ID         string `json:"id"`
+			Attributes struct {
+				Username string `json:"username"`
+				Email    string `json:"email"`
+				Country  string `json:"country"`
+			} `json:"attributes"`
+		} `json:"data"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&me)
+	if err != nil {
+		return user, err
+	}
+
+	user.UserID = me.Data.ID
+	user.NickName = me.Data.Attributes.Username
+	user.Name = me.Data.Attributes.Username
+	user.Email = me.Data.Attributes.Email
+	user.Location = me.Data.Attributes.Country
+
+	return user, nil
+}
+
+func (p *Provider) RefreshTokenAvailable() bool {
+	return true
+}
+
+func (p *Provider) RefreshToken(refreshToken string) (*oauth2.Token, error) {
+	token := &oauth2.Token{RefreshToken: refreshToken}
+	tokenSource := p.config.TokenSource(goth.ContextForClient(p.Client()), token)
+
+	return tokenSource.Token()
+}
+
+func (p *Provider) UnmarshalSession(data string) (goth.Session, error) {
+	sess := &Session{}
+	err := json.NewDecoder(strings.NewReader(data)).Decode(sess)
+	return sess, err
+}
+
+type Session struct {
+	AuthURL      string
+	CodeVerifier string
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+func (s Session) GetAuthURL() (string, error) {
+	if s.AuthURL == "" {
+		return "", errors.New(goth.NoAuthUrlErrorMessage)
+	}
+	return s.AuthURL, nil
+}
+
+func (s *Session) Authorize(provider goth.Provider, params goth.Params) (string, error) {
+	p := provider.(*Provider)
+
+	token, err := p.config.Exchange(
+		goth.ContextForClient(p.Client()),
+		params.Get("code"),
+		oauth2.VerifierOption(s.CodeVerifier),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	if !token.Valid() {
+		return "", errors.New("invalid token received from provider")
+	}
+
+	s.AccessToken = token.AccessToken
+	s.RefreshToken = token.RefreshToken
+	s.ExpiresAt = token.Expiry
+	return token.AccessToken, nil
+}
+
+func (s Session) Marshal() string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func (s Session) String() string {
+	return s.Marshal()
+}
@@ -0,0 +1,330 @@
+package tidalconverter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/matcher"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// candidateLimit is the number of search results the matcher picks from
+	candidateLimit = 5
+
+	defaultAPIURL = "https://openapi.tidal.com/v2"
+
+	// countryCode is the catalog tracks are searched in
+	countryCode = "VN"
+
+	// itemsLimit is the number of playlist items the API adds or removes per request
+	itemsLimit = 20
+
+	mediaType = "application/vnd.api+json"
+)
+
+// Scopes are the permissions needed to log in and export playlists.
+var Scopes = []string{"user.read", "search.read", "playlists.read", "playlists.write"}
+
+var Endpoint = oauth2.Endpoint{
+	AuthURL:  "https://login.tidal.com/authorize",
+	TokenURL: "https://auth.tidal.com/v1/oauth2/token",
+}
+
+type TidalConverter struct {
+	client *http.Client
+	apiURL string
+}
+
+// New creates a converter calling the TIDAL API, or the API at TIDAL_API_URL when it's set.
+func New(ctx context.Context, token *oauth2.Token) *TidalConverter {
+	config := &oauth2.Config{
+		ClientID:     os.Getenv("TIDAL_ID"),
+		ClientSecret: os.Getenv("TIDAL_SECRET"),
+		RedirectURL:  os.Getenv("TIDAL_REDIRECT_URL"),
+		Endpoint:     Endpoint,
+		Scopes:       Scopes,
+	}
+
+	return &TidalConverter{
+		client: config.Client(ctx, token),
+		apiURL: apiURL(),
+	}
+}
+
+func apiURL() string {
+	if apiURL := os.Getenv("TIDAL_API_URL"); apiURL != "" {
+		return strings.TrimSuffix(apiURL, "/")
+	}
+	return defaultAPIURL
+}
+
+func (t *TidalConverter) CreatePlaylist(ctx context.Context, playlistName string, trackIDs []string) (string, error) {
+	body := requestDocument{
+		Data: newPlaylist{
+			Type: "playlists",
+			Attributes: playlistAttributes{
+				Name:       playlistName,
+				AccessType: "UNLISTED",
+			},
+		},
+	}
+
+	var created document
+	err := t.do(ctx, http.MethodPost, "/playlists", url.Values{"countryCode": {countryCode}}, body, &created)
+	if err != nil {
+		return "", fmt.Errorf("create tidal playlist: %w", err)
+	}
+
+	var playlist resource
+	err = json.Unmarshal(created.Data, &playlist)
+	if err != nil {
+		return "", fmt.Errorf("decode created tidal playlist: %w", err)
+	}
+
+	err = t.AddTracks(ctx, playlist.ID, trackIDs)
+	if err != nil {
+		return playlist.ID, err
+	}
+
+	return playlist.ID, nil
+}
+
+// AddTracks appends the tracks to the end of the playlist.
+func (t *TidalConverter) AddTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error {
+	for _, IDs := range chunkBy(trackIDs, itemsLimit) {
+		if len(IDs) == 0 {
+			continue
+		}
+
+		items := make([]resourceIdentifier, len(IDs))
+		for i, ID := range IDs {
+			items[i] = resourceIdentifier{ID: ID, Type: "tracks"}
+		}
+
+		err := t.do(ctx, http.MethodPost, playlistItemsPath(remotePlaylistID), url.Values{"countryCode": {countryCode}}, requestDocument{Data: items}, nil)
+		if err != nil {
+			return fmt.Errorf("add track to tidal playlist: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RemoveTracks removes every occurrence of the tracks from the playlist.
+func (t *TidalConverter) RemoveTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error {
+	removed := make(map[string]bool, len(trackIDs))
+	for _, trackID := range trackIDs {
+		removed[trackID] = true
+	}
+
+	// items are removed by their ID in the playlist, so the same track can be removed from several positions
+	var items []resourceIdentifier
+	query := url.Values{"countryCode": {countryCode}}
+	for {
+		var page document
+		err := t.do(ctx, http.MethodGet, playlistItemsPath(remotePlaylistID), query, nil, &page)
+		if err != nil {
+			return fmt.Errorf("get tidal playlist items: %w", err)
+		}
+
+		var pageItems []resourceIdentifier
+		err = json.Unmarshal(page.Data, &pageItems)
+		if err != nil {
+			return fmt.Errorf("decode tidal playlist items: %w", err)
+		}
+		for _, item := range pageItems {
+			if removed[item.ID] {
+				items = append(items, item)
+			}
+		}
+
+		cursor := nextPageCursor(page.Links.Next)
+		if cursor == "" {
+			break
+		}
+		query.Set("page[cursor]", cursor)
+	}
+
+	for _, chunk := range chunkBy(items, itemsLimit) {
+		if len(chunk) == 0 {
+			continue
+		}
+
+		err := t.do(ctx, http.MethodDelete, playlistItemsPath(remotePlaylistID), nil, requestDocument{Data: chunk}, nil)
+		if err != nil {
+			return fmt.Errorf("remove track from tidal playlist: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (t *TidalConverter) SearchAndMatch(ctx context.Context, song model.SongOutAPI) model.SongMatchResult {
+	candidates, err := t.SearchCandidates(ctx, song, candidateLimit)
+	if err != nil {
+		return model.SongMatchResult{
+			Song:   song,
+			Status: model.MatchStatusUnmatched,
+			Error:  err.Error(),
+		}
+	}
+
+	return matcher.Match(song, candidates)
+}
+
+// SearchCandidates returns up to limit tracks that could match the song, ISRC matches first.
+func (t *TidalConverter) SearchCandidates(ctx context.Context, song model.SongOutAPI, limit int) ([]model.TrackCandidate, error) {
+	var candidates []model.TrackCandidate
+	seen := make(map[string]bool)
+
+	addTracks := func(tracks []model.TrackCandidate, strategy model.MatchStrategy) {
+		for _, track := range tracks {
+			if seen[track.ProviderTrackID] || len(candidates) >= limit {
+				continue
+			}
+			seen[track.ProviderTrackID] = true
+			track.Strategy = strategy
+			candidates = append(candidates, track)
+		}
+	}
+
+	if song.ISRC != "" {
+		tracks, err := t.getTracks(ctx, url.Values{"filter[isrc]": {song.ISRC}})
+		if err != nil {
+			return nil, fmt.Errorf("get tidal tracks by ISRC: %w", err)
+		}
+		addTracks(tracks, model.MatchStrategyISRC)
+	}
+
+	if len(candidates) < limit {
+		searchQuery := fmt.Sprintf("%s %s", matcher.CleanTitle(song.Name), strings.Join(song.ArtistNames, " "))
+		log.Printf("tidal search query: %s", searchQuery)
+
+		var result document
+		err := t.do(ctx, http.MethodGet, "/searchResults/"+url.PathEscape(searchQuery)+"/relationships/tracks", url.Values{"countryCode": {countryCode}}, nil, &result)
+		if err != nil {
+			return nil, fmt.Errorf("search for song in tidal: %w", err)
+		}
+
+		var found []resourceIdentifier
+		err = json.Unmarshal(result.Data, &found)
+		if err != nil {
+			return nil, fmt.Errorf("decode tidal search results: %w", err)
+		}
+
+		// search results are only identifiers, the artists and album come with the tracks
+		var trackIDs []string
+		for _, track := range found {
+			if len(trackIDs) >= limit {
+				break
+			}
+			trackIDs = append(trackIDs, track.ID)
+		}
+
+		if len(trackIDs) > 0 {
+			tracks, err := t.getTracks(ctx, url.Values{"filter[id]": trackIDs})
+			if err != nil {
+				return nil, fmt.Errorf("get tidal tracks: %w", err)
+			}
+			addTracks(sortByIDs(tracks, trackIDs), model.MatchStrategyTextSearch)
+		}
+	}
+
+	return candidates, nil
+}
+
+func (t *TidalConverter) getTracks(ctx context.Context, filter url.Values) ([]model.TrackCandidate, error) {
+	query := url.Values{
+		"countryCode": {countryCode},
+		"include":     {"artists,albums"},
+	}
+	for key, values := range filter {
+		query[key] = values
+	}
+
+	var result document
+	err := t.do(ctx, http.MethodGet, "/tracks", query, nil, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []resource
+	err = json.Unmarshal(result.Data, &tracks)
+	if err != nil {
+		return nil, fmt.Errorf("decode tidal tracks: %w", err)
+	}
+
+	candidates := make([]model.TrackCandidate, 0, len(tracks))
+	for _, track := range tracks {
+		candidate, err := mapTrackToCandidate(track, result.Included)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates, nil
+}
+
+// do calls the API with a JSON:API body when it isn't nil, and decodes the response into out when it isn't nil.
+func (t *TidalConverter) do(ctx context.Context, method string, path string, query url.Values, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(encoded)
+	}
+
+	reqURL := t.apiURL + path
+	if len(query) > 0 {
+		reqURL += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, reqBody)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", mediaType)
+	if body != nil {
+		req.Header.Set("Content-Type", mediaType)
+	}
+
+	res, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		var errorBody struct {
+			Errors []apiError `json:"errors"`
+		}
+		if json.NewDecoder(res.Body).Decode(&errorBody) == nil && len(errorBody.Errors) > 0 {
+			return &errorBody.Errors[0]
+		}
+		return fmt.Errorf("tidal responded with status %d", res.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(res.Body).Decode(out)
+	if err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	return nil
+}
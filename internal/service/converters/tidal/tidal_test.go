@@ -0,0 +1,195 @@
+package tidalconverter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/converters/convertertest"
+)
+
+func newTestConverter(t *testing.T, handler http.Handler) *TidalConverter {
+	convertertest.Serve(t, handler, "TIDAL_API_URL", "")
+
+	return New(context.Background(), convertertest.Token())
+}
+
+const tracksResponse = `{
+	"data": [
+		{"id": "2", "type": "tracks", "attributes": {"title": "Runaway", "version": "Live", "duration": "PT10M"},
+			"relationships": {"artists": {"data": [{"id": "a1", "type": "artists"}]}}},
+		{"id": "1", "type": "tracks", "attributes": {"title": "Runaway", "isrc": "USUM71027417", "duration": "PT9M8S"},
+			"relationships": {"artists": {"data": [{"id": "a1", "type": "artists"}, {"id": "a2", "type": "artists"}]},
+				"albums": {"data": [{"id": "b1", "type": "albums"}]}}}
+	],
+	"included": [
+		{"id": "a1", "type": "artists", "attributes": {"name": "Kanye West"}},
+		{"id": "a2", "type": "artists", "attributes": {"name": "Pusha T"}},
+		{"id": "b1", "type": "albums", "attributes": {"title": "My Beautiful Dark Twisted Fantasy", "imageLinks": [{"href": "cover"}]}}
+	]
+}`
+
+func TestSearchCandidates(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tracks", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer "+convertertest.AccessToken, r.Header.Get("Authorization"))
+		assert.Equal(t, countryCode, r.URL.Query().Get("countryCode"))
+
+		if r.URL.Query().Get("filter[isrc]") == convertertest.ISRC {
+			convertertest.WriteJSON(t, w, `{"data": [{"id": "1", "type": "tracks", "attributes": {"title": "Runaway", "isrc": "USUM71027417", "duration": "PT9M8S"}}]}`)
+			return
+		}
+
+		assert.Equal(t, []string{"1", "2"}, r.URL.Query()["filter[id]"])
+		convertertest.WriteJSON(t, w, tracksResponse)
+	})
+	mux.HandleFunc("GET /searchResults/{query}/relationships/tracks", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Runaway Kanye West", r.PathValue("query"))
+		convertertest.WriteJSON(t, w, `{"data": [{"id": "1", "type": "tracks"}, {"id": "2", "type": "tracks"}]}`)
+	})
+
+	converter := newTestConverter(t, mux)
+
+	candidates, err := converter.SearchCandidates(context.Background(), convertertest.Song(), candidateLimit)
+
+	require.NoError(t, err)
+	assert.Equal(t, []model.TrackCandidate{
+		{
+			ProviderTrackID: "1",
+			Name:            "Runaway",
+			Duration:        548000,
+			ISRC:            convertertest.ISRC,
+			Strategy:        model.MatchStrategyISRC,
+		},
+		{
+			ProviderTrackID: "2",
+			Name:            "Runaway (Live)",
+			ArtistNames:     []string{"Kanye West"},
+			Duration:        600000,
+			Strategy:        model.MatchStrategyTextSearch,
+		},
+	}, candidates)
+}
+
+func TestGetTracks(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tracks", func(w http.ResponseWriter, r *http.Request) {
+		convertertest.WriteJSON(t, w, tracksResponse)
+	})
+
+	converter := newTestConverter(t, mux)
+
+	tracks, err := converter.getTracks(context.Background(), nil)
+
+	require.NoError(t, err)
+	require.Len(t, tracks, 2)
+	assert.Equal(t, model.TrackCandidate{
+		ProviderTrackID: "1",
+		Name:            "Runaway",
+		ArtistNames:     []string{"Kanye West", "Pusha T"},
+		AlbumName:       "My Beautiful Dark Twisted Fantasy",
+		Duration:        548000,
+		ImageURL:        "cover",
+		ISRC:            convertertest.ISRC,
+	}, tracks[1])
+}
+
+func TestCreatePlaylist(t *testing.T) {
+	var addedChunks [][]resourceIdentifier
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /playlists", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Data newPlaylist `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "Road trip", body.Data.Attributes.Name)
+		assert.Equal(t, "UNLISTED", body.Data.Attributes.AccessType)
+
+		w.WriteHeader(http.StatusCreated)
+		convertertest.WriteJSON(t, w, `{"data": {"id": "PL123", "type": "playlists"}}`)
+	})
+	mux.HandleFunc("POST /playlists/PL123/relationships/items", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, mediaType, r.Header.Get("Content-Type"))
+
+		var body struct {
+			Data []resourceIdentifier `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		addedChunks = append(addedChunks, body.Data)
+
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	converter := newTestConverter(t, mux)
+
+	trackIDs := make([]string, 25)
+	for i := range trackIDs {
+		trackIDs[i] = "1"
+	}
+
+	playlistID, err := converter.CreatePlaylist(context.Background(), "Road trip", trackIDs)
+
+	require.NoError(t, err)
+	assert.Equal(t, "PL123", playlistID)
+	require.Len(t, addedChunks, 2)
+	assert.Len(t, addedChunks[0], itemsLimit)
+	assert.Equal(t, resourceIdentifier{ID: "1", Type: "tracks"}, addedChunks[1][0])
+}
+
+func TestRemoveTracks(t *testing.T) {
+	var removed []resourceIdentifier
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /playlists/PL123/relationships/items", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page[cursor]") == "" {
+			convertertest.WriteJSON(t, w, `{
+				"data": [{"id": "1", "type": "tracks", "meta": {"itemId": "i1"}}, {"id": "2", "type": "tracks", "meta": {"itemId": "i2"}}],
+				"links": {"next": "/playlists/PL123/relationships/items?countryCode=VN&page%5Bcursor%5D=abc"}
+			}`)
+			return
+		}
+
+		assert.Equal(t, "abc", r.URL.Query().Get("page[cursor]"))
+		convertertest.WriteJSON(t, w, `{"data": [{"id": "1", "type": "tracks", "meta": {"itemId": "i3"}}], "links": {}}`)
+	})
+	mux.HandleFunc("DELETE /playlists/PL123/relationships/items", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Data []resourceIdentifier `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		removed = append(removed, body.Data...)
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	converter := newTestConverter(t, mux)
+
+	err := converter.RemoveTracks(context.Background(), "PL123", []string{"1"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []resourceIdentifier{
+		{ID: "1", Type: "tracks", Meta: &itemMeta{ItemID: "i1"}},
+		{ID: "1", Type: "tracks", Meta: &itemMeta{ItemID: "i3"}},
+	}, removed)
+}
+
+func TestAPIError(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /playlists/PL123/relationships/items", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		convertertest.WriteJSON(t, w, `{"errors": [{"status": "403", "code": "FORBIDDEN", "detail": "missing scope"}]}`)
+	})
+
+	converter := newTestConverter(t, mux)
+
+	err := converter.AddTracks(context.Background(), "PL123", []string{"1"})
+
+	var apiErr *apiError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "missing scope", apiErr.Detail)
+}
@@ -0,0 +1,54 @@
+package youtubemusicconverter
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/matcher"
+	"google.golang.org/api/youtube/v3"
+)
+
+var (
+	// YouTube Music tracks are uploaded by an auto-generated "<artist> - Topic" channel
+	topicChannelSuffix = " - Topic"
+
+	videoNoisePattern = regexp.MustCompile(`(?i)\s*[\(\[](official\s+(music\s+)?(video|audio|lyric\s+video|visualizer)|lyrics?(\s+video)?|audio|hd|4k|mv)[\)\]]`)
+)
+
+func mapVideoToCandidate(video *youtube.Video) model.TrackCandidate {
+	candidate := model.TrackCandidate{
+		ProviderTrackID: video.Id,
+		Strategy:        model.MatchStrategyTextSearch,
+	}
+
+	if video.Snippet != nil {
+		candidate.Name, candidate.ArtistNames = splitVideoTitle(video.Snippet.Title, video.Snippet.ChannelTitle)
+
+		if thumbnails := video.Snippet.Thumbnails; thumbnails != nil && thumbnails.High != nil {
+			candidate.ImageURL = thumbnails.High.Url
+		}
+	}
+
+	if video.ContentDetails != nil {
+		candidate.Duration = matcher.ParseISODuration(video.ContentDetails.Duration)
+	}
+
+	return candidate
+}
+
+// splitVideoTitle returns the song name and artists of a video. Topic channels are named after the
+// artist, other music videos usually follow the "Artist - Title (Official Video)" convention.
+func splitVideoTitle(title string, channelTitle string) (string, []string) {
+	title = strings.TrimSpace(videoNoisePattern.ReplaceAllString(title, ""))
+
+	if artist, ok := strings.CutSuffix(channelTitle, topicChannelSuffix); ok {
+		return title, []string{artist}
+	}
+
+	if artist, name, ok := strings.Cut(title, " - "); ok {
+		return strings.TrimSpace(name), []string{strings.TrimSpace(artist)}
+	}
+
+	return title, []string{channelTitle}
+}
@@ -0,0 +1,188 @@
+package youtubemusicconverter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/matcher"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+	"google.golang.org/api/youtube/v3"
+)
+
+const (
+	// candidateLimit is the number of search results the matcher picks from
+	candidateLimit = 5
+
+	// musicCategoryID is the YouTube video category of music videos and YouTube Music tracks
+	musicCategoryID = "10"
+
+	Scope = youtube.YoutubeScope
+)
+
+type YouTubeMusicConverter struct {
+	service *youtube.Service
+}
+
+// New creates a converter calling the YouTube Data API, or the API at YOUTUBE_API_URL when it's set.
+func New(ctx context.Context, token *oauth2.Token) (*YouTubeMusicConverter, error) {
+	config := &oauth2.Config{
+		ClientID:     os.Getenv("YOUTUBE_MUSIC_ID"),
+		ClientSecret: os.Getenv("YOUTUBE_MUSIC_SECRET"),
+		RedirectURL:  os.Getenv("YOUTUBE_MUSIC_REDIRECT_URL"),
+		Endpoint:     google.Endpoint,
+		Scopes:       []string{Scope},
+	}
+
+	opts := []option.ClientOption{option.WithHTTPClient(config.Client(ctx, token))}
+	if apiURL := os.Getenv("YOUTUBE_API_URL"); apiURL != "" {
+		opts = append(opts, option.WithEndpoint(apiURL))
+	}
+
+	service, err := youtube.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create youtube service: %w", err)
+	}
+
+	return &YouTubeMusicConverter{service: service}, nil
+}
+
+func (y *YouTubeMusicConverter) CreatePlaylist(ctx context.Context, playlistName string, trackIDs []string) (string, error) {
+	playlist, err := y.service.Playlists.Insert([]string{"snippet", "status"}, &youtube.Playlist{
+		Snippet: &youtube.PlaylistSnippet{Title: playlistName},
+		Status:  &youtube.PlaylistStatus{PrivacyStatus: "private"},
+	}).Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("create youtube playlist: %w", err)
+	}
+
+	err = y.AddTracks(ctx, playlist.Id, trackIDs)
+	if err != nil {
+		return playlist.Id, err
+	}
+
+	return playlist.Id, nil
+}
+
+// AddTracks appends the videos to the end of the playlist. The API adds one video per request.
+func (y *YouTubeMusicConverter) AddTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error {
+	for _, trackID := range trackIDs {
+		_, err := y.service.PlaylistItems.Insert([]string{"snippet"}, &youtube.PlaylistItem{
+			Snippet: &youtube.PlaylistItemSnippet{
+				PlaylistId: remotePlaylistID,
+				ResourceId: &youtube.ResourceId{
+					Kind:    "youtube#video",
+					VideoId: trackID,
+				},
+			},
+		}).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("add video %s to youtube playlist: %w", trackID, err)
+		}
+	}
+
+	return nil
+}
+
+// RemoveTracks removes every occurrence of the videos from the playlist.
+func (y *YouTubeMusicConverter) RemoveTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error {
+	removed := make(map[string]bool, len(trackIDs))
+	for _, trackID := range trackIDs {
+		removed[trackID] = true
+	}
+
+	var itemIDs []string
+	err := y.service.PlaylistItems.List([]string{"snippet"}).
+		PlaylistId(remotePlaylistID).
+		MaxResults(50).
+		Pages(ctx, func(res *youtube.PlaylistItemListResponse) error {
+			for _, item := range res.Items {
+				if item.Snippet != nil && item.Snippet.ResourceId != nil && removed[item.Snippet.ResourceId.VideoId] {
+					itemIDs = append(itemIDs, item.Id)
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return fmt.Errorf("list youtube playlist items: %w", err)
+	}
+
+	for _, itemID := range itemIDs {
+		err := y.service.PlaylistItems.Delete(itemID).Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("remove item %s from youtube playlist: %w", itemID, err)
+		}
+	}
+
+	return nil
+}
+
+func (y *YouTubeMusicConverter) SearchAndMatch(ctx context.Context, song model.SongOutAPI) model.SongMatchResult {
+	candidates, err := y.SearchCandidates(ctx, song, candidateLimit)
+	if err != nil {
+		return model.SongMatchResult{
+			Song:   song,
+			Status: model.MatchStatusUnmatched,
+			Error:  err.Error(),
+		}
+	}
+
+	return matcher.Match(song, candidates)
+}
+
+// SearchCandidates returns up to limit music videos that could match the song.
+// YouTube has no ISRC lookup so every candidate comes from a text search.
+func (y *YouTubeMusicConverter) SearchCandidates(ctx context.Context, song model.SongOutAPI, limit int) ([]model.TrackCandidate, error) {
+	searchQuery := fmt.Sprintf("%s %s", matcher.CleanTitle(song.Name), strings.Join(song.ArtistNames, " "))
+
+	log.Printf("youtube music search query: %s", searchQuery)
+
+	searchResult, err := y.service.Search.List([]string{"snippet"}).
+		Q(searchQuery).
+		Type("video").
+		VideoCategoryId(musicCategoryID).
+		MaxResults(int64(limit)).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("search for song in youtube: %w", err)
+	}
+
+	var videoIDs []string
+	for _, item := range searchResult.Items {
+		if item.Id != nil && item.Id.VideoId != "" {
+			videoIDs = append(videoIDs, item.Id.VideoId)
+		}
+	}
+	if len(videoIDs) == 0 {
+		return nil, nil
+	}
+
+	// search results don't have the duration, which the matcher relies on without an ISRC
+	videos, err := y.service.Videos.List([]string{"snippet", "contentDetails"}).
+		Id(videoIDs...).
+		Context(ctx).
+		Do()
+	if err != nil {
+		return nil, fmt.Errorf("get youtube videos: %w", err)
+	}
+
+	videosByID := make(map[string]*youtube.Video, len(videos.Items))
+	for _, video := range videos.Items {
+		videosByID[video.Id] = video
+	}
+
+	candidates := make([]model.TrackCandidate, 0, len(videoIDs))
+	for _, videoID := range videoIDs {
+		if video, ok := videosByID[videoID]; ok {
+			candidates = append(candidates, mapVideoToCandidate(video))
+		}
+	}
+
+	return candidates, nil
+}
@@ -0,0 +1,178 @@
+package youtubemusicconverter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/converters/convertertest"
+)
+
+func newTestConverter(t *testing.T, handler http.Handler) *YouTubeMusicConverter {
+	convertertest.Serve(t, handler, "YOUTUBE_API_URL", "/")
+
+	converter, err := New(context.Background(), convertertest.Token())
+	require.NoError(t, err)
+
+	return converter
+}
+
+func TestSearchCandidates(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /youtube/v3/search", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer "+convertertest.AccessToken, r.Header.Get("Authorization"))
+		assert.Equal(t, "Runaway Kanye West", r.URL.Query().Get("q"))
+		assert.Equal(t, "video", r.URL.Query().Get("type"))
+		assert.Equal(t, musicCategoryID, r.URL.Query().Get("videoCategoryId"))
+
+		convertertest.WriteJSON(t, w, `{"items": [{"id": {"videoId": "topic"}}, {"id": {"videoId": "mv"}}]}`)
+	})
+	mux.HandleFunc("GET /youtube/v3/videos", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, []string{"topic", "mv"}, r.URL.Query()["id"])
+
+		convertertest.WriteJSON(t, w, `{"items": [
+			{"id": "mv", "snippet": {"title": "Kanye West - Runaway (Official Music Video)", "channelTitle": "KanyeWestVEVO"}, "contentDetails": {"duration": "PT9M7S"}},
+			{"id": "topic", "snippet": {"title": "Runaway", "channelTitle": "Kanye West - Topic"}, "contentDetails": {"duration": "PT9M8S"}}
+		]}`)
+	})
+
+	converter := newTestConverter(t, mux)
+
+	candidates, err := converter.SearchCandidates(context.Background(), convertertest.Song(), candidateLimit)
+
+	require.NoError(t, err)
+	assert.Equal(t, []model.TrackCandidate{
+		{
+			ProviderTrackID: "topic",
+			Name:            "Runaway",
+			ArtistNames:     []string{"Kanye West"},
+			Duration:        548000,
+			Strategy:        model.MatchStrategyTextSearch,
+		},
+		{
+			ProviderTrackID: "mv",
+			Name:            "Runaway",
+			ArtistNames:     []string{"Kanye West"},
+			Duration:        547000,
+			Strategy:        model.MatchStrategyTextSearch,
+		},
+	}, candidates)
+}
+
+func TestCreatePlaylist(t *testing.T) {
+	var addedVideoIDs []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /youtube/v3/playlists", func(w http.ResponseWriter, r *http.Request) {
+		var playlist struct {
+			Snippet struct {
+				Title string `json:"title"`
+			} `json:"snippet"`
+			Status struct {
+				PrivacyStatus string `json:"privacyStatus"`
+			} `json:"status"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&playlist))
+		assert.Equal(t, "Road trip", playlist.Snippet.Title)
+		assert.Equal(t, "private", playlist.Status.PrivacyStatus)
+
+		convertertest.WriteJSON(t, w, `{"id": "PL123"}`)
+	})
+	mux.HandleFunc("POST /youtube/v3/playlistItems", func(w http.ResponseWriter, r *http.Request) {
+		var item struct {
+			Snippet struct {
+				PlaylistID string `json:"playlistId"`
+				ResourceID struct {
+					VideoID string `json:"videoId"`
+				} `json:"resourceId"`
+			} `json:"snippet"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&item))
+		assert.Equal(t, "PL123", item.Snippet.PlaylistID)
+		addedVideoIDs = append(addedVideoIDs, item.Snippet.ResourceID.VideoID)
+
+		convertertest.WriteJSON(t, w, `{"id": "item"}`)
+	})
+
+	converter := newTestConverter(t, mux)
+
+	playlistID, err := converter.CreatePlaylist(context.Background(), "Road trip", []string{"a", "b"})
+
+	require.NoError(t, err)
+	assert.Equal(t, "PL123", playlistID)
+	assert.Equal(t, []string{"a", "b"}, addedVideoIDs)
+}
+
+func TestRemoveTracks(t *testing.T) {
+	var deletedItemIDs []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /youtube/v3/playlistItems", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PL123", r.URL.Query().Get("playlistId"))
+
+		if r.URL.Query().Get("pageToken") == "" {
+			convertertest.WriteJSON(t, w, `{"nextPageToken": "next", "items": [
+				{"id": "item1", "snippet": {"resourceId": {"videoId": "a"}}},
+				{"id": "item2", "snippet": {"resourceId": {"videoId": "b"}}}
+			]}`)
+			return
+		}
+		convertertest.WriteJSON(t, w, `{"items": [{"id": "item3", "snippet": {"resourceId": {"videoId": "a"}}}]}`)
+	})
+	mux.HandleFunc("DELETE /youtube/v3/playlistItems", func(w http.ResponseWriter, r *http.Request) {
+		deletedItemIDs = append(deletedItemIDs, r.URL.Query().Get("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	converter := newTestConverter(t, mux)
+
+	err := converter.RemoveTracks(context.Background(), "PL123", []string{"a"})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"item1", "item3"}, deletedItemIDs)
+}
+
+func TestSplitVideoTitle(t *testing.T) {
+	tests := []struct {
+		name         string
+		title        string
+		channelTitle string
+		wantName     string
+		wantArtists  []string
+	}{
+		{
+			name:         "topic channel",
+			title:        "Runaway",
+			channelTitle: "Kanye West - Topic",
+			wantName:     "Runaway",
+			wantArtists:  []string{"Kanye West"},
+		},
+		{
+			name:         "artist in title",
+			title:        "Kanye West - Runaway (Official Music Video)",
+			channelTitle: "KanyeWestVEVO",
+			wantName:     "Runaway",
+			wantArtists:  []string{"Kanye West"},
+		},
+		{
+			name:         "channel is the artist",
+			title:        "Runaway [Lyrics]",
+			channelTitle: "Kanye West",
+			wantName:     "Runaway",
+			wantArtists:  []string{"Kanye West"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, artists := splitVideoTitle(tt.title, tt.channelTitle)
+
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.wantArtists, artists)
+		})
+	}
+}
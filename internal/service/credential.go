@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/markbates/goth"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"golang.org/x/oauth2"
+)
+
+// tokens are refreshed a bit before they expire so they don't expire in the middle of a request
+const tokenRefreshMargin = time.Minute
+
+type ProviderCredentialRepository interface {
+	Select(ctx context.Context, userID string, provider string) (model.ProviderCredential, bool, error)
+	SelectProviders(ctx context.Context, userID string) ([]string, error)
+	Save(ctx context.Context, credential model.ProviderCredential) error
+	// Refresh locks the credential while refresh runs and saves the token it returns, unless it's nil.
+	Refresh(
+		ctx context.Context,
+		userID string,
+		provider string,
+		refresh func(credential model.ProviderCredential) (*oauth2.Token, error),
+	) (*oauth2.Token, bool, error)
+	Delete(ctx context.Context, userID string, provider string) error
+}
+
+// CredentialService keeps users logged in to OAuth providers, refreshing their tokens when they expire.
+type CredentialService struct {
+	credentialRepo ProviderCredentialRepository
+	providers      *ProviderRegistry
+}
+
+func NewCredential(credentialRepo ProviderCredentialRepository, providers *ProviderRegistry) *CredentialService {
+	return &CredentialService{
+		credentialRepo: credentialRepo,
+		providers:      providers,
+	}
+}
+
+// Connect stores the token the user logged in to the provider with.
+func (c *CredentialService) Connect(ctx context.Context, userID string, user goth.User) error {
+	return c.credentialRepo.Save(ctx, model.ProviderCredential{
+		UserID:         userID,
+		Provider:       user.Provider,
+		ProviderUserID: user.UserID,
+		Token: &oauth2.Token{
+			AccessToken:  user.AccessToken,
+			RefreshToken: user.RefreshToken,
+			Expiry:       user.ExpiresAt,
+		},
+	})
+}
+
+func (c *CredentialService) Disconnect(ctx context.Context, userID string, provider string) error {
+	return c.credentialRepo.Delete(ctx, userID, provider)
+}
+
+// ConnectedProviders returns the providers the user is logged in to.
+func (c *CredentialService) ConnectedProviders(ctx context.Context, userID string) ([]string, error) {
+	return c.credentialRepo.SelectProviders(ctx, userID)
+}
+
+// Token returns the token of the user for the provider, refreshed when it's about to expire.
+// It returns model.ErrProviderNotConnected when the user never logged in to the provider.
+func (c *CredentialService) Token(ctx context.Context, userID string, provider string) (*oauth2.Token, error) {
+	credential, found, err := c.credentialRepo.Select(ctx, userID, provider)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, model.ErrProviderNotConnected
+	}
+
+	if !tokenNeedsRefresh(credential.Token, time.Now()) {
+		return credential.Token, nil
+	}
+
+	token, found, err := c.credentialRepo.Refresh(ctx, userID, provider, func(credential model.ProviderCredential) (*oauth2.Token, error) {
+		// another request may have refreshed the token while this one waited for the lock
+		if !tokenNeedsRefresh(credential.Token, time.Now()) {
+			return nil, nil
+		}
+
+		// tokens that can't be refreshed are used until the provider rejects them
+		oauthProvider, ok := c.providers.OAuthProvider(provider)
+		if !ok || !oauthProvider.RefreshTokenAvailable() || credential.Token.RefreshToken == "" {
+			return nil, nil
+		}
+
+		token, err := oauthProvider.RefreshToken(credential.Token.RefreshToken)
+		if err != nil {
+			return nil, fmt.Errorf("refreshing %s token: %w", provider, err)
+		}
+
+		// providers that don't rotate refresh tokens leave it out of the response
+		if token.RefreshToken == "" {
+			token.RefreshToken = credential.Token.RefreshToken
+		}
+
+		return token, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, model.ErrProviderNotConnected
+	}
+
+	return token, nil
+}
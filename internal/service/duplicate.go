@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type DuplicateRepository interface {
+	GetAll(ctx context.Context, playlistID int, sortBy string, sortOrder string) ([]model.SongOutAPI, error)
+	GetAllOfUser(ctx context.Context, userID string) (map[int][]model.SongOutAPI, error)
+	Rewrite(
+		ctx context.Context,
+		playlistID int,
+		addedBy string,
+		change model.PlaylistChange,
+		rewrite func(songs []model.SongOutAPI) ([]int, error),
+	) error
+}
+
+type DuplicateService struct {
+	playlistSongRepo DuplicateRepository
+}
+
+func NewDuplicate(playlistSongRepo DuplicateRepository) *DuplicateService {
+	return &DuplicateService{
+		playlistSongRepo: playlistSongRepo,
+	}
+}
+
+// FindInPlaylist returns the songs of the playlist that are versions of the same recording.
+func (d *DuplicateService) FindInPlaylist(ctx context.Context, playlistID int, query model.DuplicateQuery) ([]model.DuplicateGroup, error) {
+	songs, err := d.playlistSongRepo.GetAll(ctx, playlistID, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	groups, _ := d.find(songs, nil, query)
+	return groups, nil
+}
+
+// FindAcrossPlaylists returns the different versions of the same recording in the playlists of the user,
+// with the playlists every version is in.
+func (d *DuplicateService) FindAcrossPlaylists(ctx context.Context, userID string, query model.DuplicateQuery) ([]model.DuplicateGroup, error) {
+	songsByPlaylist, err := d.playlistSongRepo.GetAllOfUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	playlistIDs := make([]int, 0, len(songsByPlaylist))
+	for playlistID := range songsByPlaylist {
+		playlistIDs = append(playlistIDs, playlistID)
+	}
+	slices.Sort(playlistIDs)
+
+	// the same song in several playlists is not a duplicate, every song is looked at once
+	var songs []model.SongOutAPI
+	songPlaylists := make(map[int][]int)
+	for _, playlistID := range playlistIDs {
+		for _, song := range songsByPlaylist[playlistID] {
+			if _, ok := songPlaylists[song.ID]; !ok {
+				songs = append(songs, song)
+			}
+			songPlaylists[song.ID] = append(songPlaylists[song.ID], playlistID)
+		}
+	}
+
+	groups, _ := d.find(songs, songPlaylists, query)
+	return groups, nil
+}
+
+// Dedupe removes every version of a song but the preferred one from the playlist.
+// The preferred version takes the place of the first version in the playlist.
+// The songs are read and changed in one transaction.
+func (d *DuplicateService) Dedupe(ctx context.Context, playlistID int, query model.DuplicateQuery) (model.DedupeResult, error) {
+	var result model.DedupeResult
+	err := d.playlistSongRepo.Rewrite(ctx, playlistID, "", model.PlaylistChangeDeduplicated, func(songs []model.SongOutAPI) ([]int, error) {
+		groups, found := d.find(songs, nil, query)
+		result = model.DedupeResult{
+			Groups:         groups,
+			RemovedSongIDs: []int{},
+		}
+
+		preferred := make([]int, len(found))
+		for i, group := range found {
+			preferred[i] = preferredDuplicate(songs, group.indices, query.Prefer)
+		}
+
+		order, removed := dedupeOrder(songs, found, preferred)
+		if len(removed) > 0 {
+			result.RemovedSongIDs = removed
+		}
+
+		return order, nil
+	})
+	if err != nil {
+		return model.DedupeResult{}, err
+	}
+
+	return result, nil
+}
+
+// find groups the versions of the same songs, listing the playlists of every version when songPlaylists is set.
+func (d *DuplicateService) find(
+	songs []model.SongOutAPI,
+	songPlaylists map[int][]int,
+	query model.DuplicateQuery,
+) ([]model.DuplicateGroup, []duplicateGroup) {
+	found := findDuplicateGroups(songs, query.Tolerance)
+
+	groups := make([]model.DuplicateGroup, len(found))
+	for i, group := range found {
+		groups[i] = model.DuplicateGroup{
+			Reasons:         group.reasons,
+			PreferredSongID: songs[preferredDuplicate(songs, group.indices, query.Prefer)].ID,
+			Songs:           make([]model.DuplicateSong, len(group.indices)),
+		}
+		for j, index := range group.indices {
+			groups[i].Songs[j] = model.DuplicateSong{
+				SongOutAPI:  songs[index],
+				PlaylistIDs: songPlaylists[songs[index].ID],
+			}
+		}
+	}
+
+	return groups, found
+}
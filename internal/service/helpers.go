@@ -1,26 +1,39 @@
 package service
 
 import (
-	"context"
+	"cmp"
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/csv"
-	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/tuannamnguyen/playlist-manager/internal/model"
-	applemusicconverter "github.com/tuannamnguyen/playlist-manager/internal/service/converters/applemusic"
-	spotifyconverter "github.com/tuannamnguyen/playlist-manager/internal/service/converters/spotify"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/matcher"
+	"golang.org/x/oauth2"
 )
 
-func getConverter(ctx context.Context, provider string, providerMetadata model.ConverterServiceProviderMetadata) (Converter, error) {
-	switch provider {
-	case "spotify":
-		return spotifyconverter.New(ctx, providerMetadata.Spotify.Token), nil
-	case "applemusic":
-		return applemusicconverter.New(ctx, providerMetadata.AppleMusic.MusicUserToken), nil
+func jobStatusFromSongs(jobSongs []model.ConversionJobSong) model.JobStatus {
+	for _, jobSong := range jobSongs {
+		if jobSong.Status != model.MatchStatusMatched {
+			return model.JobStatusPartiallySucceeded
+		}
 	}
 
-	return nil, errors.New("no converter available")
+	return model.JobStatusSucceeded
+}
+
+// songTrackIDsFromJob maps the ID of every song of the job to the provider track it was exported as.
+func songTrackIDsFromJob(jobSongs []model.ConversionJobSong) map[int]string {
+	songTrackIDs := make(map[int]string, len(jobSongs))
+	for _, jobSong := range jobSongs {
+		songTrackIDs[jobSong.Result.Song.ID] = jobSong.Result.ProviderTrackID
+	}
+	return songTrackIDs
 }
 
 func writeCsvRecord(w io.Writer, record []string) error {
@@ -48,3 +61,584 @@ func parseCsv(r io.Reader) ([][]string, error) {
 
 	return records, nil
 }
+
+// diffTrackIDs returns the tracks to remove from and then add to a remote playlist holding synced
+// so that it holds wanted. Providers remove every occurrence of a track, so a track wanted fewer
+// times than it is synced is removed and added back as many times as wanted. When canRemove is
+// false nothing is removed and only the occurrences missing from synced are added.
+func diffTrackIDs(synced []string, wanted []string, canRemove bool) (toRemove []string, toAdd []string) {
+	syncedCount := countTrackIDs(synced)
+	wantedCount := countTrackIDs(wanted)
+
+	removed := make(map[string]bool)
+	if canRemove {
+		for _, trackID := range synced {
+			if !removed[trackID] && wantedCount[trackID] < syncedCount[trackID] {
+				removed[trackID] = true
+				toRemove = append(toRemove, trackID)
+			}
+		}
+	}
+
+	seen := make(map[string]int, len(wanted))
+	for _, trackID := range wanted {
+		seen[trackID]++
+		if removed[trackID] || seen[trackID] > syncedCount[trackID] {
+			toAdd = append(toAdd, trackID)
+		}
+	}
+
+	return toRemove, toAdd
+}
+
+func countTrackIDs(trackIDs []string) map[string]int {
+	counts := make(map[string]int, len(trackIDs))
+	for _, trackID := range trackIDs {
+		counts[trackID]++
+	}
+	return counts
+}
+
+// withoutTrackIDs returns trackIDs without any occurrence of the removed tracks.
+func withoutTrackIDs(trackIDs []string, removed []string) []string {
+	removedSet := make(map[string]bool, len(removed))
+	for _, trackID := range removed {
+		removedSet[trackID] = true
+	}
+
+	remaining := make([]string, 0, len(trackIDs))
+	for _, trackID := range trackIDs {
+		if !removedSet[trackID] {
+			remaining = append(remaining, trackID)
+		}
+	}
+	return remaining
+}
+
+type mergedOrders struct {
+	local     []string
+	remote    []string
+	base      []string
+	conflicts []model.SyncConflict
+}
+
+// mergeOrders does a three-way merge of the two sides of a synced playlist, given as the unique keys
+// of their items, against base, the order both sides had after the last sync. An item removed on
+// either side is removed and an item added on either side is inserted after the item preceding it
+// on that side. When both sides reordered the items they have in common differently the conflict is
+// flagged and each side keeps its order, unless resolve picks the side whose order wins. base of the
+// result keeps the old order in that case so the conflict is flagged again until it's resolved.
+func mergeOrders(base []string, local []string, remote []string, resolve model.SyncSide) mergedOrders {
+	inBase, inLocal, inRemote := keySet(base), keySet(local), keySet(remote)
+
+	// items both sides had at the last sync and still have
+	common := func(order []string) []string {
+		var kept []string
+		for _, key := range order {
+			if inBase[key] && inLocal[key] && inRemote[key] {
+				kept = append(kept, key)
+			}
+		}
+		return kept
+	}
+	baseOrder, localOrder, remoteOrder := common(base), common(local), common(remote)
+
+	localMoved := !slices.Equal(localOrder, baseOrder)
+	remoteMoved := !slices.Equal(remoteOrder, baseOrder)
+
+	var merged mergedOrders
+	winner := localOrder
+	switch {
+	case !localMoved:
+		winner = remoteOrder
+	case !remoteMoved, slices.Equal(localOrder, remoteOrder), resolve == model.SyncSideLocal:
+	case resolve == model.SyncSideRemote:
+		winner = remoteOrder
+	default:
+		winner = nil
+		merged.conflicts = append(merged.conflicts, model.SyncConflict{
+			Type:    model.SyncConflictOrder,
+			Message: "the playlist was reordered on both sides since the last sync, resolve by picking the order to keep",
+		})
+	}
+	if merged.conflicts == nil {
+		localOrder, remoteOrder, baseOrder = winner, winner, winner
+	}
+
+	localAdded, remoteAdded := make(map[string]bool), make(map[string]bool)
+	for _, key := range local {
+		if !inBase[key] {
+			localAdded[key] = true
+		}
+	}
+	for _, key := range remote {
+		if !inBase[key] {
+			remoteAdded[key] = true
+		}
+	}
+
+	withAdditions := func(order []string) []string {
+		order = insertAdditions(order, local, localAdded)
+		return insertAdditions(order, remote, remoteAdded)
+	}
+	merged.local = withAdditions(localOrder)
+	merged.remote = withAdditions(remoteOrder)
+	merged.base = withAdditions(baseOrder)
+
+	return merged
+}
+
+// insertAdditions inserts the added items of side into order, each after the item preceding it on side.
+func insertAdditions(order []string, side []string, added map[string]bool) []string {
+	result := slices.Clone(order)
+	present := keySet(result)
+
+	var previous string
+	for _, key := range side {
+		if added[key] && !present[key] {
+			position := 0
+			if previous != "" {
+				position = slices.Index(result, previous) + 1
+			}
+			result = slices.Insert(result, position, key)
+			present[key] = true
+		}
+		if present[key] {
+			previous = key
+		}
+	}
+
+	return result
+}
+
+func keySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+func tokenNeedsRefresh(token *oauth2.Token, now time.Time) bool {
+	return !token.Expiry.IsZero() && token.Expiry.Before(now.Add(tokenRefreshMargin))
+}
+
+// newToken returns a random URL safe token for links that grant access to a playlist.
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// publicPlaylist leaves out what anonymous viewers of a shared playlist shouldn't see.
+func publicPlaylist(playlist model.Playlist) model.Playlist {
+	playlist.UserID = ""
+	playlist.RemoteLinks = nil
+	// the rules can name other playlists of the owner
+	playlist.SmartRules = nil
+	return playlist
+}
+
+// publicSongs leaves out who added the songs of a shared playlist.
+func publicSongs(songs []model.SongOutAPI) []model.SongOutAPI {
+	for i := range songs {
+		songs[i].AddedBy = ""
+	}
+	return songs
+}
+
+// diffVersionSongs returns the songs added and removed between two versions of a playlist, in the order
+// of the version they're in, and whether the songs in both versions are in a different order.
+func diffVersionSongs(from []model.PlaylistVersionSong, to []model.PlaylistVersionSong) (added []int, removed []int, reordered bool) {
+	inFrom := make(map[int]bool, len(from))
+	for _, song := range from {
+		inFrom[song.SongID] = true
+	}
+	inTo := make(map[int]bool, len(to))
+	for _, song := range to {
+		inTo[song.SongID] = true
+	}
+
+	var keptFrom, keptTo []int
+	for _, song := range from {
+		if inTo[song.SongID] {
+			keptFrom = append(keptFrom, song.SongID)
+		} else {
+			removed = append(removed, song.SongID)
+		}
+	}
+	for _, song := range to {
+		if inFrom[song.SongID] {
+			keptTo = append(keptTo, song.SongID)
+		} else {
+			added = append(added, song.SongID)
+		}
+	}
+
+	return added, removed, !slices.Equal(keptFrom, keptTo)
+}
+
+// validateSmartRules checks that every rule has the values its field needs, which struct tags can't express.
+func validateSmartRules(rules model.SmartPlaylistRules) error {
+	for i, rule := range rules.Rules {
+		var problem string
+
+		switch rule.Field {
+		case model.SmartRuleArtist, model.SmartRuleAlbum:
+			if len(rule.Values) == 0 || slices.Contains(rule.Values, "") {
+				problem = "needs non-empty values"
+			}
+		case model.SmartRuleISRCPrefix:
+			if len(rule.Values) == 0 || slices.ContainsFunc(rule.Values, func(prefix string) bool {
+				return len(prefix) == 0 || len(prefix) > 12 || !isAlphanumeric(prefix)
+			}) {
+				problem = "needs values of 1 to 12 letters or digits"
+			}
+		case model.SmartRuleISRCCountry:
+			if len(rule.Values) == 0 || slices.ContainsFunc(rule.Values, func(country string) bool {
+				return len(country) != 2 || strings.Trim(strings.ToUpper(country), "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != ""
+			}) {
+				problem = "needs two letter country codes"
+			}
+		case model.SmartRuleDuration:
+			switch {
+			case rule.MinDuration == nil && rule.MaxDuration == nil:
+				problem = "needs a min_duration or a max_duration"
+			case rule.MinDuration != nil && *rule.MinDuration < 0, rule.MaxDuration != nil && *rule.MaxDuration < 0:
+				problem = "needs durations that aren't negative"
+			case rule.MinDuration != nil && rule.MaxDuration != nil && *rule.MinDuration > *rule.MaxDuration:
+				problem = "needs a min_duration up to its max_duration"
+			}
+		case model.SmartRuleAddedAfter:
+			if rule.After == nil {
+				problem = "needs an after date"
+			}
+		case model.SmartRuleInPlaylist:
+			if len(rule.PlaylistIDs) == 0 {
+				problem = "needs playlist_ids"
+			}
+		default:
+			problem = "has an unknown field"
+		}
+
+		if problem != "" {
+			return fmt.Errorf("%w: rule %d on %q %s", model.ErrInvalidSmartRules, i, rule.Field, problem)
+		}
+	}
+
+	return nil
+}
+
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// songIdentity is what makes songs the same across playlists: their ISRC, or their ID when they have none.
+func songIdentity(song model.SongOutAPI) string {
+	if isrc := matcher.NormalizeISRC(song.ISRC); isrc != "" {
+		return "isrc:" + isrc
+	}
+	return "id:" + strconv.Itoa(song.ID)
+}
+
+// combinedSong is a song of combined playlists with the index of the playlist it was taken from.
+type combinedSong struct {
+	song   model.SongOutAPI
+	source int
+}
+
+// combineSongs applies the set operation to the songs of the playlists. Every kept song is taken
+// from the first playlist it's in, and the songs are in the order of the playlists.
+func combineSongs(operation model.SetOperation, sources [][]model.SongOutAPI) []combinedSong {
+	inSources := make(map[string]int)
+	inFirst := make(map[string]bool)
+	for i, songs := range sources {
+		inSource := make(map[string]bool, len(songs))
+		for _, song := range songs {
+			identity := songIdentity(song)
+			if inSource[identity] {
+				continue
+			}
+			inSource[identity] = true
+			inSources[identity]++
+			if i == 0 {
+				inFirst[identity] = true
+			}
+		}
+	}
+
+	keep := func(identity string) bool {
+		switch operation {
+		case model.SetOperationUnion:
+			return true
+		case model.SetOperationIntersection:
+			return inSources[identity] == len(sources)
+		case model.SetOperationDifference:
+			return inFirst[identity] && inSources[identity] == 1
+		case model.SetOperationSymmetricDifference:
+			return inSources[identity] == 1
+		default:
+			return false
+		}
+	}
+
+	var result []combinedSong
+	added := make(map[string]bool)
+	for i, songs := range sources {
+		for _, song := range songs {
+			identity := songIdentity(song)
+			if added[identity] || !keep(identity) {
+				continue
+			}
+			added[identity] = true
+			result = append(result, combinedSong{song: song, source: i})
+		}
+	}
+
+	return result
+}
+
+// orderCombinedSongs puts the combined songs in the order. Songs that compare equal stay in the order of the playlists.
+func orderCombinedSongs(songs []combinedSong, order model.CombineOrder) []model.SongOutAPI {
+	if order == model.CombineOrderInterleave {
+		songs = interleaveCombinedSongs(songs)
+	}
+
+	result := make([]model.SongOutAPI, len(songs))
+	for i, combined := range songs {
+		result[i] = combined.song
+	}
+
+	var compare func(a, b model.SongOutAPI) int
+	switch order {
+	case model.CombineOrderSongName:
+		compare = func(a, b model.SongOutAPI) int { return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) }
+	case model.CombineOrderAlbumName:
+		compare = func(a, b model.SongOutAPI) int {
+			return cmp.Compare(strings.ToLower(a.AlbumName), strings.ToLower(b.AlbumName))
+		}
+	case model.CombineOrderDuration:
+		compare = func(a, b model.SongOutAPI) int { return cmp.Compare(a.Duration, b.Duration) }
+	case model.CombineOrderAddedAt:
+		compare = func(a, b model.SongOutAPI) int { return a.CreatedAt.Compare(b.CreatedAt) }
+	}
+	if compare != nil {
+		slices.SortStableFunc(result, compare)
+	}
+
+	return result
+}
+
+// interleaveCombinedSongs takes a song from each playlist in turn, until every playlist is out of songs.
+func interleaveCombinedSongs(songs []combinedSong) []combinedSong {
+	var bySource [][]combinedSong
+	for _, combined := range songs {
+		for len(bySource) <= combined.source {
+			bySource = append(bySource, nil)
+		}
+		bySource[combined.source] = append(bySource[combined.source], combined)
+	}
+
+	result := make([]combinedSong, 0, len(songs))
+	for turn := 0; len(result) < len(songs); turn++ {
+		for _, sourceSongs := range bySource {
+			if turn < len(sourceSongs) {
+				result = append(result, sourceSongs[turn])
+			}
+		}
+	}
+
+	return result
+}
+
+// mergeSongsIntoPlaylist returns the IDs of the songs in the playlist order once the songs are in it,
+// with the IDs of the songs the playlist has to get. Songs already in the playlist keep their ID there.
+func mergeSongsIntoPlaylist(current []model.SongOutAPI, songs []model.SongOutAPI) (order []int, missing []int) {
+	inPlaylist := make(map[string]int, len(current))
+	for _, song := range current {
+		identity := songIdentity(song)
+		if _, ok := inPlaylist[identity]; !ok {
+			inPlaylist[identity] = song.ID
+		}
+	}
+
+	order = make([]int, 0, len(songs))
+	for _, song := range songs {
+		if songID, ok := inPlaylist[songIdentity(song)]; ok {
+			order = append(order, songID)
+			continue
+		}
+		order = append(order, song.ID)
+		missing = append(missing, song.ID)
+	}
+
+	return order, missing
+}
+
+// duplicateGroup is the indices of versions of the same song in a list of songs, with why they're the same.
+type duplicateGroup struct {
+	indices []int
+	reasons []model.DuplicateReason
+}
+
+// findDuplicateGroups groups the songs that are versions of the same recording: songs with the same ISRC,
+// and songs with the same normalized title and artists whose durations are within the tolerance of each other.
+// Groups and the songs in them are in the order of the songs.
+func findDuplicateGroups(songs []model.SongOutAPI, tolerance int) []duplicateGroup {
+	parent := make([]int, len(songs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	type edge struct {
+		a, b   int
+		reason model.DuplicateReason
+	}
+	var edges []edge
+
+	byISRC := make(map[string][]int)
+	byTitleArtists := make(map[string][]int)
+	var titleArtistsKeys []string
+	for i, song := range songs {
+		if isrc := matcher.NormalizeISRC(song.ISRC); isrc != "" {
+			byISRC[isrc] = append(byISRC[isrc], i)
+		}
+
+		key := matcher.SongKey(song.Name, song.ArtistNames)
+		if key == "" {
+			continue
+		}
+		if _, ok := byTitleArtists[key]; !ok {
+			titleArtistsKeys = append(titleArtistsKeys, key)
+		}
+		byTitleArtists[key] = append(byTitleArtists[key], i)
+	}
+
+	for _, indices := range byISRC {
+		for j := 1; j < len(indices); j++ {
+			edges = append(edges, edge{indices[0], indices[j], model.DuplicateReasonISRC})
+		}
+	}
+	for _, key := range titleArtistsKeys {
+		indices := slices.Clone(byTitleArtists[key])
+		slices.SortStableFunc(indices, func(a, b int) int { return cmp.Compare(songs[a].Duration, songs[b].Duration) })
+		for j := 1; j < len(indices); j++ {
+			if songs[indices[j]].Duration-songs[indices[j-1]].Duration <= tolerance {
+				edges = append(edges, edge{indices[j-1], indices[j], model.DuplicateReasonTitleArtists})
+			}
+		}
+	}
+
+	for _, e := range edges {
+		parent[find(e.a)] = find(e.b)
+	}
+
+	groupOf := make(map[int]int)
+	var groups []duplicateGroup
+	for i := range songs {
+		root := find(i)
+		index, ok := groupOf[root]
+		if !ok {
+			index = len(groups)
+			groupOf[root] = index
+			groups = append(groups, duplicateGroup{})
+		}
+		groups[index].indices = append(groups[index].indices, i)
+	}
+	for _, e := range edges {
+		group := &groups[groupOf[find(e.a)]]
+		if !slices.Contains(group.reasons, e.reason) {
+			group.reasons = append(group.reasons, e.reason)
+		}
+	}
+
+	duplicates := make([]duplicateGroup, 0)
+	for _, group := range groups {
+		if len(group.indices) > 1 {
+			slices.Sort(group.reasons)
+			duplicates = append(duplicates, group)
+		}
+	}
+
+	return duplicates
+}
+
+// preferredDuplicate returns the index of the version of the song in the group that a dedupe keeps.
+func preferredDuplicate(songs []model.SongOutAPI, indices []int, prefer model.DuplicatePreference) int {
+	switch prefer {
+	case model.DuplicatePreferLongest:
+		longest := indices[0]
+		for _, i := range indices[1:] {
+			if songs[i].Duration > songs[longest].Duration {
+				longest = i
+			}
+		}
+		return longest
+	case model.DuplicatePreferSingle:
+		for _, i := range indices {
+			if isSingle(songs[i]) {
+				return i
+			}
+		}
+	case model.DuplicatePreferFirst:
+	default:
+		for _, i := range indices {
+			if !isSingle(songs[i]) {
+				return i
+			}
+		}
+	}
+
+	return indices[0]
+}
+
+// isSingle tells whether the song comes from a single, which providers name after the song or suffix with "Single".
+func isSingle(song model.SongOutAPI) bool {
+	album := strings.ToLower(strings.TrimSpace(song.AlbumName))
+	return strings.HasSuffix(album, " - single") || matcher.NormalizeTitle(song.AlbumName) == matcher.NormalizeTitle(song.Name)
+}
+
+// dedupeOrder returns the songs of the playlist in order once only the preferred version of each group is left,
+// which takes the place of the first version in the playlist, and the songs to remove.
+func dedupeOrder(songs []model.SongOutAPI, groups []duplicateGroup, preferred []int) (order []int, removed []int) {
+	groupOf := make(map[int]int)
+	for g, group := range groups {
+		for _, i := range group.indices {
+			groupOf[i] = g
+		}
+	}
+
+	placed := make(map[int]bool)
+	for i, song := range songs {
+		g, ok := groupOf[i]
+		if !ok {
+			order = append(order, song.ID)
+			continue
+		}
+
+		if !placed[g] {
+			placed[g] = true
+			order = append(order, songs[preferred[g]].ID)
+		}
+		if i != preferred[g] {
+			removed = append(removed, song.ID)
+		}
+	}
+
+	return order, removed
+}
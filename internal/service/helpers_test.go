@@ -3,8 +3,11 @@ package service
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"golang.org/x/oauth2"
 )
 
 func TestWriteCsvRecord(t *testing.T) {
@@ -96,3 +99,518 @@ func TestParseCsv(t *testing.T) {
 		})
 	}
 }
+
+func TestJobStatusFromSongs(t *testing.T) {
+	tests := []struct {
+		name     string
+		jobSongs []model.ConversionJobSong
+		want     model.JobStatus
+	}{
+		{
+			name: "all songs matched",
+			jobSongs: []model.ConversionJobSong{
+				{Position: 0, Status: model.MatchStatusMatched},
+				{Position: 1, Status: model.MatchStatusMatched},
+			},
+			want: model.JobStatusSucceeded,
+		},
+		{
+			name: "some songs unmatched",
+			jobSongs: []model.ConversionJobSong{
+				{Position: 0, Status: model.MatchStatusMatched},
+				{Position: 1, Status: model.MatchStatusUnmatched},
+			},
+			want: model.JobStatusPartiallySucceeded,
+		},
+		{
+			name: "some songs ambiguous",
+			jobSongs: []model.ConversionJobSong{
+				{Position: 0, Status: model.MatchStatusAmbiguous},
+				{Position: 1, Status: model.MatchStatusMatched},
+			},
+			want: model.JobStatusPartiallySucceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, jobStatusFromSongs(tt.jobSongs))
+		})
+	}
+}
+
+func TestDiffTrackIDs(t *testing.T) {
+	tests := []struct {
+		name         string
+		synced       []string
+		wanted       []string
+		canRemove    bool
+		wantToRemove []string
+		wantToAdd    []string
+	}{
+		{
+			name:      "nothing changed",
+			synced:    []string{"a", "b"},
+			wanted:    []string{"a", "b"},
+			canRemove: true,
+		},
+		{
+			name:      "songs added",
+			synced:    []string{"a", "b"},
+			wanted:    []string{"a", "c", "b", "d"},
+			canRemove: true,
+			wantToAdd: []string{"c", "d"},
+		},
+		{
+			name:         "songs removed",
+			synced:       []string{"a", "b", "c"},
+			wanted:       []string{"b"},
+			canRemove:    true,
+			wantToRemove: []string{"a", "c"},
+		},
+		{
+			name:         "one of a duplicated song removed",
+			synced:       []string{"a", "b", "a"},
+			wanted:       []string{"a", "b"},
+			canRemove:    true,
+			wantToRemove: []string{"a"},
+			wantToAdd:    []string{"a"},
+		},
+		{
+			name:      "song duplicated",
+			synced:    []string{"a"},
+			wanted:    []string{"a", "a"},
+			canRemove: true,
+			wantToAdd: []string{"a"},
+		},
+		{
+			name:      "provider can't remove",
+			synced:    []string{"a", "b"},
+			wanted:    []string{"b", "c"},
+			canRemove: false,
+			wantToAdd: []string{"c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toRemove, toAdd := diffTrackIDs(tt.synced, tt.wanted, tt.canRemove)
+			assert.Equal(t, tt.wantToRemove, toRemove)
+			assert.Equal(t, tt.wantToAdd, toAdd)
+		})
+	}
+}
+
+func TestMergeOrders(t *testing.T) {
+	orderConflict := []model.SyncConflict{{
+		Type:    model.SyncConflictOrder,
+		Message: "the playlist was reordered on both sides since the last sync, resolve by picking the order to keep",
+	}}
+
+	tests := []struct {
+		name          string
+		base          []string
+		local         []string
+		remote        []string
+		resolve       model.SyncSide
+		wantLocal     []string
+		wantRemote    []string
+		wantBase      []string
+		wantConflicts []model.SyncConflict
+	}{
+		{
+			name:       "nothing changed",
+			base:       []string{"a", "b", "c"},
+			local:      []string{"a", "b", "c"},
+			remote:     []string{"a", "b", "c"},
+			wantLocal:  []string{"a", "b", "c"},
+			wantRemote: []string{"a", "b", "c"},
+			wantBase:   []string{"a", "b", "c"},
+		},
+		{
+			name:       "additions on both sides keep their neighbours",
+			base:       []string{"a", "b", "c"},
+			local:      []string{"a", "x", "b", "c"},
+			remote:     []string{"y", "a", "b", "c", "z"},
+			wantLocal:  []string{"y", "a", "x", "b", "c", "z"},
+			wantRemote: []string{"y", "a", "x", "b", "c", "z"},
+			wantBase:   []string{"y", "a", "x", "b", "c", "z"},
+		},
+		{
+			name:       "removals on both sides",
+			base:       []string{"a", "b", "c", "d"},
+			local:      []string{"a", "c", "d"},
+			remote:     []string{"a", "b", "c"},
+			wantLocal:  []string{"a", "c"},
+			wantRemote: []string{"a", "c"},
+			wantBase:   []string{"a", "c"},
+		},
+		{
+			name:       "same song added on both sides",
+			base:       []string{"a"},
+			local:      []string{"a", "x"},
+			remote:     []string{"a", "x"},
+			wantLocal:  []string{"a", "x"},
+			wantRemote: []string{"a", "x"},
+			wantBase:   []string{"a", "x"},
+		},
+		{
+			name:       "remote reorder wins over an unchanged local order",
+			base:       []string{"a", "b", "c"},
+			local:      []string{"a", "b", "c", "x"},
+			remote:     []string{"c", "a", "b"},
+			wantLocal:  []string{"c", "x", "a", "b"},
+			wantRemote: []string{"c", "x", "a", "b"},
+			wantBase:   []string{"c", "x", "a", "b"},
+		},
+		{
+			name:       "local reorder wins over an unchanged remote order",
+			base:       []string{"a", "b", "c"},
+			local:      []string{"b", "a", "c"},
+			remote:     []string{"a", "c"},
+			wantLocal:  []string{"a", "c"},
+			wantRemote: []string{"a", "c"},
+			wantBase:   []string{"a", "c"},
+		},
+		{
+			name:       "same reorder on both sides",
+			base:       []string{"a", "b", "c"},
+			local:      []string{"c", "b", "a"},
+			remote:     []string{"c", "b", "a"},
+			wantLocal:  []string{"c", "b", "a"},
+			wantRemote: []string{"c", "b", "a"},
+			wantBase:   []string{"c", "b", "a"},
+		},
+		{
+			name:          "different reorders are flagged",
+			base:          []string{"a", "b", "c"},
+			local:         []string{"c", "a", "b"},
+			remote:        []string{"b", "a", "c", "x"},
+			wantLocal:     []string{"c", "x", "a", "b"},
+			wantRemote:    []string{"b", "a", "c", "x"},
+			wantBase:      []string{"a", "b", "c", "x"},
+			wantConflicts: orderConflict,
+		},
+		{
+			name:       "conflict resolved with the remote order",
+			base:       []string{"a", "b", "c"},
+			local:      []string{"c", "a", "b"},
+			remote:     []string{"b", "a", "c"},
+			resolve:    model.SyncSideRemote,
+			wantLocal:  []string{"b", "a", "c"},
+			wantRemote: []string{"b", "a", "c"},
+			wantBase:   []string{"b", "a", "c"},
+		},
+		{
+			name:       "resolve doesn't override a one-sided reorder",
+			base:       []string{"a", "b", "c"},
+			local:      []string{"a", "b", "c"},
+			remote:     []string{"b", "a", "c"},
+			resolve:    model.SyncSideLocal,
+			wantLocal:  []string{"b", "a", "c"},
+			wantRemote: []string{"b", "a", "c"},
+			wantBase:   []string{"b", "a", "c"},
+		},
+		{
+			name:       "first sync after a one-way export",
+			base:       nil,
+			local:      []string{"a", "b"},
+			remote:     []string{"a", "c"},
+			wantLocal:  []string{"a", "c", "b"},
+			wantRemote: []string{"a", "c", "b"},
+			wantBase:   []string{"a", "c", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeOrders(tt.base, tt.local, tt.remote, tt.resolve)
+			assert.Equal(t, tt.wantLocal, got.local)
+			assert.Equal(t, tt.wantRemote, got.remote)
+			assert.Equal(t, tt.wantBase, got.base)
+			assert.Equal(t, tt.wantConflicts, got.conflicts)
+		})
+	}
+}
+
+func TestTokenNeedsRefresh(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		expiry time.Time
+		want   bool
+	}{
+		{name: "no expiry", expiry: time.Time{}, want: false},
+		{name: "valid for a while", expiry: now.Add(time.Hour), want: false},
+		{name: "about to expire", expiry: now.Add(30 * time.Second), want: true},
+		{name: "expired", expiry: now.Add(-time.Hour), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tokenNeedsRefresh(&oauth2.Token{Expiry: tt.expiry}, now))
+		})
+	}
+}
+
+func TestDiffVersionSongs(t *testing.T) {
+	songs := func(songsID ...int) []model.PlaylistVersionSong {
+		versionSongs := make([]model.PlaylistVersionSong, len(songsID))
+		for i, songID := range songsID {
+			versionSongs[i] = model.PlaylistVersionSong{SongID: songID}
+		}
+		return versionSongs
+	}
+
+	tests := []struct {
+		name          string
+		from          []model.PlaylistVersionSong
+		to            []model.PlaylistVersionSong
+		wantAdded     []int
+		wantRemoved   []int
+		wantReordered bool
+	}{
+		{
+			name: "same songs",
+			from: songs(1, 2, 3),
+			to:   songs(1, 2, 3),
+		},
+		{
+			name:        "songs added and removed",
+			from:        songs(1, 2, 3),
+			to:          songs(4, 1, 3, 5),
+			wantAdded:   []int{4, 5},
+			wantRemoved: []int{2},
+		},
+		{
+			name:          "songs reordered",
+			from:          songs(1, 2, 3),
+			to:            songs(3, 1, 2),
+			wantReordered: true,
+		},
+		{
+			name:        "every song removed",
+			from:        songs(1, 2),
+			to:          nil,
+			wantRemoved: []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed, reordered := diffVersionSongs(tt.from, tt.to)
+			assert.Equal(t, tt.wantAdded, added)
+			assert.Equal(t, tt.wantRemoved, removed)
+			assert.Equal(t, tt.wantReordered, reordered)
+		})
+	}
+}
+
+func TestValidateSmartRules(t *testing.T) {
+	intPtr := func(i int) *int { return &i }
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		rule    model.SmartPlaylistRule
+		wantErr bool
+	}{
+		{
+			name: "artists",
+			rule: model.SmartPlaylistRule{Field: model.SmartRuleArtist, Values: []string{"Kanye West"}},
+		},
+		{
+			name:    "album without values",
+			rule:    model.SmartPlaylistRule{Field: model.SmartRuleAlbum},
+			wantErr: true,
+		},
+		{
+			name: "duration range",
+			rule: model.SmartPlaylistRule{Field: model.SmartRuleDuration, MinDuration: intPtr(60000), MaxDuration: intPtr(240000)},
+		},
+		{
+			name:    "duration range upside down",
+			rule:    model.SmartPlaylistRule{Field: model.SmartRuleDuration, MinDuration: intPtr(240000), MaxDuration: intPtr(60000)},
+			wantErr: true,
+		},
+		{
+			name:    "duration without bounds",
+			rule:    model.SmartPlaylistRule{Field: model.SmartRuleDuration},
+			wantErr: true,
+		},
+		{
+			name: "added after",
+			rule: model.SmartPlaylistRule{Field: model.SmartRuleAddedAfter, After: &now},
+		},
+		{
+			name:    "in playlist without playlists",
+			rule:    model.SmartPlaylistRule{Field: model.SmartRuleInPlaylist},
+			wantErr: true,
+		},
+		{
+			name: "isrc prefix",
+			rule: model.SmartPlaylistRule{Field: model.SmartRuleISRCPrefix, Values: []string{"USUM7"}},
+		},
+		{
+			name:    "isrc prefix with a wildcard",
+			rule:    model.SmartPlaylistRule{Field: model.SmartRuleISRCPrefix, Values: []string{"US%"}},
+			wantErr: true,
+		},
+		{
+			name: "isrc country",
+			rule: model.SmartPlaylistRule{Field: model.SmartRuleISRCCountry, Values: []string{"gb", "US"}},
+		},
+		{
+			name:    "isrc country that isn't a country code",
+			rule:    model.SmartPlaylistRule{Field: model.SmartRuleISRCCountry, Values: []string{"U1"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSmartRules(model.SmartPlaylistRules{Rules: []model.SmartPlaylistRule{tt.rule}})
+			if tt.wantErr {
+				assert.ErrorIs(t, err, model.ErrInvalidSmartRules)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCombineSongs(t *testing.T) {
+	first := []model.SongOutAPI{{ID: 1, ISRC: "USUM70000001"}, {ID: 2}, {ID: 3, ISRC: "GBUM70000003"}}
+	// song 13 is another copy of song 3 in the catalog
+	second := []model.SongOutAPI{{ID: 13, ISRC: "gbum70000003"}, {ID: 4}, {ID: 2}}
+	third := []model.SongOutAPI{{ID: 2}, {ID: 5}}
+
+	tests := []struct {
+		name      string
+		operation model.SetOperation
+		want      []int
+	}{
+		{
+			name:      "union",
+			operation: model.SetOperationUnion,
+			want:      []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:      "intersection",
+			operation: model.SetOperationIntersection,
+			want:      []int{2},
+		},
+		{
+			name:      "difference",
+			operation: model.SetOperationDifference,
+			want:      []int{1},
+		},
+		{
+			name:      "symmetric difference",
+			operation: model.SetOperationSymmetricDifference,
+			want:      []int{1, 4, 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, combined := range combineSongs(tt.operation, [][]model.SongOutAPI{first, second, third}) {
+				got = append(got, combined.song.ID)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestOrderCombinedSongs(t *testing.T) {
+	songs := []combinedSong{
+		{song: model.SongOutAPI{ID: 1, Name: "runaway", Duration: 547000}, source: 0},
+		{song: model.SongOutAPI{ID: 2, Name: "Power", Duration: 292000}, source: 0},
+		{song: model.SongOutAPI{ID: 3, Name: "Monster", Duration: 378000}, source: 0},
+		{song: model.SongOutAPI{ID: 4, Name: "Otis", Duration: 178000}, source: 1},
+		{song: model.SongOutAPI{ID: 5, Name: "Lost in the World", Duration: 257000}, source: 2},
+	}
+
+	tests := []struct {
+		name  string
+		order model.CombineOrder
+		want  []int
+	}{
+		{
+			name:  "source",
+			order: model.CombineOrderSource,
+			want:  []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:  "interleave",
+			order: model.CombineOrderInterleave,
+			want:  []int{1, 4, 5, 2, 3},
+		},
+		{
+			name:  "song name",
+			order: model.CombineOrderSongName,
+			want:  []int{5, 3, 4, 2, 1},
+		},
+		{
+			name:  "duration",
+			order: model.CombineOrderDuration,
+			want:  []int{4, 5, 2, 3, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, song := range orderCombinedSongs(songs, tt.order) {
+				got = append(got, song.ID)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMergeSongsIntoPlaylist(t *testing.T) {
+	current := []model.SongOutAPI{{ID: 7, ISRC: "USUM70000001"}, {ID: 8}}
+	songs := []model.SongOutAPI{{ID: 9}, {ID: 1, ISRC: "us-um7-00-00001"}, {ID: 8}}
+
+	order, missing := mergeSongsIntoPlaylist(current, songs)
+	assert.Equal(t, []int{9, 7, 8}, order)
+	assert.Equal(t, []int{9}, missing)
+}
+
+func TestFindDuplicateGroups(t *testing.T) {
+	songs := []model.SongOutAPI{
+		{ID: 1, Name: "Runaway", ArtistNames: []string{"Kanye West", "Pusha T"}, AlbumName: "My Beautiful Dark Twisted Fantasy", Duration: 547000, ISRC: "USUM71015443"},
+		{ID: 2, Name: "Power", ArtistNames: []string{"Kanye West"}, AlbumName: "Power", Duration: 292000},
+		{ID: 3, Name: "Runaway (Video Version)", ArtistNames: []string{"Pusha T", "Kanye West"}, AlbumName: "Runaway - Single", Duration: 546000},
+		{ID: 4, Name: "POWER", ArtistNames: []string{"Kanye West"}, AlbumName: "My Beautiful Dark Twisted Fantasy", Duration: 292500},
+		{ID: 5, Name: "Runaway - Radio Edit", ArtistNames: []string{"Kanye West", "Pusha T"}, AlbumName: "Runaway", Duration: 260000},
+		{ID: 6, Name: "Runaway", ArtistNames: []string{"Kanye West"}, AlbumName: "Mixtape", Duration: 547000, ISRC: "US-UM7-10-15443"},
+	}
+
+	groups := findDuplicateGroups(songs, 2000)
+
+	assert.Equal(t, []duplicateGroup{
+		{indices: []int{0, 2, 5}, reasons: []model.DuplicateReason{model.DuplicateReasonISRC, model.DuplicateReasonTitleArtists}},
+		{indices: []int{1, 3}, reasons: []model.DuplicateReason{model.DuplicateReasonTitleArtists}},
+	}, groups)
+
+	tests := []struct {
+		name   string
+		prefer model.DuplicatePreference
+		want   int
+	}{
+		{name: "album", prefer: model.DuplicatePreferAlbum, want: 0},
+		{name: "single", prefer: model.DuplicatePreferSingle, want: 2},
+		{name: "longest", prefer: model.DuplicatePreferLongest, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, preferredDuplicate(songs, groups[0].indices, tt.prefer))
+		})
+	}
+
+	// the version from the album takes the place of the single
+	order, removed := dedupeOrder(songs, groups, []int{0, 3})
+	assert.Equal(t, []int{1, 4, 5}, order)
+	assert.Equal(t, []int{2, 3, 6}, removed)
+}
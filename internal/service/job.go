@@ -0,0 +1,428 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"github.com/tuannamnguyen/playlist-manager/internal/service/matcher"
+)
+
+const (
+	jobPollInterval = 5 * time.Second
+	jobStaleAfter   = 5 * time.Minute
+)
+
+type Converter interface {
+	SearchAndMatch(ctx context.Context, song model.SongOutAPI) model.SongMatchResult
+	SearchCandidates(ctx context.Context, song model.SongOutAPI, limit int) ([]model.TrackCandidate, error)
+	CreatePlaylist(ctx context.Context, playlistName string, trackIDs []string) (string, error)
+	AddTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error
+	// RemoveTracks removes every occurrence of the tracks, or returns errors.ErrUnsupported
+	// when the provider can't remove tracks from a playlist.
+	RemoveTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) error
+}
+
+type ConversionJobRepository interface {
+	Insert(ctx context.Context, job model.ConversionJobInDB, songs []model.SongOutAPI, results map[int]model.SongMatchResult) (int, error)
+	SelectWithID(ctx context.Context, id int) (model.ConversionJob, error)
+	SelectProviderMetadata(ctx context.Context, id int) (model.ConverterServiceProviderMetadata, error)
+	ClaimNext(ctx context.Context) (int, bool, error)
+	RequeueStale(ctx context.Context, staleAfter time.Duration) error
+	UpdateStatus(ctx context.Context, id int, status model.JobStatus, errMessage string) error
+	UpdateRemotePlaylistID(ctx context.Context, id int, remotePlaylistID string) error
+	UpdateSongResult(ctx context.Context, id int, position int, result model.SongMatchResult) error
+}
+
+type PlaylistRemoteLinkRepository interface {
+	Select(ctx context.Context, playlistID int, provider string) (model.PlaylistRemoteLink, bool, error)
+	Save(ctx context.Context, link model.PlaylistRemoteLink) error
+	UpdateSyncStatus(ctx context.Context, jobID int, status model.JobStatus, errMessage string) error
+}
+
+type ConversionJobService struct {
+	jobRepo          ConversionJobRepository
+	playlistSongRepo PlaylistSongRepository
+	remoteLinkRepo   PlaylistRemoteLinkRepository
+	providers        *ProviderRegistry
+	workers          int
+	wake             chan struct{}
+	wg               sync.WaitGroup
+}
+
+func NewConversionJob(
+	jobRepo ConversionJobRepository,
+	playlistSongRepo PlaylistSongRepository,
+	remoteLinkRepo PlaylistRemoteLinkRepository,
+	providers *ProviderRegistry,
+	workers int,
+) *ConversionJobService {
+	return &ConversionJobService{
+		jobRepo:          jobRepo,
+		playlistSongRepo: playlistSongRepo,
+		remoteLinkRepo:   remoteLinkRepo,
+		providers:        providers,
+		workers:          workers,
+		wake:             make(chan struct{}, workers),
+	}
+}
+
+// Start runs the job workers until ctx is cancelled.
+// Jobs left queued or running by a previous server are picked up again.
+func (j *ConversionJobService) Start(ctx context.Context) {
+	for i := 0; i < j.workers; i++ {
+		j.wg.Add(1)
+		go j.work(ctx)
+	}
+}
+
+// Wait blocks until every worker has stopped and requeued its unfinished job.
+func (j *ConversionJobService) Wait() {
+	j.wg.Wait()
+}
+
+func (j *ConversionJobService) Enqueue(
+	ctx context.Context,
+	playlistID int,
+	provider string,
+	providerMetadata model.ConverterServiceProviderMetadata,
+	playlistName string,
+	selections map[int]string,
+) (model.ConversionJob, error) {
+	songs, err := j.playlistSongRepo.GetAll(ctx, playlistID, "", "")
+	if err != nil {
+		return model.ConversionJob{}, err
+	}
+
+	// songs the user picked a track for in a preview don't need to be searched again
+	results := make(map[int]model.SongMatchResult, len(selections))
+	for position, song := range songs {
+		if trackID, ok := selections[song.ID]; ok && trackID != "" {
+			results[position] = model.SongMatchResult{
+				Song:            song,
+				Status:          model.MatchStatusMatched,
+				Strategy:        model.MatchStrategyManual,
+				ProviderTrackID: trackID,
+			}
+		}
+	}
+
+	jobID, err := j.jobRepo.Insert(ctx, model.ConversionJobInDB{
+		PlaylistID:       playlistID,
+		Provider:         provider,
+		PlaylistName:     playlistName,
+		ProviderMetadata: providerMetadata,
+	}, songs, results)
+	if err != nil {
+		return model.ConversionJob{}, err
+	}
+
+	select {
+	case j.wake <- struct{}{}:
+	default:
+	}
+
+	return j.jobRepo.SelectWithID(ctx, jobID)
+}
+
+// Sync queues a job that brings the remote playlist the playlist was exported to up to date.
+// It returns model.ErrRemoteLinkNotFound when the playlist was never exported to the provider.
+func (j *ConversionJobService) Sync(
+	ctx context.Context,
+	playlistID int,
+	provider string,
+	providerMetadata model.ConverterServiceProviderMetadata,
+) (model.ConversionJob, error) {
+	link, linked, err := j.remoteLinkRepo.Select(ctx, playlistID, provider)
+	if err != nil {
+		return model.ConversionJob{}, err
+	}
+	if !linked {
+		return model.ConversionJob{}, model.ErrRemoteLinkNotFound
+	}
+
+	return j.Enqueue(ctx, playlistID, provider, providerMetadata, link.RemotePlaylistName, nil)
+}
+
+// Preview returns up to limit candidates per song without writing anything to the provider.
+func (j *ConversionJobService) Preview(
+	ctx context.Context,
+	playlistID int,
+	provider string,
+	providerMetadata model.ConverterServiceProviderMetadata,
+	limit int,
+) (model.ConversionPreview, error) {
+	songs, err := j.playlistSongRepo.GetAll(ctx, playlistID, "", "")
+	if err != nil {
+		return model.ConversionPreview{}, err
+	}
+
+	converter, err := j.providers.Converter(ctx, provider, providerMetadata)
+	if err != nil {
+		return model.ConversionPreview{}, err
+	}
+
+	preview := model.ConversionPreview{
+		Provider: provider,
+		Songs:    make([]model.SongPreview, 0, len(songs)),
+	}
+	for _, song := range songs {
+		if err := ctx.Err(); err != nil {
+			return model.ConversionPreview{}, err
+		}
+
+		songPreview := model.SongPreview{Song: song}
+
+		candidates, err := converter.SearchCandidates(ctx, song, limit)
+		if err != nil {
+			songPreview.Error = err.Error()
+		} else {
+			songPreview.Candidates = matcher.Rank(song, candidates)
+		}
+
+		preview.Songs = append(preview.Songs, songPreview)
+	}
+
+	return preview, nil
+}
+
+func (j *ConversionJobService) GetByID(ctx context.Context, id int) (model.ConversionJob, error) {
+	return j.jobRepo.SelectWithID(ctx, id)
+}
+
+func (j *ConversionJobService) work(ctx context.Context) {
+	defer j.wg.Done()
+
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		j.runQueuedJobs(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (j *ConversionJobService) runQueuedJobs(ctx context.Context) {
+	err := j.jobRepo.RequeueStale(ctx, jobStaleAfter)
+	if err != nil {
+		log.Printf("error requeueing stale conversion jobs: %v", err)
+	}
+
+	for ctx.Err() == nil {
+		jobID, ok, err := j.jobRepo.ClaimNext(ctx)
+		if err != nil {
+			log.Printf("error claiming conversion job: %v", err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		j.runJob(ctx, jobID)
+	}
+}
+
+func (j *ConversionJobService) runJob(ctx context.Context, jobID int) {
+	log.Printf("running conversion job %d", jobID)
+
+	status, err := j.processJob(ctx, jobID)
+
+	// use a fresh context so the job state is saved even when the server is shutting down
+	saveCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if ctx.Err() != nil {
+		log.Printf("conversion job %d interrupted, requeueing", jobID)
+		status, err = model.JobStatusQueued, nil
+	}
+
+	var errMessage string
+	if err != nil {
+		errMessage = err.Error()
+	}
+
+	err = j.jobRepo.UpdateStatus(saveCtx, jobID, status, errMessage)
+	if err != nil {
+		log.Printf("error updating status of conversion job %d: %v", jobID, err)
+	}
+
+	if status == model.JobStatusQueued {
+		return
+	}
+
+	err = j.remoteLinkRepo.UpdateSyncStatus(saveCtx, jobID, status, errMessage)
+	if err != nil {
+		log.Printf("error updating sync status of conversion job %d: %v", jobID, err)
+	}
+}
+
+func (j *ConversionJobService) processJob(ctx context.Context, jobID int) (model.JobStatus, error) {
+	job, err := j.jobRepo.SelectWithID(ctx, jobID)
+	if err != nil {
+		return model.JobStatusFailed, err
+	}
+
+	providerMetadata, err := j.jobRepo.SelectProviderMetadata(ctx, jobID)
+	if err != nil {
+		return model.JobStatusFailed, err
+	}
+
+	converter, err := j.providers.Converter(ctx, job.Provider, providerMetadata)
+	if err != nil {
+		return model.JobStatusFailed, err
+	}
+
+	for i, jobSong := range job.Songs {
+		if jobSong.Status != model.JobSongStatusPending {
+			continue
+		}
+
+		result := converter.SearchAndMatch(ctx, jobSong.Result.Song)
+		if ctx.Err() != nil {
+			return model.JobStatusQueued, ctx.Err()
+		}
+
+		err = j.jobRepo.UpdateSongResult(ctx, jobID, jobSong.Position, result)
+		if err != nil {
+			return model.JobStatusFailed, err
+		}
+
+		job.Songs[i].Status = result.Status
+		job.Songs[i].Result = result
+	}
+
+	link, linked, err := j.remoteLinkRepo.Select(ctx, job.PlaylistID, job.Provider)
+	if err != nil {
+		return model.JobStatusFailed, err
+	}
+
+	// the job was interrupted after it had exported its tracks
+	if linked && link.SyncedJobID == jobID {
+		return jobStatusFromSongs(job.Songs), nil
+	}
+
+	var trackIDs []string
+	for _, jobSong := range job.Songs {
+		if jobSong.Result.ProviderTrackID != "" {
+			trackIDs = append(trackIDs, jobSong.Result.ProviderTrackID)
+		}
+	}
+
+	if linked {
+		return j.syncRemotePlaylist(ctx, job, converter, link, trackIDs)
+	}
+
+	if len(trackIDs) == 0 {
+		return model.JobStatusFailed, fmt.Errorf("no songs matched on %s", job.Provider)
+	}
+
+	remotePlaylistID, err := converter.CreatePlaylist(ctx, job.PlaylistName, trackIDs)
+	if remotePlaylistID != "" {
+		link := model.PlaylistRemoteLink{
+			PlaylistID:         job.PlaylistID,
+			Provider:           job.Provider,
+			RemotePlaylistID:   remotePlaylistID,
+			RemotePlaylistName: job.PlaylistName,
+			TrackIDs:           []string{},
+			SongTrackIDs:       songTrackIDsFromJob(job.Songs),
+		}
+		// when adding the tracks failed the next sync adds them all again
+		if err == nil {
+			link.TrackIDs = trackIDs
+		}
+
+		saveErr := j.saveRemoteLink(job, link, err == nil)
+		if saveErr != nil && err == nil {
+			return model.JobStatusFailed, saveErr
+		}
+		if saveErr != nil {
+			log.Printf("error saving remote playlist link of conversion job %d: %v", job.ID, saveErr)
+		}
+	}
+	if err != nil {
+		return model.JobStatusFailed, err
+	}
+
+	return jobStatusFromSongs(job.Songs), nil
+}
+
+// syncRemotePlaylist adds and removes tracks so the linked remote playlist holds trackIDs.
+func (j *ConversionJobService) syncRemotePlaylist(
+	ctx context.Context,
+	job model.ConversionJob,
+	converter Converter,
+	link model.PlaylistRemoteLink,
+	trackIDs []string,
+) (model.JobStatus, error) {
+	status := jobStatusFromSongs(job.Songs)
+	var syncErr error
+
+	toRemove, toAdd := diffTrackIDs(link.TrackIDs, trackIDs, true)
+	if len(toRemove) > 0 {
+		err := converter.RemoveTracks(ctx, link.RemotePlaylistID, toRemove)
+		switch {
+		case errors.Is(err, errors.ErrUnsupported):
+			toRemove, toAdd = diffTrackIDs(link.TrackIDs, trackIDs, false)
+			status = model.JobStatusPartiallySucceeded
+			syncErr = fmt.Errorf("songs removed from the playlist are still in the %s playlist: %w", job.Provider, err)
+		case err != nil:
+			return model.JobStatusFailed, err
+		}
+	}
+
+	link.TrackIDs = withoutTrackIDs(link.TrackIDs, toRemove)
+	link.SongTrackIDs = songTrackIDsFromJob(job.Songs)
+
+	if len(toAdd) > 0 {
+		err := converter.AddTracks(ctx, link.RemotePlaylistID, toAdd)
+		if err != nil {
+			if len(toRemove) > 0 {
+				if saveErr := j.saveRemoteLink(job, link, false); saveErr != nil {
+					log.Printf("error saving remote playlist link of conversion job %d: %v", job.ID, saveErr)
+				}
+			}
+			return model.JobStatusFailed, err
+		}
+
+		link.TrackIDs = append(link.TrackIDs, toAdd...)
+	}
+
+	err := j.saveRemoteLink(job, link, true)
+	if err != nil {
+		return model.JobStatusFailed, err
+	}
+
+	return status, syncErr
+}
+
+// saveRemoteLink records the tracks the remote playlist holds. synced is false when the job
+// changed the remote playlist but failed before it was up to date.
+func (j *ConversionJobService) saveRemoteLink(job model.ConversionJob, link model.PlaylistRemoteLink, synced bool) error {
+	link.SyncedJobID = 0
+	if synced {
+		now := time.Now()
+		link.SyncedJobID = job.ID
+		link.SyncedAt = &now
+	}
+
+	// use a fresh context so what was done on the provider is saved even when the server is shutting down
+	saveCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := j.jobRepo.UpdateRemotePlaylistID(saveCtx, job.ID, link.RemotePlaylistID)
+	if err != nil {
+		log.Printf("error saving remote playlist of conversion job %d: %v", job.ID, err)
+	}
+
+	return j.remoteLinkRepo.Save(saveCtx, link)
+}
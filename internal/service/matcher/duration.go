@@ -0,0 +1,31 @@
+package matcher
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var isoDurationPattern = regexp.MustCompile(`^P(?:(\d+)D)?T?(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`)
+
+// ParseISODuration converts an ISO 8601 duration such as PT3M25S, which some providers give durations in, to milliseconds.
+// It returns 0 for durations it can't parse, which the matcher ignores.
+func ParseISODuration(duration string) int {
+	parts := isoDurationPattern.FindStringSubmatch(duration)
+	if parts == nil {
+		return 0
+	}
+
+	var seconds int
+	for i, unit := range []int{24 * 60 * 60, 60 * 60, 60, 1} {
+		if parts[i+1] == "" {
+			continue
+		}
+		value, err := strconv.Atoi(parts[i+1])
+		if err != nil {
+			return 0
+		}
+		seconds += value * unit
+	}
+
+	return seconds * 1000
+}
@@ -0,0 +1,208 @@
+// Package matcher scores provider search results against a song from the local catalog.
+// It doesn't call any provider so converters feed it the candidates they found.
+package matcher
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+const (
+	// MatchThreshold is the confidence from which a candidate is considered the same recording.
+	MatchThreshold = 0.8
+	// AmbiguousThreshold is the confidence from which a candidate is exported but flagged for review.
+	AmbiguousThreshold = 0.5
+
+	titleWeight    = 0.4
+	artistWeight   = 0.3
+	albumWeight    = 0.1
+	durationWeight = 0.2
+
+	// durations closer than this are considered equal, and further than durationMaxDiff score 0
+	durationToleranceMs = 2000
+	durationMaxDiffMs   = 15000
+
+	// applied when one title is a live, karaoke, remix... version and the other is not
+	versionMismatchPenalty = 0.5
+)
+
+// Score returns the confidence, between 0 and 1, that the candidate is the same recording as the song.
+func Score(song model.SongOutAPI, candidate model.TrackCandidate) float64 {
+	if sameISRC(song.ISRC, candidate.ISRC) {
+		return 1
+	}
+
+	var score, totalWeight float64
+
+	score += titleWeight * titleSimilarity(song.Name, candidate.Name)
+	totalWeight += titleWeight
+
+	songArtists := NormalizeArtists(song.ArtistNames, song.Name)
+	candidateArtists := NormalizeArtists(candidate.ArtistNames, candidate.Name)
+	if len(songArtists) > 0 && len(candidateArtists) > 0 {
+		score += artistWeight * setOverlap(songArtists, candidateArtists)
+		totalWeight += artistWeight
+	}
+
+	if song.AlbumName != "" && candidate.AlbumName != "" {
+		score += albumWeight * albumSimilarity(song.AlbumName, candidate.AlbumName)
+		totalWeight += albumWeight
+	}
+
+	if song.Duration > 0 && candidate.Duration > 0 {
+		score += durationWeight * durationSimilarity(song.Duration, candidate.Duration)
+		totalWeight += durationWeight
+	}
+
+	score /= totalWeight
+
+	if !sameVersion(song.Name, candidate.Name) {
+		score *= versionMismatchPenalty
+	}
+
+	return score
+}
+
+// Rank scores every candidate and sorts them by confidence, best first.
+func Rank(song model.SongOutAPI, candidates []model.TrackCandidate) []model.TrackCandidate {
+	ranked := slices.Clone(candidates)
+	for i := range ranked {
+		ranked[i].Confidence = Score(song, ranked[i])
+	}
+
+	slices.SortStableFunc(ranked, func(a, b model.TrackCandidate) int {
+		return cmp.Compare(b.Confidence, a.Confidence)
+	})
+
+	return ranked
+}
+
+// Match picks the best candidate for the song and reports how confident the match is.
+func Match(song model.SongOutAPI, candidates []model.TrackCandidate) model.SongMatchResult {
+	result := model.SongMatchResult{
+		Song:   song,
+		Status: model.MatchStatusUnmatched,
+	}
+
+	ranked := Rank(song, candidates)
+	if len(ranked) == 0 || ranked[0].Confidence < AmbiguousThreshold {
+		return result
+	}
+
+	best := ranked[0]
+	result.ProviderTrackID = best.ProviderTrackID
+	result.Strategy = best.Strategy
+	if best.Confidence == 1 && sameISRC(song.ISRC, best.ISRC) {
+		result.Strategy = model.MatchStrategyISRC
+	}
+
+	if best.Confidence >= MatchThreshold {
+		result.Status = model.MatchStatusMatched
+		return result
+	}
+
+	result.Status = model.MatchStatusAmbiguous
+	for _, candidate := range ranked {
+		if candidate.Confidence >= AmbiguousThreshold {
+			result.CandidateTrackIDs = append(result.CandidateTrackIDs, candidate.ProviderTrackID)
+		}
+	}
+
+	return result
+}
+
+func titleSimilarity(a string, b string) float64 {
+	normalizedA, normalizedB := NormalizeTitle(a), NormalizeTitle(b)
+	if normalizedA == normalizedB {
+		return 1
+	}
+
+	return diceCoefficient(strings.Fields(normalizedA), strings.Fields(normalizedB))
+}
+
+func albumSimilarity(a string, b string) float64 {
+	normalizedA, normalizedB := NormalizeTitle(a), NormalizeTitle(b)
+	switch {
+	case normalizedA == normalizedB:
+		return 1
+	case strings.Contains(normalizedA, normalizedB) || strings.Contains(normalizedB, normalizedA):
+		return 0.5
+	}
+
+	return 0
+}
+
+func durationSimilarity(a int, b int) float64 {
+	diff := math.Abs(float64(a - b))
+	switch {
+	case diff <= durationToleranceMs:
+		return 1
+	case diff >= durationMaxDiffMs:
+		return 0
+	}
+
+	return 1 - (diff-durationToleranceMs)/(durationMaxDiffMs-durationToleranceMs)
+}
+
+func sameVersion(a string, b string) bool {
+	tagsA, tagsB := VersionTags(a), VersionTags(b)
+	if len(tagsA) != len(tagsB) {
+		return false
+	}
+
+	for tag := range tagsA {
+		if !tagsB[tag] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setOverlap returns the Jaccard index of two sets.
+func setOverlap(a map[string]bool, b map[string]bool) float64 {
+	var intersection int
+	for item := range a {
+		if b[item] {
+			intersection++
+		}
+	}
+
+	union := len(a) + len(b) - intersection
+	if union == 0 {
+		return 0
+	}
+
+	return float64(intersection) / float64(union)
+}
+
+func diceCoefficient(a []string, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	counts := make(map[string]int, len(a))
+	for _, token := range a {
+		counts[token]++
+	}
+
+	var shared int
+	for _, token := range b {
+		if counts[token] > 0 {
+			counts[token]--
+			shared++
+		}
+	}
+
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
+
+// sameISRC tells whether both ISRCs are set and identify the same recording.
+func sameISRC(a string, b string) bool {
+	isrc := NormalizeISRC(a)
+	return isrc != "" && isrc == NormalizeISRC(b)
+}
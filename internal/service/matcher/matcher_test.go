@@ -0,0 +1,294 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+var runaway = model.SongOutAPI{
+	ID:          5,
+	Name:        "Runaway",
+	ArtistNames: []string{"Kanye West", "Pusha T"},
+	AlbumName:   "My Beautiful Dark Twisted Fantasy",
+	Duration:    547000,
+}
+
+var runawayCandidates = []model.TrackCandidate{
+	{
+		ProviderTrackID: "karaoke",
+		Name:            "Runaway (Karaoke Version)",
+		ArtistNames:     []string{"Karaoke Hits Band"},
+		AlbumName:       "Karaoke Hits 2010",
+		Duration:        545000,
+		Strategy:        model.MatchStrategyTextSearch,
+	},
+	{
+		ProviderTrackID: "live",
+		Name:            "Runaway - Live",
+		ArtistNames:     []string{"Kanye West", "Pusha T"},
+		AlbumName:       "Live at Coachella",
+		Duration:        600000,
+		Strategy:        model.MatchStrategyTextSearch,
+	},
+	{
+		ProviderTrackID: "original",
+		Name:            "Runaway",
+		ArtistNames:     []string{"Kanye West", "Pusha T"},
+		AlbumName:       "My Beautiful Dark Twisted Fantasy",
+		Duration:        547733,
+		Strategy:        model.MatchStrategyTextSearch,
+	},
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{title: "Runaway", want: "Runaway"},
+		{title: "Here Comes The Sun - Remastered 2009", want: "Here Comes The Sun"},
+		{title: "Love Me (Remastered 2011)", want: "Love Me"},
+		{title: "Devil In A New Dress (feat. Rick Ross)", want: "Devil In A New Dress"},
+		{title: "Monster feat. Jay-Z", want: "Monster"},
+		{title: "Dancing With Myself", want: "Dancing With Myself"},
+		{title: "Stay [with Justin Bieber] - Radio Edit", want: "Stay"},
+		{title: "(Intro)", want: "(Intro)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.want, CleanTitle(tt.title))
+		})
+	}
+}
+
+func TestNormalizeTitle(t *testing.T) {
+	assert.Equal(t, "location unknown", NormalizeTitle("Location Unknown ◐"))
+	assert.Equal(t, "rock and roll", NormalizeTitle("Rock & Roll (Live)"))
+	assert.Equal(t, "don t stop me now", NormalizeTitle("Don't Stop Me Now - 2011 Mix"))
+}
+
+func TestNormalizeArtists(t *testing.T) {
+	got := NormalizeArtists([]string{"Kanye West, Rick Ross"}, "Devil In A New Dress (feat. Rick Ross)")
+	assert.Equal(t, map[string]bool{"kanye west": true, "rick ross": true}, got)
+
+	got = NormalizeArtists([]string{"Honne & Georgia"}, "Location Unknown")
+	assert.Equal(t, map[string]bool{"honne": true, "georgia": true}, got)
+
+	got = NormalizeArtists([]string{"Mumford and Sons"}, "The Cave")
+	assert.Equal(t, map[string]bool{"mumford": true, "sons": true}, got)
+}
+
+func TestSongKey(t *testing.T) {
+	assert.Equal(t,
+		SongKey("The Boxer", []string{"Simon & Garfunkel"}),
+		SongKey("The Boxer - Remastered", []string{"Simon and Garfunkel"}),
+	)
+	assert.Equal(t,
+		SongKey("All of the Lights (feat. Rihanna)", []string{"Kanye West"}),
+		SongKey("All Of The Lights", []string{"Rihanna", "Kanye West"}),
+	)
+	assert.NotEqual(t, SongKey("Power", []string{"Kanye West"}), SongKey("Power", []string{"Little Mix"}))
+	assert.Empty(t, SongKey("!!!", []string{"Kanye West"}))
+}
+
+func TestNormalizeISRC(t *testing.T) {
+	assert.Equal(t, "USUM71027406", NormalizeISRC(" us-um7-10-27406 "))
+	assert.Empty(t, NormalizeISRC(""))
+}
+
+func TestVersionTags(t *testing.T) {
+	assert.Empty(t, VersionTags("Here Comes The Sun - Remastered 2009"))
+	assert.Equal(t, map[string]bool{"live": true}, VersionTags("Runaway - Live"))
+	assert.Equal(t, map[string]bool{"karaoke": true}, VersionTags("Runaway (Karaoke Version)"))
+	assert.Empty(t, VersionTags("Alive"))
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		duration string
+		want     int
+	}{
+		{duration: "PT3M25S", want: 205000},
+		{duration: "PT1H2M3S", want: 3723000},
+		{duration: "PT45S", want: 45000},
+		{duration: "P1DT1S", want: 86401000},
+		{duration: "3:25", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.duration, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseISODuration(tt.duration))
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name      string
+		song      model.SongOutAPI
+		candidate model.TrackCandidate
+		wantMin   float64
+		wantMax   float64
+	}{
+		{
+			name:      "same ISRC",
+			song:      model.SongOutAPI{Name: "Runaway", ISRC: "USUM71027406"},
+			candidate: model.TrackCandidate{Name: "Runaway - Album Version", ISRC: "usum71027406"},
+			wantMin:   1,
+			wantMax:   1,
+		},
+		{
+			name:      "same ISRC with dashes",
+			song:      model.SongOutAPI{Name: "Runaway", ISRC: "US-UM7-10-27406"},
+			candidate: model.TrackCandidate{Name: "Runaway - Album Version", ISRC: "USUM71027406"},
+			wantMin:   1,
+			wantMax:   1,
+		},
+		{
+			name:      "exact metadata",
+			song:      runaway,
+			candidate: runawayCandidates[2],
+			wantMin:   0.99,
+			wantMax:   1,
+		},
+		{
+			name:      "live version is penalized",
+			song:      runaway,
+			candidate: runawayCandidates[1],
+			wantMin:   0,
+			wantMax:   AmbiguousThreshold,
+		},
+		{
+			name:      "karaoke cover is penalized",
+			song:      runaway,
+			candidate: runawayCandidates[0],
+			wantMin:   0,
+			wantMax:   AmbiguousThreshold,
+		},
+		{
+			name: "remaster of the same song",
+			song: model.SongOutAPI{
+				Name:        "Here Comes The Sun",
+				ArtistNames: []string{"The Beatles"},
+				AlbumName:   "Abbey Road",
+				Duration:    185000,
+			},
+			candidate: model.TrackCandidate{
+				Name:        "Here Comes The Sun - Remastered 2009",
+				ArtistNames: []string{"The Beatles"},
+				AlbumName:   "Abbey Road (Remastered)",
+				Duration:    185733,
+			},
+			wantMin: MatchThreshold,
+			wantMax: 1,
+		},
+		{
+			name: "featured artist only in title",
+			song: model.SongOutAPI{
+				Name:        "Devil In A New Dress",
+				ArtistNames: []string{"Kanye West", "Rick Ross"},
+			},
+			candidate: model.TrackCandidate{
+				Name:        "Devil In A New Dress (feat. Rick Ross)",
+				ArtistNames: []string{"Kanye West"},
+			},
+			wantMin: MatchThreshold,
+			wantMax: 1,
+		},
+		{
+			name:      "different song",
+			song:      runaway,
+			candidate: model.TrackCandidate{Name: "Power", ArtistNames: []string{"Kanye West"}, Duration: 292000},
+			wantMin:   0,
+			wantMax:   AmbiguousThreshold,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Score(tt.song, tt.candidate)
+			assert.GreaterOrEqual(t, got, tt.wantMin)
+			assert.LessOrEqual(t, got, tt.wantMax)
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	got := Rank(runaway, runawayCandidates)
+
+	gotIDs := make([]string, len(got))
+	for i, candidate := range got {
+		gotIDs[i] = candidate.ProviderTrackID
+	}
+
+	assert.Equal(t, "original", gotIDs[0])
+	assert.Len(t, got, 3)
+	// the fixture must not be modified
+	assert.Zero(t, runawayCandidates[0].Confidence)
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name           string
+		song           model.SongOutAPI
+		candidates     []model.TrackCandidate
+		wantStatus     model.MatchStatus
+		wantStrategy   model.MatchStrategy
+		wantTrackID    string
+		wantCandidates []string
+	}{
+		{
+			name:         "picks the original over live and karaoke versions",
+			song:         runaway,
+			candidates:   runawayCandidates,
+			wantStatus:   model.MatchStatusMatched,
+			wantStrategy: model.MatchStrategyTextSearch,
+			wantTrackID:  "original",
+		},
+		{
+			name: "ISRC match",
+			song: model.SongOutAPI{Name: "Runaway", ISRC: "USUM71027406"},
+			candidates: []model.TrackCandidate{
+				{ProviderTrackID: "isrc", Name: "Runaway", ISRC: "USUM71027406", Strategy: model.MatchStrategyISRC},
+			},
+			wantStatus:   model.MatchStatusMatched,
+			wantStrategy: model.MatchStrategyISRC,
+			wantTrackID:  "isrc",
+		},
+		{
+			name: "same title and main artist but different length",
+			song: runaway,
+			candidates: []model.TrackCandidate{
+				{ProviderTrackID: "other", Name: "Runaway", ArtistNames: []string{"Kanye West"}, Duration: 565000, Strategy: model.MatchStrategyTextSearch},
+				{ProviderTrackID: "bon-jovi", Name: "Runaway", ArtistNames: []string{"Bon Jovi"}, AlbumName: "Bon Jovi", Duration: 230000, Strategy: model.MatchStrategyTextSearch},
+			},
+			wantStatus:     model.MatchStatusAmbiguous,
+			wantStrategy:   model.MatchStrategyTextSearch,
+			wantTrackID:    "other",
+			wantCandidates: []string{"other"},
+		},
+		{
+			name:       "only covers",
+			song:       runaway,
+			candidates: runawayCandidates[:2],
+			wantStatus: model.MatchStatusUnmatched,
+		},
+		{
+			name:       "no candidates",
+			song:       runaway,
+			candidates: nil,
+			wantStatus: model.MatchStatusUnmatched,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Match(tt.song, tt.candidates)
+			assert.Equal(t, tt.song, got.Song)
+			assert.Equal(t, tt.wantStatus, got.Status)
+			assert.Equal(t, tt.wantStrategy, got.Strategy)
+			assert.Equal(t, tt.wantTrackID, got.ProviderTrackID)
+			assert.Equal(t, tt.wantCandidates, got.CandidateTrackIDs)
+		})
+	}
+}
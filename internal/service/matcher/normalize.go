@@ -0,0 +1,108 @@
+package matcher
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var (
+	bracketedPattern    = regexp.MustCompile(`\s*[\(\[][^\)\]]*[\)\]]`)
+	dashSuffixPattern   = regexp.MustCompile(`\s+-\s+.*$`)
+	featuringPattern    = regexp.MustCompile(`(?i)\s*(?:[\(\[](?:feat\.?|ft\.?|featuring|with)\s+([^\)\]]+)[\)\]]|\s(?:feat\.?|ft\.?|featuring)\s+(.+)$)`)
+	artistSplitPattern  = regexp.MustCompile(`(?i)\s*(?:,|&|\band\b|\bfeat\.|\bft\.|\bfeaturing\b)\s*`)
+	whitespacePattern   = regexp.MustCompile(`\s+`)
+	versionKeywordRegex = regexp.MustCompile(`(?i)\b(live|karaoke|instrumental|acoustic|remix|cover|demo|sped up|slowed|8d|nightcore)\b`)
+)
+
+// CleanTitle removes featured artists, bracketed notes like "(Remastered 2011)" and dash suffixes like "- Radio Edit"
+// while keeping the original casing, so it can be used in provider search queries.
+func CleanTitle(title string) string {
+	cleaned := featuringPattern.ReplaceAllString(title, "")
+	cleaned = bracketedPattern.ReplaceAllString(cleaned, "")
+	cleaned = dashSuffixPattern.ReplaceAllString(cleaned, "")
+	cleaned = strings.TrimSpace(whitespacePattern.ReplaceAllString(cleaned, " "))
+
+	// a title that is only a bracketed note or a suffix is better left untouched
+	if cleaned == "" {
+		return strings.TrimSpace(title)
+	}
+
+	return cleaned
+}
+
+// NormalizeTitle returns a lower case title without suffixes or punctuation, suitable for comparison.
+func NormalizeTitle(title string) string {
+	return normalizeText(CleanTitle(title))
+}
+
+// NormalizeArtists splits and normalizes artist names, including the artists featured in the title.
+func NormalizeArtists(artistNames []string, title string) map[string]bool {
+	artists := make(map[string]bool)
+
+	add := func(names string) {
+		for _, name := range artistSplitPattern.Split(names, -1) {
+			if normalized := normalizeText(name); normalized != "" {
+				artists[normalized] = true
+			}
+		}
+	}
+
+	for _, artistName := range artistNames {
+		add(artistName)
+	}
+	for _, match := range featuringPattern.FindAllStringSubmatch(title, -1) {
+		add(match[1] + match[2])
+	}
+
+	return artists
+}
+
+// SongKey returns the same key for songs with the same normalized title and artists, in any order,
+// or an empty key when nothing is left of the title once it's normalized.
+func SongKey(title string, artistNames []string) string {
+	normalizedTitle := NormalizeTitle(title)
+	if normalizedTitle == "" {
+		return ""
+	}
+
+	artists := make([]string, 0, len(artistNames))
+	for artist := range NormalizeArtists(artistNames, title) {
+		artists = append(artists, artist)
+	}
+	slices.Sort(artists)
+	return normalizedTitle + "\x00" + strings.Join(artists, "\x00")
+}
+
+// NormalizeISRC returns the ISRC in upper case without the dashes some providers format it with,
+// so the same recording has the same ISRC wherever it comes from.
+func NormalizeISRC(isrc string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(isrc), "-", ""))
+}
+
+// VersionTags returns the version keywords (live, karaoke, remix...) found in a title.
+func VersionTags(title string) map[string]bool {
+	tags := make(map[string]bool)
+	for _, match := range versionKeywordRegex.FindAllString(title, -1) {
+		tags[strings.ToLower(match)] = true
+	}
+
+	return tags
+}
+
+func normalizeText(text string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			builder.WriteRune(r)
+		case r == '&':
+			builder.WriteString(" and ")
+		default:
+			builder.WriteRune(' ')
+		}
+	}
+
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(builder.String(), " "))
+}
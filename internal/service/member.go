@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+const defaultInviteExpiry = 72 * time.Hour
+
+type PlaylistMemberRepository interface {
+	SelectRole(ctx context.Context, playlistID int, userID string) (model.PlaylistRole, bool, error)
+	SelectAll(ctx context.Context, playlistID int) ([]model.PlaylistMember, error)
+	Save(ctx context.Context, playlistID int, userID string, role model.PlaylistRole) error
+	Delete(ctx context.Context, playlistID int, userID string) error
+	InsertInvite(ctx context.Context, invite model.PlaylistInvite) error
+	SelectInvite(ctx context.Context, token string) (model.PlaylistInvite, bool, error)
+	DeleteInvite(ctx context.Context, playlistID int, token string) error
+}
+
+type MemberService struct {
+	memberRepo PlaylistMemberRepository
+}
+
+func NewMember(memberRepo PlaylistMemberRepository) *MemberService {
+	return &MemberService{
+		memberRepo: memberRepo,
+	}
+}
+
+// CheckRole returns model.ErrPlaylistNotFound when the playlist doesn't exist,
+// and model.ErrPlaylistForbidden when the user doesn't have the role on it.
+func (m *MemberService) CheckRole(ctx context.Context, playlistID int, userID string, role model.PlaylistRole) error {
+	userRole, found, err := m.memberRepo.SelectRole(ctx, playlistID, userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return model.ErrPlaylistNotFound
+	}
+	if !userRole.Includes(role) {
+		return model.ErrPlaylistForbidden
+	}
+
+	return nil
+}
+
+func (m *MemberService) GetAll(ctx context.Context, playlistID int) ([]model.PlaylistMember, error) {
+	return m.memberRepo.SelectAll(ctx, playlistID)
+}
+
+// UpdateRole changes the role of a member. The owner keeps their role.
+func (m *MemberService) UpdateRole(ctx context.Context, playlistID int, userID string, role model.PlaylistRole) error {
+	err := m.checkNotOwner(ctx, playlistID, userID)
+	if err != nil {
+		return err
+	}
+
+	return m.memberRepo.Save(ctx, playlistID, userID, role)
+}
+
+// Remove takes the user out of the playlist members. The owner can't be removed.
+func (m *MemberService) Remove(ctx context.Context, playlistID int, userID string) error {
+	err := m.checkNotOwner(ctx, playlistID, userID)
+	if err != nil {
+		return err
+	}
+
+	return m.memberRepo.Delete(ctx, playlistID, userID)
+}
+
+// Invite creates an invite link token that gives its role on the playlist to whoever accepts it before it expires.
+func (m *MemberService) Invite(ctx context.Context, playlistID int, createdBy string, inviteIn model.PlaylistInviteIn) (model.PlaylistInvite, error) {
+	token, err := newToken()
+	if err != nil {
+		return model.PlaylistInvite{}, err
+	}
+
+	expiry := defaultInviteExpiry
+	if inviteIn.ExpiresInHours > 0 {
+		expiry = time.Duration(inviteIn.ExpiresInHours) * time.Hour
+	}
+
+	invite := model.PlaylistInvite{
+		Token:      token,
+		PlaylistID: playlistID,
+		Role:       inviteIn.Role,
+		CreatedBy:  createdBy,
+		// expires_at has no time zone and is compared with the database time, which is in UTC
+		ExpiresAt: time.Now().UTC().Add(expiry),
+	}
+
+	err = m.memberRepo.InsertInvite(ctx, invite)
+	if err != nil {
+		return model.PlaylistInvite{}, err
+	}
+
+	return invite, nil
+}
+
+func (m *MemberService) RevokeInvite(ctx context.Context, playlistID int, token string) error {
+	return m.memberRepo.DeleteInvite(ctx, playlistID, token)
+}
+
+// AcceptInvite makes the user a member of the invite playlist. Members who already have a higher role keep it.
+func (m *MemberService) AcceptInvite(ctx context.Context, token string, userID string) (model.PlaylistInvite, error) {
+	invite, found, err := m.memberRepo.SelectInvite(ctx, token)
+	if err != nil {
+		return model.PlaylistInvite{}, err
+	}
+	if !found {
+		return model.PlaylistInvite{}, model.ErrInviteNotFound
+	}
+
+	role, _, err := m.memberRepo.SelectRole(ctx, invite.PlaylistID, userID)
+	if err != nil {
+		return model.PlaylistInvite{}, err
+	}
+	if role.Includes(invite.Role) {
+		return invite, nil
+	}
+
+	err = m.memberRepo.Save(ctx, invite.PlaylistID, userID, invite.Role)
+	if err != nil {
+		return model.PlaylistInvite{}, err
+	}
+
+	return invite, nil
+}
+
+func (m *MemberService) checkNotOwner(ctx context.Context, playlistID int, userID string) error {
+	role, found, err := m.memberRepo.SelectRole(ctx, playlistID, userID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return model.ErrPlaylistNotFound
+	}
+	if role == "" {
+		return model.ErrMemberNotFound
+	}
+	if role == model.PlaylistRoleOwner {
+		return model.ErrOwnerRoleReserved
+	}
+
+	return nil
+}
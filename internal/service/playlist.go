@@ -3,6 +3,9 @@ package service
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"mime/multipart"
 	"strconv"
 	"strings"
@@ -11,11 +14,20 @@ import (
 )
 
 type PlaylistRepository interface {
-	Insert(ctx context.Context, playlistModel model.PlaylistInDB) error
+	Insert(ctx context.Context, playlistModel model.PlaylistInDB) (int, error)
 	SelectAll(ctx context.Context, userID string) ([]model.Playlist, error)
 	SelectWithID(ctx context.Context, id int) (model.Playlist, error)
-	DeleteByID(ctx context.Context, id int) error
+	Trash(ctx context.Context, id int) error
+	Duplicate(ctx context.Context, id int, userID string, name string) (int, error)
+	Update(ctx context.Context, id int, playlistModel model.PlaylistUpdateInDB) (string, error)
+	UpdateSmartRules(ctx context.Context, id int, rules model.SmartPlaylistRules) (bool, error)
+	Freeze(ctx context.Context, id int, addedBy string) (bool, error)
 	AddPlaylistPicture(ctx context.Context, file multipart.File, header *multipart.FileHeader) (string, error)
+	AddPlaylistPictureFromURL(ctx context.Context, imageURL string) (string, error)
+	AddDefaultPlaylistPicture(ctx context.Context) (string, error)
+	DeletePlaylistPicture(ctx context.Context, objectName string) error
+	CopyPlaylistPicture(ctx context.Context, id int) (string, error)
+	Discard(ctx context.Context, id int) error
 }
 
 type SongRepository interface {
@@ -23,9 +35,21 @@ type SongRepository interface {
 }
 
 type PlaylistSongRepository interface {
-	BulkInsert(ctx context.Context, playlistID int, songsID []int) error
+	BulkInsert(ctx context.Context, playlistID int, songsID []int, addedBy string) error
+	InsertAt(ctx context.Context, playlistID int, songsID []int, position int, addedBy string) error
+	MoveRange(ctx context.Context, playlistID int, rangeStart int, rangeLength int, insertBefore int) error
+	Reorder(ctx context.Context, playlistID int, songsID []int) error
 	GetAll(ctx context.Context, playlistID int, sortBy string, sortOrder string) ([]model.SongOutAPI, error)
 	BulkDelete(ctx context.Context, playlistID int, songsID []int) error
+	// Rewrite replaces the songs of the playlist with the songs rewrite returns for its current songs
+	// and records the change as a version, in one transaction.
+	Rewrite(
+		ctx context.Context,
+		playlistID int,
+		addedBy string,
+		change model.PlaylistChange,
+		rewrite func(songs []model.SongOutAPI) ([]int, error),
+	) error
 }
 
 type AlbumRepository interface {
@@ -44,8 +68,14 @@ type ArtistAlbumRepository interface {
 	Insert(ctx context.Context, artistID int, albumID int) error
 }
 
-type Converter interface {
-	Export(ctx context.Context, playlistName string, songs []model.SongOutAPI) error
+// PlaylistRoleChecker tells whether a user has a role on a playlist.
+type PlaylistRoleChecker interface {
+	CheckRole(ctx context.Context, playlistID int, userID string, role model.PlaylistRole) error
+}
+
+type Importer interface {
+	ListPlaylists(ctx context.Context) ([]model.RemotePlaylist, error)
+	Import(ctx context.Context, playlistID string) (model.ImportedPlaylist, error)
 }
 
 type PlaylistService struct {
@@ -56,6 +86,8 @@ type PlaylistService struct {
 	artistRepo       ArtistRepository
 	artistSongRepo   ArtistSongRepository
 	artistAlbumRepo  ArtistAlbumRepository
+	roleChecker      PlaylistRoleChecker
+	providers        *ProviderRegistry
 }
 
 func NewPlaylist(
@@ -66,6 +98,8 @@ func NewPlaylist(
 	artistRepo ArtistRepository,
 	artistSongRepo ArtistSongRepository,
 	artistAlbumRepo ArtistAlbumRepository,
+	roleChecker PlaylistRoleChecker,
+	providers *ProviderRegistry,
 ) *PlaylistService {
 	return &PlaylistService{
 		playlistRepo:     playlistRepo,
@@ -75,6 +109,8 @@ func NewPlaylist(
 		artistRepo:       artistRepo,
 		artistSongRepo:   artistSongRepo,
 		artistAlbumRepo:  artistAlbumRepo,
+		roleChecker:      roleChecker,
+		providers:        providers,
 	}
 }
 
@@ -84,6 +120,13 @@ func (p *PlaylistService) Add(
 	imageFile multipart.File,
 	imageHeader *multipart.FileHeader,
 ) error {
+	if playlistModel.SmartRules != nil {
+		err := p.checkSmartRules(ctx, playlistModel.UserID, *playlistModel.SmartRules)
+		if err != nil {
+			return err
+		}
+	}
+
 	imageName, err := p.playlistRepo.AddPlaylistPicture(ctx, imageFile, imageHeader)
 	if err != nil {
 		return err
@@ -93,11 +136,12 @@ func (p *PlaylistService) Add(
 		Name:                playlistModel.Name,
 		PlaylistDescription: playlistModel.PlaylistDescription,
 		UserID:              playlistModel.UserID,
-		Username:            playlistModel.Username,
 		ImageName:           imageName,
+		SmartRules:          playlistModel.SmartRules,
 	}
 
-	return p.playlistRepo.Insert(ctx, playlistInDBModel)
+	_, err = p.playlistRepo.Insert(ctx, playlistInDBModel)
+	return err
 }
 
 func (p *PlaylistService) GetAll(ctx context.Context, userID string) ([]model.Playlist, error) {
@@ -108,26 +152,166 @@ func (p *PlaylistService) GetByID(ctx context.Context, id int) (model.Playlist,
 	return p.playlistRepo.SelectWithID(ctx, id)
 }
 
+// Duplicate copies the playlist, its cover and its songs to a new playlist of the user and returns it.
+func (p *PlaylistService) Duplicate(ctx context.Context, id int, userID string, duplicateIn model.PlaylistDuplicateIn) (model.Playlist, error) {
+	playlistID, err := p.playlistRepo.Duplicate(ctx, id, userID, duplicateIn.Name)
+	if err != nil {
+		return model.Playlist{}, err
+	}
+
+	return p.playlistRepo.SelectWithID(ctx, playlistID)
+}
+
+// DeleteByID moves the playlist to the trash, where it's purged after the trash retention.
 func (p *PlaylistService) DeleteByID(ctx context.Context, id int) error {
-	return p.playlistRepo.DeleteByID(ctx, id)
+	return p.playlistRepo.Trash(ctx, id)
+}
+
+func (p *PlaylistService) Update(
+	ctx context.Context,
+	id int,
+	playlistModel model.PlaylistUpdate,
+	imageFile multipart.File,
+	imageHeader *multipart.FileHeader,
+) (model.Playlist, error) {
+	playlistUpdateInDBModel := model.PlaylistUpdateInDB{
+		Name:                playlistModel.Name,
+		PlaylistDescription: playlistModel.PlaylistDescription,
+	}
+
+	if imageFile != nil {
+		imageName, err := p.playlistRepo.AddPlaylistPicture(ctx, imageFile, imageHeader)
+		if err != nil {
+			return model.Playlist{}, err
+		}
+		playlistUpdateInDBModel.ImageName = &imageName
+	}
+
+	oldImageName, err := p.playlistRepo.Update(ctx, id, playlistUpdateInDBModel)
+	if err != nil {
+		// the new cover is not referenced by any playlist so remove it
+		if playlistUpdateInDBModel.ImageName != nil {
+			if deleteErr := p.playlistRepo.DeletePlaylistPicture(ctx, *playlistUpdateInDBModel.ImageName); deleteErr != nil {
+				log.Printf("error removing unused playlist cover %s: %v", *playlistUpdateInDBModel.ImageName, deleteErr)
+			}
+		}
+		return model.Playlist{}, err
+	}
+
+	// the update is committed, a cover left behind is only wasted storage
+	if playlistUpdateInDBModel.ImageName != nil && oldImageName != *playlistUpdateInDBModel.ImageName {
+		if deleteErr := p.playlistRepo.DeletePlaylistPicture(ctx, oldImageName); deleteErr != nil {
+			log.Printf("error removing replaced playlist cover %s: %v", oldImageName, deleteErr)
+		}
+	}
+
+	return p.playlistRepo.SelectWithID(ctx, id)
+}
+
+// UpdateSmartRules replaces the rules of the smart playlist with the rules of the user and returns it.
+func (p *PlaylistService) UpdateSmartRules(ctx context.Context, id int, userID string, rules model.SmartPlaylistRules) (model.Playlist, error) {
+	err := p.checkSmartRules(ctx, userID, rules)
+	if err != nil {
+		return model.Playlist{}, err
+	}
+
+	updated, err := p.playlistRepo.UpdateSmartRules(ctx, id, rules)
+	if err != nil {
+		return model.Playlist{}, err
+	}
+	if !updated {
+		return model.Playlist{}, model.ErrPlaylistNotSmart
+	}
+
+	return p.playlistRepo.SelectWithID(ctx, id)
+}
+
+// checkSmartRules validates the rules of the user, who has to be able to view every playlist they name.
+// The rules are evaluated with the memberships of the owner of the smart playlist, so without this check
+// an editor could read the songs of playlists of the owner they aren't a member of.
+func (p *PlaylistService) checkSmartRules(ctx context.Context, userID string, rules model.SmartPlaylistRules) error {
+	err := validateSmartRules(rules)
+	if err != nil {
+		return err
+	}
+
+	return p.checkRulePlaylists(ctx, userID, rules)
+}
+
+// checkRulePlaylists checks that the user can see the playlists named by in_playlist rules.
+func (p *PlaylistService) checkRulePlaylists(ctx context.Context, userID string, rules model.SmartPlaylistRules) error {
+	for _, rule := range rules.Rules {
+		for _, playlistID := range rule.PlaylistIDs {
+			err := p.roleChecker.CheckRole(ctx, playlistID, userID, model.PlaylistRoleViewer)
+			if errors.Is(err, model.ErrPlaylistNotFound) {
+				return fmt.Errorf("%w: playlist %d not found", model.ErrInvalidSmartRules, playlistID)
+			}
+			if err != nil {
+				return fmt.Errorf("playlist %d in rules: %w", playlistID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Freeze turns the smart playlist into a playlist with the songs currently matching its rules and returns it.
+// The user freezing it copies the songs of the playlists its rules name, so they have to be able to see them.
+func (p *PlaylistService) Freeze(ctx context.Context, id int, userID string) (model.Playlist, error) {
+	playlist, err := p.playlistRepo.SelectWithID(ctx, id)
+	if err != nil {
+		return model.Playlist{}, err
+	}
+	if playlist.SmartRules == nil {
+		return model.Playlist{}, model.ErrPlaylistNotSmart
+	}
+
+	err = p.checkRulePlaylists(ctx, userID, *playlist.SmartRules)
+	if err != nil {
+		return model.Playlist{}, err
+	}
+
+	frozen, err := p.playlistRepo.Freeze(ctx, id, userID)
+	if err != nil {
+		return model.Playlist{}, err
+	}
+	if !frozen {
+		return model.Playlist{}, model.ErrPlaylistNotSmart
+	}
+
+	return p.playlistRepo.SelectWithID(ctx, id)
 }
 
-func (p *PlaylistService) AddSongsToPlaylist(ctx context.Context, playlistID int, songs []model.SongInAPI) error {
+func (p *PlaylistService) AddSongsToPlaylist(ctx context.Context, playlistID int, songs []model.SongInAPI, addedBy string) error {
+	return p.AddSongsToPlaylistAt(ctx, playlistID, songs, -1, addedBy)
+}
+
+func (p *PlaylistService) AddSongsToPlaylistAt(ctx context.Context, playlistID int, songs []model.SongInAPI, position int, addedBy string) error {
+	songsID, err := p.SaveSongs(ctx, songs)
+	if err != nil {
+		return err
+	}
+
+	return p.playlistSongRepo.InsertAt(ctx, playlistID, songsID, position, addedBy)
+}
+
+// SaveSongs adds the songs, their album and artists to the catalog and returns the song IDs in order.
+func (p *PlaylistService) SaveSongs(ctx context.Context, songs []model.SongInAPI) ([]int, error) {
 	var songsID []int
 	for _, song := range songs {
 		albumID, err := p.albumRepo.InsertAndGetID(ctx, song.AlbumName)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		artistIDs, err := p.artistRepo.BulkInsertAndGetIDs(ctx, song.ArtistNames)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		err = p.artistAlbumRepo.Insert(ctx, artistIDs[0], albumID)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		songID, err := p.songRepo.InsertAndGetID(ctx, model.SongInDB{
@@ -138,26 +322,22 @@ func (p *PlaylistService) AddSongsToPlaylist(ctx context.Context, playlistID int
 			ISRC:     song.ISRC,
 		})
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		err = p.artistSongRepo.Insert(ctx, songID, artistIDs)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		songsID = append(songsID, songID)
 
 	}
 
-	err := p.playlistSongRepo.BulkInsert(ctx, playlistID, songsID)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return songsID, nil
 }
 
+// GetAllSongsFromPlaylist returns the songs of the playlist, the songs matching the rules for a smart playlist.
 func (p *PlaylistService) GetAllSongsFromPlaylist(
 	ctx context.Context,
 	playlistID int,
@@ -171,19 +351,96 @@ func (p *PlaylistService) DeleteSongsFromPlaylist(ctx context.Context, playlistI
 	return p.playlistSongRepo.BulkDelete(ctx, playlistID, songsID)
 }
 
-func (p *PlaylistService) Convert(
+func (p *PlaylistService) MoveSongsInPlaylist(ctx context.Context, playlistID int, rangeStart int, rangeLength int, insertBefore int) error {
+	return p.playlistSongRepo.MoveRange(ctx, playlistID, rangeStart, rangeLength, insertBefore)
+}
+
+func (p *PlaylistService) ReorderSongsInPlaylist(ctx context.Context, playlistID int, songsID []int) error {
+	return p.playlistSongRepo.Reorder(ctx, playlistID, songsID)
+}
+
+func (p *PlaylistService) ListRemotePlaylists(
 	ctx context.Context,
 	provider string,
 	providerMetadata model.ConverterServiceProviderMetadata,
-	playlistName string,
-	songs []model.SongOutAPI,
-) error {
-	converter, err := getConverter(ctx, provider, providerMetadata)
+) ([]model.RemotePlaylist, error) {
+	importer, err := p.providers.Importer(ctx, provider, providerMetadata)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return converter.Export(ctx, playlistName, songs)
+	return importer.ListPlaylists(ctx)
+}
+
+func (p *PlaylistService) Import(
+	ctx context.Context,
+	provider string,
+	providerMetadata model.ConverterServiceProviderMetadata,
+	remotePlaylistID string,
+	playlistModel model.PlaylistIn,
+) (model.Playlist, error) {
+	importer, err := p.providers.Importer(ctx, provider, providerMetadata)
+	if err != nil {
+		return model.Playlist{}, err
+	}
+
+	importedPlaylist, err := importer.Import(ctx, remotePlaylistID)
+	if err != nil {
+		return model.Playlist{}, err
+	}
+
+	if playlistModel.Name == "" {
+		playlistModel.Name = importedPlaylist.Name
+	}
+	if playlistModel.PlaylistDescription == "" {
+		playlistModel.PlaylistDescription = importedPlaylist.Description
+	}
+
+	imageURL := importedPlaylist.ImageURL
+	if imageURL == "" && len(importedPlaylist.Songs) > 0 {
+		imageURL = importedPlaylist.Songs[0].ImageURL
+	}
+	// playlists without artwork or songs get the default cover
+	var imageName string
+	if imageURL != "" {
+		imageName, err = p.playlistRepo.AddPlaylistPictureFromURL(ctx, imageURL)
+	} else {
+		imageName, err = p.playlistRepo.AddDefaultPlaylistPicture(ctx)
+	}
+	if err != nil {
+		return model.Playlist{}, err
+	}
+
+	playlistID, err := p.playlistRepo.Insert(ctx, model.PlaylistInDB{
+		Name:                playlistModel.Name,
+		PlaylistDescription: playlistModel.PlaylistDescription,
+		UserID:              playlistModel.UserID,
+		ImageName:           imageName,
+	})
+	if err != nil {
+		// the cover is not referenced by any playlist so remove it
+		if deleteErr := p.playlistRepo.DeletePlaylistPicture(ctx, imageName); deleteErr != nil {
+			log.Printf("error removing unused playlist cover %s: %v", imageName, deleteErr)
+		}
+		return model.Playlist{}, err
+	}
+
+	if len(importedPlaylist.Songs) > 0 {
+		err = p.AddSongsToPlaylist(ctx, playlistID, importedPlaylist.Songs, playlistModel.UserID)
+		if err != nil {
+			p.discardPlaylist(ctx, playlistID)
+			return model.Playlist{}, err
+		}
+	}
+
+	return p.playlistRepo.SelectWithID(ctx, playlistID)
+}
+
+// discardPlaylist removes the playlist whose creation failed, along with its cover.
+func (p *PlaylistService) discardPlaylist(ctx context.Context, playlistID int) {
+	if err := p.playlistRepo.Discard(ctx, playlistID); err != nil {
+		log.Printf("error removing playlist %d whose creation failed: %v", playlistID, err)
+	}
 }
 
 func (p *PlaylistService) ConvertSongsToCsv(songs []model.SongOutAPI) (bytes.Buffer, error) {
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+// fakePlaylistRepository only implements the methods the tests need, the others panic.
+type fakePlaylistRepository struct {
+	PlaylistRepository
+	smartRules map[int]model.SmartPlaylistRules
+	// frozen are the playlists that were smart playlists until they were frozen
+	frozen map[int]bool
+}
+
+func (f *fakePlaylistRepository) UpdateSmartRules(ctx context.Context, id int, rules model.SmartPlaylistRules) (bool, error) {
+	f.smartRules[id] = rules
+	return true, nil
+}
+
+func (f *fakePlaylistRepository) Freeze(ctx context.Context, id int, addedBy string) (bool, error) {
+	if _, ok := f.smartRules[id]; !ok {
+		return false, nil
+	}
+	delete(f.smartRules, id)
+	f.frozen[id] = true
+	return true, nil
+}
+
+func (f *fakePlaylistRepository) SelectWithID(ctx context.Context, id int) (model.Playlist, error) {
+	if rules, ok := f.smartRules[id]; ok {
+		return model.Playlist{ID: id, SmartRules: &rules}, nil
+	}
+	if f.frozen[id] {
+		return model.Playlist{ID: id}, nil
+	}
+	return model.Playlist{}, model.ErrPlaylistNotFound
+}
+
+// fakeRoleChecker gives users the viewer role on the playlists they are listed on.
+type fakeRoleChecker map[int][]string
+
+func (f fakeRoleChecker) CheckRole(ctx context.Context, playlistID int, userID string, role model.PlaylistRole) error {
+	users, ok := f[playlistID]
+	if !ok {
+		return model.ErrPlaylistNotFound
+	}
+	for _, user := range users {
+		if user == userID {
+			return nil
+		}
+	}
+	return model.ErrPlaylistForbidden
+}
+
+func TestPlaylistServiceUpdateSmartRules(t *testing.T) {
+	const smartPlaylistID = 1
+	// the owner shares the smart playlist 1 with the editor but keeps the playlist 2 private
+	roles := fakeRoleChecker{
+		smartPlaylistID: {"owner", "editor"},
+		2:               {"owner"},
+		3:               {"owner", "editor"},
+	}
+
+	tests := []struct {
+		name        string
+		userID      string
+		playlistIDs []int
+		wantErr     error
+	}{
+		{
+			name:        "owner naming their playlists",
+			userID:      "owner",
+			playlistIDs: []int{2, 3},
+		},
+		{
+			name:        "editor naming a shared playlist",
+			userID:      "editor",
+			playlistIDs: []int{3},
+		},
+		{
+			name:        "editor naming a private playlist of the owner",
+			userID:      "editor",
+			playlistIDs: []int{3, 2},
+			wantErr:     model.ErrPlaylistForbidden,
+		},
+		{
+			name:        "playlist that doesn't exist",
+			userID:      "owner",
+			playlistIDs: []int{4},
+			wantErr:     model.ErrInvalidSmartRules,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playlistRepo := &fakePlaylistRepository{smartRules: map[int]model.SmartPlaylistRules{}}
+			playlistService := NewPlaylist(playlistRepo, nil, nil, nil, nil, nil, nil, roles, nil)
+
+			rules := model.SmartPlaylistRules{Rules: []model.SmartPlaylistRule{
+				{Field: model.SmartRuleInPlaylist, PlaylistIDs: tt.playlistIDs},
+			}}
+			_, err := playlistService.UpdateSmartRules(context.Background(), smartPlaylistID, tt.userID, rules)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, playlistRepo.smartRules)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, rules, playlistRepo.smartRules[smartPlaylistID])
+		})
+	}
+}
+
+func TestPlaylistServiceFreeze(t *testing.T) {
+	const smartPlaylistID = 1
+	// the owner shares the smart playlist 1 with the editor but keeps the playlist 2 it names private
+	roles := fakeRoleChecker{
+		smartPlaylistID: {"owner", "editor"},
+		2:               {"owner"},
+		3:               {"owner"},
+	}
+
+	tests := []struct {
+		name       string
+		userID     string
+		playlistID int
+		wantErr    error
+	}{
+		{
+			name:       "owner",
+			userID:     "owner",
+			playlistID: smartPlaylistID,
+		},
+		{
+			name:       "editor who can't see a playlist the rules name",
+			userID:     "editor",
+			playlistID: smartPlaylistID,
+			wantErr:    model.ErrPlaylistForbidden,
+		},
+		{
+			name:       "playlist that isn't a smart playlist",
+			userID:     "owner",
+			playlistID: 3,
+			wantErr:    model.ErrPlaylistNotSmart,
+		},
+		{
+			name:       "playlist that doesn't exist",
+			userID:     "owner",
+			playlistID: 4,
+			wantErr:    model.ErrPlaylistNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			playlistRepo := &fakePlaylistRepository{
+				smartRules: map[int]model.SmartPlaylistRules{
+					smartPlaylistID: {Rules: []model.SmartPlaylistRule{{Field: model.SmartRuleInPlaylist, PlaylistIDs: []int{2}}}},
+				},
+				frozen: map[int]bool{3: true},
+			}
+			playlistService := NewPlaylist(playlistRepo, nil, nil, nil, nil, nil, nil, roles, nil)
+
+			playlist, err := playlistService.Freeze(context.Background(), tt.playlistID, tt.userID)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Contains(t, playlistRepo.smartRules, smartPlaylistID)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.playlistID, playlist.ID)
+			assert.Nil(t, playlist.SmartRules)
+		})
+	}
+}
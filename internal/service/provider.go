@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/markbates/goth"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"golang.org/x/oauth2"
+)
+
+// ProviderRegistration describes a music provider. NewConverter is required, the other
+// factories are nil when the provider doesn't support importing or two-way sync.
+type ProviderRegistration struct {
+	Info model.ProviderInfo
+	// OAuth is the goth provider users log in with when Info.Auth is model.ProviderAuthOAuth
+	OAuth           goth.Provider
+	NewConverter    func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (Converter, error)
+	NewImporter     func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (Importer, error)
+	NewTwoWaySyncer func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (TwoWaySyncer, error)
+}
+
+// TokenSource returns the token of a user for an OAuth provider.
+type TokenSource interface {
+	Token(ctx context.Context, userID string, provider string) (*oauth2.Token, error)
+}
+
+// ProviderRegistry holds the providers playlists can be exported to, in the order they were registered.
+type ProviderRegistry struct {
+	providers map[string]ProviderRegistration
+	names     []string
+	tokens    TokenSource
+}
+
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{
+		providers: make(map[string]ProviderRegistration),
+	}
+}
+
+// Register adds a provider. Its export, import and two-way sync capabilities come from the factories it has.
+func (r *ProviderRegistry) Register(registration ProviderRegistration) error {
+	name := registration.Info.Name
+	if name == "" {
+		return errors.New("provider has no name")
+	}
+	if _, exists := r.providers[name]; exists {
+		return fmt.Errorf("provider %s is already registered", name)
+	}
+	if registration.NewConverter == nil {
+		return fmt.Errorf("provider %s has no converter", name)
+	}
+	if registration.Info.Auth == model.ProviderAuthOAuth && registration.OAuth == nil {
+		return fmt.Errorf("provider %s logs in with OAuth but has no OAuth provider", name)
+	}
+
+	registration.Info.Capabilities.Export = true
+	registration.Info.Capabilities.Import = registration.NewImporter != nil
+	registration.Info.Capabilities.TwoWaySync = registration.NewTwoWaySyncer != nil
+	if registration.Info.Metadata == nil {
+		registration.Info.Metadata = []model.ProviderMetadataField{}
+	}
+
+	r.providers[name] = registration
+	r.names = append(r.names, name)
+
+	return nil
+}
+
+func (r *ProviderRegistry) Get(name string) (model.ProviderInfo, bool) {
+	registration, ok := r.providers[name]
+	return registration.Info, ok
+}
+
+func (r *ProviderRegistry) List() []model.ProviderInfo {
+	providers := make([]model.ProviderInfo, len(r.names))
+	for i, name := range r.names {
+		providers[i] = r.providers[name].Info
+	}
+	return providers
+}
+
+// OAuthProviders returns the goth providers to log in with.
+func (r *ProviderRegistry) OAuthProviders() []goth.Provider {
+	var providers []goth.Provider
+	for _, name := range r.names {
+		if oauthProvider := r.providers[name].OAuth; oauthProvider != nil {
+			providers = append(providers, oauthProvider)
+		}
+	}
+	return providers
+}
+
+func (r *ProviderRegistry) OAuthProvider(name string) (goth.Provider, bool) {
+	oauthProvider := r.providers[name].OAuth
+	return oauthProvider, oauthProvider != nil
+}
+
+// UseTokenSource sets where the tokens of OAuth providers come from.
+func (r *ProviderRegistry) UseTokenSource(tokens TokenSource) {
+	r.tokens = tokens
+}
+
+// Authorize fills in the token of OAuth providers from the credentials of the user the provider metadata belongs to.
+// It returns model.ErrProviderNotConnected when the user isn't logged in to the provider.
+func (r *ProviderRegistry) Authorize(
+	ctx context.Context,
+	provider string,
+	providerMetadata model.ConverterServiceProviderMetadata,
+) (model.ConverterServiceProviderMetadata, error) {
+	registration, ok := r.providers[provider]
+	if !ok || registration.Info.Auth != model.ProviderAuthOAuth {
+		return providerMetadata, nil
+	}
+
+	if providerMetadata.UserID == "" || r.tokens == nil {
+		return model.ConverterServiceProviderMetadata{}, model.ErrProviderNotConnected
+	}
+
+	token, err := r.tokens.Token(ctx, providerMetadata.UserID, provider)
+	if err != nil {
+		return model.ConverterServiceProviderMetadata{}, err
+	}
+	providerMetadata.Token = token
+
+	return providerMetadata, nil
+}
+
+func (r *ProviderRegistry) Converter(ctx context.Context, provider string, providerMetadata model.ConverterServiceProviderMetadata) (Converter, error) {
+	registration, ok := r.providers[provider]
+	if !ok {
+		return nil, errors.New("no converter available")
+	}
+
+	providerMetadata, err := r.Authorize(ctx, provider, providerMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return registration.NewConverter(ctx, providerMetadata)
+}
+
+func (r *ProviderRegistry) Importer(ctx context.Context, provider string, providerMetadata model.ConverterServiceProviderMetadata) (Importer, error) {
+	registration, ok := r.providers[provider]
+	if !ok || registration.NewImporter == nil {
+		return nil, errors.New("no importer available")
+	}
+
+	providerMetadata, err := r.Authorize(ctx, provider, providerMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return registration.NewImporter(ctx, providerMetadata)
+}
+
+func (r *ProviderRegistry) TwoWaySyncer(ctx context.Context, provider string, providerMetadata model.ConverterServiceProviderMetadata) (TwoWaySyncer, error) {
+	registration, ok := r.providers[provider]
+	if !ok || registration.NewTwoWaySyncer == nil {
+		return nil, model.ErrTwoWaySyncUnsupported
+	}
+
+	providerMetadata, err := r.Authorize(ctx, provider, providerMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return registration.NewTwoWaySyncer(ctx, providerMetadata)
+}
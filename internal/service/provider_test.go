@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/markbates/goth/providers/spotify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+	"golang.org/x/oauth2"
+)
+
+type tokenSourceFunc func(ctx context.Context, userID string, provider string) (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token(ctx context.Context, userID string, provider string) (*oauth2.Token, error) {
+	return f(ctx, userID, provider)
+}
+
+func TestProviderRegistry(t *testing.T) {
+	newConverter := func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (Converter, error) {
+		return nil, nil
+	}
+	newImporter := func(ctx context.Context, providerMetadata model.ConverterServiceProviderMetadata) (Importer, error) {
+		return nil, nil
+	}
+
+	registry := NewProviderRegistry()
+
+	require.NoError(t, registry.Register(ProviderRegistration{
+		Info:         model.ProviderInfo{Name: "b", Auth: model.ProviderAuthRequest},
+		NewConverter: newConverter,
+		NewImporter:  newImporter,
+	}))
+	require.NoError(t, registry.Register(ProviderRegistration{
+		Info:         model.ProviderInfo{Name: "a", Auth: model.ProviderAuthRequest},
+		NewConverter: newConverter,
+	}))
+
+	assert.Error(t, registry.Register(ProviderRegistration{
+		Info:         model.ProviderInfo{Name: "a", Auth: model.ProviderAuthRequest},
+		NewConverter: newConverter,
+	}), "duplicate name")
+	assert.Error(t, registry.Register(ProviderRegistration{
+		Info: model.ProviderInfo{Name: "c", Auth: model.ProviderAuthRequest},
+	}), "no converter")
+	assert.Error(t, registry.Register(ProviderRegistration{
+		Info:         model.ProviderInfo{Name: "d", Auth: model.ProviderAuthOAuth},
+		NewConverter: newConverter,
+	}), "OAuth without goth provider")
+
+	assert.Equal(t, []model.ProviderInfo{
+		{
+			Name:         "b",
+			Auth:         model.ProviderAuthRequest,
+			Metadata:     []model.ProviderMetadataField{},
+			Capabilities: model.ProviderCapabilities{Export: true, Import: true},
+		},
+		{
+			Name:         "a",
+			Auth:         model.ProviderAuthRequest,
+			Metadata:     []model.ProviderMetadataField{},
+			Capabilities: model.ProviderCapabilities{Export: true},
+		},
+	}, registry.List())
+
+	_, ok := registry.Get("c")
+	assert.False(t, ok)
+
+	_, err := registry.Importer(context.Background(), "a", model.ConverterServiceProviderMetadata{})
+	assert.Error(t, err)
+
+	_, err = registry.TwoWaySyncer(context.Background(), "b", model.ConverterServiceProviderMetadata{})
+	assert.ErrorIs(t, err, model.ErrTwoWaySyncUnsupported)
+
+	require.NoError(t, registry.Register(ProviderRegistration{
+		Info:         model.ProviderInfo{Name: "spotify", Auth: model.ProviderAuthOAuth},
+		OAuth:        spotify.New("id", "secret", "callback"),
+		NewConverter: newConverter,
+	}))
+
+	_, err = registry.Authorize(context.Background(), "spotify", model.ConverterServiceProviderMetadata{})
+	assert.ErrorIs(t, err, model.ErrProviderNotConnected)
+
+	registry.UseTokenSource(tokenSourceFunc(func(ctx context.Context, userID string, provider string) (*oauth2.Token, error) {
+		return &oauth2.Token{AccessToken: userID + "-" + provider}, nil
+	}))
+	providerMetadata, err := registry.Authorize(context.Background(), "spotify", model.ConverterServiceProviderMetadata{UserID: "user"})
+	require.NoError(t, err)
+	assert.Equal(t, "user-spotify", providerMetadata.Token.AccessToken)
+}
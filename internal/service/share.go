@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type PlaylistShareRepository interface {
+	Insert(ctx context.Context, token string, playlistID int, createdBy string) (model.PlaylistShare, error)
+	SelectAll(ctx context.Context, playlistID int) ([]model.PlaylistShare, error)
+	SelectPlaylistID(ctx context.Context, token string) (int, bool, error)
+	Delete(ctx context.Context, playlistID int, token string) error
+}
+
+type ShareService struct {
+	shareRepo        PlaylistShareRepository
+	playlistRepo     PlaylistRepository
+	playlistSongRepo PlaylistSongRepository
+}
+
+func NewShare(
+	shareRepo PlaylistShareRepository,
+	playlistRepo PlaylistRepository,
+	playlistSongRepo PlaylistSongRepository,
+) *ShareService {
+	return &ShareService{
+		shareRepo:        shareRepo,
+		playlistRepo:     playlistRepo,
+		playlistSongRepo: playlistSongRepo,
+	}
+}
+
+// Create returns a new share link token giving read-only access to the playlist.
+func (s *ShareService) Create(ctx context.Context, playlistID int, createdBy string) (model.PlaylistShare, error) {
+	token, err := newToken()
+	if err != nil {
+		return model.PlaylistShare{}, err
+	}
+
+	return s.shareRepo.Insert(ctx, token, playlistID, createdBy)
+}
+
+func (s *ShareService) GetAll(ctx context.Context, playlistID int) ([]model.PlaylistShare, error) {
+	return s.shareRepo.SelectAll(ctx, playlistID)
+}
+
+func (s *ShareService) Revoke(ctx context.Context, playlistID int, token string) error {
+	return s.shareRepo.Delete(ctx, playlistID, token)
+}
+
+// GetPlaylistID returns the ID of the playlist shared with the token, or model.ErrShareNotFound when it was revoked.
+func (s *ShareService) GetPlaylistID(ctx context.Context, token string) (int, error) {
+	return s.playlistID(ctx, token)
+}
+
+// GetPlaylist returns the playlist shared with the token, or model.ErrShareNotFound when it was revoked.
+// The cover URL is signed on every call so it keeps working for anonymous viewers.
+func (s *ShareService) GetPlaylist(ctx context.Context, token string) (model.Playlist, error) {
+	playlistID, err := s.playlistID(ctx, token)
+	if err != nil {
+		return model.Playlist{}, err
+	}
+
+	playlist, err := s.playlistRepo.SelectWithID(ctx, playlistID)
+	if err != nil {
+		return model.Playlist{}, err
+	}
+
+	return publicPlaylist(playlist), nil
+}
+
+func (s *ShareService) GetSongs(ctx context.Context, token string, sortBy string, sortOrder string) ([]model.SongOutAPI, error) {
+	playlistID, err := s.playlistID(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	songs, err := s.playlistSongRepo.GetAll(ctx, playlistID, sortBy, sortOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	return publicSongs(songs), nil
+}
+
+func (s *ShareService) playlistID(ctx context.Context, token string) (int, error) {
+	playlistID, found, err := s.shareRepo.SelectPlaylistID(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, model.ErrShareNotFound
+	}
+
+	return playlistID, nil
+}
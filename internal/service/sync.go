@@ -0,0 +1,435 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+const (
+	autoSyncPollInterval = time.Minute
+	autoSyncInterval     = 15 * time.Minute
+	syncLockTTL          = 10 * time.Minute
+)
+
+type TwoWaySyncer interface {
+	SearchAndMatch(ctx context.Context, song model.SongOutAPI) model.SongMatchResult
+	SnapshotID(ctx context.Context, remotePlaylistID string) (string, error)
+	PlaylistTracks(ctx context.Context, remotePlaylistID string) (string, []model.RemoteTrack, error)
+	ReplaceTracks(ctx context.Context, remotePlaylistID string, trackIDs []string) (string, error)
+}
+
+type TwoWaySyncRepository interface {
+	Select(ctx context.Context, playlistID int, provider string) (model.PlaylistRemoteLink, bool, error)
+	SaveTwoWayState(ctx context.Context, link model.PlaylistRemoteLink, status model.JobStatus) error
+	SaveTwoWayError(ctx context.Context, playlistID int, provider string, errMessage string) error
+	UpdateAutoSync(ctx context.Context, playlistID int, provider string, autoSync bool, providerMetadata model.ConverterServiceProviderMetadata) error
+	SelectProviderMetadata(ctx context.Context, playlistID int, provider string) (model.ConverterServiceProviderMetadata, error)
+	SelectAutoSyncDue(ctx context.Context, syncedBefore time.Time) ([]model.PlaylistRemoteLink, error)
+	Lock(ctx context.Context, playlistID int, provider string, ttl time.Duration) (bool, error)
+	Unlock(ctx context.Context, playlistID int, provider string) error
+}
+
+type SongSaver interface {
+	SaveSongs(ctx context.Context, songs []model.SongInAPI) ([]int, error)
+}
+
+type SyncService struct {
+	remoteLinkRepo   TwoWaySyncRepository
+	playlistSongRepo PlaylistSongRepository
+	songSaver        SongSaver
+	providers        *ProviderRegistry
+	wg               sync.WaitGroup
+}
+
+func NewSync(
+	remoteLinkRepo TwoWaySyncRepository,
+	playlistSongRepo PlaylistSongRepository,
+	songSaver SongSaver,
+	providers *ProviderRegistry,
+) *SyncService {
+	return &SyncService{
+		remoteLinkRepo:   remoteLinkRepo,
+		playlistSongRepo: playlistSongRepo,
+		songSaver:        songSaver,
+		providers:        providers,
+	}
+}
+
+// Start runs the scheduled two-way sync of playlists with auto sync turned on until ctx is cancelled.
+func (s *SyncService) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go s.runSchedule(ctx)
+}
+
+// Wait blocks until the scheduler has stopped.
+func (s *SyncService) Wait() {
+	s.wg.Wait()
+}
+
+// TwoWaySync merges the changes made to the playlist and to the remote playlist it was exported to
+// since their last sync, and applies the result to both. autoSync turns the scheduled sync on or off.
+func (s *SyncService) TwoWaySync(
+	ctx context.Context,
+	playlistID int,
+	provider string,
+	providerMetadata model.ConverterServiceProviderMetadata,
+	autoSync bool,
+	resolve model.SyncSide,
+) (model.TwoWaySyncResult, error) {
+	err := s.remoteLinkRepo.UpdateAutoSync(ctx, playlistID, provider, autoSync, providerMetadata)
+	if err != nil {
+		return model.TwoWaySyncResult{}, err
+	}
+
+	return s.sync(ctx, playlistID, provider, providerMetadata, resolve)
+}
+
+func (s *SyncService) runSchedule(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(autoSyncPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		links, err := s.remoteLinkRepo.SelectAutoSyncDue(ctx, time.Now().Add(-autoSyncInterval))
+		if err != nil {
+			log.Printf("error selecting playlists to sync: %v", err)
+			continue
+		}
+
+		for _, link := range links {
+			if ctx.Err() != nil {
+				return
+			}
+
+			providerMetadata, err := s.remoteLinkRepo.SelectProviderMetadata(ctx, link.PlaylistID, link.Provider)
+			if err != nil {
+				log.Printf("error getting provider metadata to sync playlist %d with %s: %v", link.PlaylistID, link.Provider, err)
+				continue
+			}
+
+			_, err = s.sync(ctx, link.PlaylistID, link.Provider, providerMetadata, "")
+			if err != nil {
+				log.Printf("error syncing playlist %d with %s: %v", link.PlaylistID, link.Provider, err)
+			}
+		}
+	}
+}
+
+func (s *SyncService) sync(
+	ctx context.Context,
+	playlistID int,
+	provider string,
+	providerMetadata model.ConverterServiceProviderMetadata,
+	resolve model.SyncSide,
+) (model.TwoWaySyncResult, error) {
+	syncer, err := s.providers.TwoWaySyncer(ctx, provider, providerMetadata)
+	if err != nil {
+		return model.TwoWaySyncResult{}, err
+	}
+
+	_, linked, err := s.remoteLinkRepo.Select(ctx, playlistID, provider)
+	if err != nil {
+		return model.TwoWaySyncResult{}, err
+	}
+	if !linked {
+		return model.TwoWaySyncResult{}, model.ErrRemoteLinkNotFound
+	}
+
+	locked, err := s.remoteLinkRepo.Lock(ctx, playlistID, provider, syncLockTTL)
+	if err != nil {
+		return model.TwoWaySyncResult{}, err
+	}
+	if !locked {
+		return model.TwoWaySyncResult{}, model.ErrSyncInProgress
+	}
+	defer func() {
+		// use a fresh context so the lock is released even when ctx is cancelled
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := s.remoteLinkRepo.Unlock(unlockCtx, playlistID, provider); err != nil {
+			log.Printf("error unlocking sync of playlist %d with %s: %v", playlistID, provider, err)
+		}
+	}()
+
+	// read the link again now that no other sync can change it
+	link, _, err := s.remoteLinkRepo.Select(ctx, playlistID, provider)
+	if err != nil {
+		return model.TwoWaySyncResult{}, err
+	}
+
+	result, err := s.mergeAndApply(ctx, syncer, link, resolve)
+	if err != nil {
+		saveErr := s.remoteLinkRepo.SaveTwoWayError(ctx, playlistID, provider, err.Error())
+		if saveErr != nil {
+			log.Printf("error saving failed sync of playlist %d with %s: %v", playlistID, provider, saveErr)
+		}
+		return model.TwoWaySyncResult{}, err
+	}
+
+	return result, nil
+}
+
+// mergeAndApply does the three-way merge of the playlist, the remote playlist and the state they had
+// after the last sync, which is stored on the link, then applies the merge to both playlists.
+// Items are keyed by provider track ID. Songs that don't match any track only exist locally so they
+// are left out of the merge and keep their place next to the song preceding them.
+func (s *SyncService) mergeAndApply(
+	ctx context.Context,
+	syncer TwoWaySyncer,
+	link model.PlaylistRemoteLink,
+	resolve model.SyncSide,
+) (model.TwoWaySyncResult, error) {
+	result := model.TwoWaySyncResult{
+		Provider:         link.Provider,
+		RemotePlaylistID: link.RemotePlaylistID,
+	}
+
+	localSongs, err := s.playlistSongRepo.GetAll(ctx, link.PlaylistID, "", "")
+	if err != nil {
+		return model.TwoWaySyncResult{}, err
+	}
+
+	songTrackIDs := make(map[int]string, len(localSongs))
+	for songID, trackID := range link.SongTrackIDs {
+		songTrackIDs[songID] = trackID
+	}
+
+	// songs added locally since the last sync are matched once
+	for _, song := range localSongs {
+		if _, ok := songTrackIDs[song.ID]; ok {
+			continue
+		}
+
+		match := syncer.SearchAndMatch(ctx, song)
+		if ctx.Err() != nil {
+			return model.TwoWaySyncResult{}, ctx.Err()
+		}
+		// a failed search is retried on the next sync
+		if match.Error == "" {
+			songTrackIDs[song.ID] = match.ProviderTrackID
+		}
+	}
+
+	localKeys := make([]string, 0, len(localSongs))
+	localOnly := make(map[string]bool)
+	trackSongIDs := make(map[string]int, len(localSongs))
+	for _, song := range localSongs {
+		trackID := songTrackIDs[song.ID]
+		if trackID == "" || trackSongIDs[trackID] != 0 {
+			key := localOnlyKey(song.ID)
+			localKeys = append(localKeys, key)
+			localOnly[key] = true
+			result.Unmatched = append(result.Unmatched, song)
+			continue
+		}
+
+		localKeys = append(localKeys, trackID)
+		trackSongIDs[trackID] = song.ID
+	}
+
+	snapshotID, err := syncer.SnapshotID(ctx, link.RemotePlaylistID)
+	if err != nil {
+		return model.TwoWaySyncResult{}, err
+	}
+
+	// the remote playlist didn't change since the last sync so it holds the synced tracks
+	remoteKeys := uniqueKeys(link.TrackIDs)
+	remoteSongs := make(map[string]model.SongInAPI)
+	if snapshotID == "" || snapshotID != link.SnapshotID {
+		var remoteTracks []model.RemoteTrack
+		snapshotID, remoteTracks, err = syncer.PlaylistTracks(ctx, link.RemotePlaylistID)
+		if err != nil {
+			return model.TwoWaySyncResult{}, err
+		}
+
+		trackIDs := make([]string, len(remoteTracks))
+		for i, track := range remoteTracks {
+			trackIDs[i] = track.ProviderTrackID
+			remoteSongs[track.ProviderTrackID] = track.Song
+		}
+		remoteKeys = uniqueKeys(trackIDs)
+	}
+
+	matchedLocalKeys := slices.DeleteFunc(slices.Clone(localKeys), func(key string) bool { return localOnly[key] })
+	merged := mergeOrders(uniqueKeys(link.TrackIDs), matchedLocalKeys, remoteKeys, resolve)
+	result.Conflicts = merged.conflicts
+
+	// tracks added remotely are added to the catalog before the local playlist
+	var newTrackIDs []string
+	var newSongs []model.SongInAPI
+	for _, trackID := range merged.local {
+		if trackSongIDs[trackID] == 0 {
+			newTrackIDs = append(newTrackIDs, trackID)
+			newSongs = append(newSongs, remoteSongs[trackID])
+		}
+	}
+
+	if len(newSongs) > 0 {
+		newSongIDs, err := s.songSaver.SaveSongs(ctx, newSongs)
+		if err != nil {
+			return model.TwoWaySyncResult{}, err
+		}
+
+		for i, songID := range newSongIDs {
+			songTrackIDs[songID] = newTrackIDs[i]
+			trackSongIDs[newTrackIDs[i]] = songID
+		}
+	}
+
+	err = s.applyLocal(ctx, link.PlaylistID, localKeys, merged.local, localOnly, trackSongIDs, &result)
+	if err != nil {
+		return model.TwoWaySyncResult{}, err
+	}
+
+	if !slices.Equal(remoteKeys, merged.remote) {
+		snapshotID, err = syncer.ReplaceTracks(ctx, link.RemotePlaylistID, merged.remote)
+		if err != nil {
+			return model.TwoWaySyncResult{}, err
+		}
+
+		inRemote, inMerged := keySet(remoteKeys), keySet(merged.remote)
+		for _, key := range merged.remote {
+			if !inRemote[key] {
+				result.AddedToRemote++
+			}
+		}
+		for _, key := range remoteKeys {
+			if !inMerged[key] {
+				result.RemovedFromRemote++
+			}
+		}
+		result.RemoteReordered = !slices.Equal(keepKeys(remoteKeys, inMerged), keepKeys(merged.remote, inRemote))
+	}
+
+	link.TrackIDs = merged.base
+	link.SongTrackIDs = songTrackIDs
+	link.SnapshotID = snapshotID
+	link.Conflicts = merged.conflicts
+	// the stored tracks aren't the remote order while a conflict is open so the remote playlist is read again
+	if len(merged.conflicts) > 0 {
+		link.SnapshotID = ""
+	}
+
+	status := model.JobStatusSucceeded
+	if len(result.Conflicts) > 0 || len(result.Unmatched) > 0 {
+		status = model.JobStatusPartiallySucceeded
+	}
+
+	err = s.remoteLinkRepo.SaveTwoWayState(ctx, link, status)
+	if err != nil {
+		return model.TwoWaySyncResult{}, err
+	}
+
+	return result, nil
+}
+
+// applyLocal removes, adds and reorders the songs of the playlist so they follow mergedKeys, in one transaction.
+// Songs only in the local playlist are put back after the song preceding them.
+func (s *SyncService) applyLocal(
+	ctx context.Context,
+	playlistID int,
+	localKeys []string,
+	mergedKeys []string,
+	localOnly map[string]bool,
+	trackSongIDs map[string]int,
+	result *model.TwoWaySyncResult,
+) error {
+	finalKeys := insertAdditions(mergedKeys, localKeys, localOnly)
+
+	finalSongIDs := make([]int, len(finalKeys))
+	for i, key := range finalKeys {
+		if localOnly[key] {
+			songID, err := strconv.Atoi(key[len(localOnlyKeyPrefix):])
+			if err != nil {
+				return fmt.Errorf("parse local song key %s: %w", key, err)
+			}
+			finalSongIDs[i] = songID
+			continue
+		}
+		finalSongIDs[i] = trackSongIDs[key]
+	}
+
+	// the songs are compared again in the transaction, so the result counts the changes made to the playlist
+	// even when it changed since the merge
+	var removedSongIDs, addedSongIDs []int
+	var reordered bool
+	// songs added on the provider aren't attributed to a user
+	err := s.playlistSongRepo.Rewrite(ctx, playlistID, "", model.PlaylistChangeSynced, func(songs []model.SongOutAPI) ([]int, error) {
+		currentSongIDs := make([]int, len(songs))
+		for i, song := range songs {
+			currentSongIDs[i] = song.ID
+		}
+
+		inCurrent, inFinal := make(map[int]bool, len(currentSongIDs)), make(map[int]bool, len(finalSongIDs))
+		for _, songID := range currentSongIDs {
+			inCurrent[songID] = true
+		}
+		for _, songID := range finalSongIDs {
+			inFinal[songID] = true
+		}
+
+		for _, songID := range currentSongIDs {
+			if !inFinal[songID] {
+				removedSongIDs = append(removedSongIDs, songID)
+			}
+		}
+		for _, songID := range finalSongIDs {
+			if !inCurrent[songID] {
+				addedSongIDs = append(addedSongIDs, songID)
+			}
+		}
+
+		keptCurrent := slices.DeleteFunc(slices.Clone(currentSongIDs), func(songID int) bool { return !inFinal[songID] })
+		keptFinal := slices.DeleteFunc(slices.Clone(finalSongIDs), func(songID int) bool { return !inCurrent[songID] })
+		reordered = !slices.Equal(keptCurrent, keptFinal)
+
+		return finalSongIDs, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	result.RemovedFromLocal = len(removedSongIDs)
+	result.AddedToLocal = len(addedSongIDs)
+	result.LocalReordered = reordered
+
+	return nil
+}
+
+const localOnlyKeyPrefix = "song:"
+
+func localOnlyKey(songID int) string {
+	return localOnlyKeyPrefix + strconv.Itoa(songID)
+}
+
+// uniqueKeys returns the keys without their repeated occurrences.
+func uniqueKeys(keys []string) []string {
+	seen := make(map[string]bool, len(keys))
+	unique := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
+
+func keepKeys(keys []string, keep map[string]bool) []string {
+	return slices.DeleteFunc(slices.Clone(keys), func(key string) bool { return !keep[key] })
+}
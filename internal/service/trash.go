@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+const (
+	trashPurgeInterval = time.Hour
+	trashRetention     = 30 * 24 * time.Hour
+)
+
+type TrashRepository interface {
+	SelectTrash(ctx context.Context, userID string) ([]model.Playlist, error)
+	RestoreFromTrash(ctx context.Context, id int, userID string) (bool, error)
+	SelectExpiredTrash(ctx context.Context, trashedBefore time.Time) ([]int, error)
+	PurgeTrashed(ctx context.Context, id int, userID string) (bool, error)
+}
+
+type TrashService struct {
+	playlistRepo TrashRepository
+	wg           sync.WaitGroup
+}
+
+func NewTrash(playlistRepo TrashRepository) *TrashService {
+	return &TrashService{
+		playlistRepo: playlistRepo,
+	}
+}
+
+// Start purges the playlists that have been in the trash for longer than the retention until ctx is cancelled.
+func (t *TrashService) Start(ctx context.Context) {
+	t.wg.Add(1)
+	go t.runPurge(ctx)
+}
+
+// Wait blocks until the purge has stopped.
+func (t *TrashService) Wait() {
+	t.wg.Wait()
+}
+
+// GetAll returns the playlists of the user in the trash.
+func (t *TrashService) GetAll(ctx context.Context, userID string) ([]model.Playlist, error) {
+	return t.playlistRepo.SelectTrash(ctx, userID)
+}
+
+// Restore takes the playlist of the user out of the trash, or returns model.ErrPlaylistNotFound
+// when the user has no such playlist in the trash.
+func (t *TrashService) Restore(ctx context.Context, id int, userID string) error {
+	restored, err := t.playlistRepo.RestoreFromTrash(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return model.ErrPlaylistNotFound
+	}
+
+	return nil
+}
+
+// Purge deletes the playlist of the user in the trash for good without waiting for the retention,
+// or returns model.ErrPlaylistNotFound when the user has no such playlist in the trash.
+func (t *TrashService) Purge(ctx context.Context, id int, userID string) error {
+	purged, err := t.playlistRepo.PurgeTrashed(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+	if !purged {
+		return model.ErrPlaylistNotFound
+	}
+
+	return nil
+}
+
+func (t *TrashService) runPurge(ctx context.Context) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		playlistIDs, err := t.playlistRepo.SelectExpiredTrash(ctx, time.Now().Add(-trashRetention))
+		if err != nil {
+			log.Printf("error selecting playlists to purge from the trash: %v", err)
+			continue
+		}
+
+		for _, playlistID := range playlistIDs {
+			if ctx.Err() != nil {
+				return
+			}
+
+			// the playlist may have been restored or purged by its user in the meantime
+			_, err := t.playlistRepo.PurgeTrashed(ctx, playlistID, "")
+			if err != nil {
+				log.Printf("error purging playlist %d from the trash: %v", playlistID, err)
+			}
+		}
+	}
+}
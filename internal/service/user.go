@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+type UserRepository interface {
+	Insert(ctx context.Context, user model.UserInDB) error
+	SelectWithID(ctx context.Context, id string) (model.User, bool, error)
+	Update(ctx context.Context, id string, user model.UserUpdate) error
+}
+
+type UserService struct {
+	userRepo       UserRepository
+	credentialRepo ProviderCredentialRepository
+	// registered holds the IDs of users known to exist, so signed in users are only created once
+	registered sync.Map
+}
+
+func NewUser(userRepo UserRepository, credentialRepo ProviderCredentialRepository) *UserService {
+	return &UserService{
+		userRepo:       userRepo,
+		credentialRepo: credentialRepo,
+	}
+}
+
+// Register creates the user the first time they sign in, with the profile from their token.
+func (u *UserService) Register(ctx context.Context, userID string, displayName string, avatarURL string) error {
+	if _, ok := u.registered.Load(userID); ok {
+		return nil
+	}
+
+	if displayName == "" {
+		displayName = userID
+	}
+
+	err := u.userRepo.Insert(ctx, model.UserInDB{
+		ID:          userID,
+		DisplayName: displayName,
+		AvatarURL:   sql.NullString{String: avatarURL, Valid: avatarURL != ""},
+	})
+	if err != nil {
+		return err
+	}
+
+	u.registered.Store(userID, struct{}{})
+
+	return nil
+}
+
+// Get returns the profile of the user with the providers they are logged in to.
+func (u *UserService) Get(ctx context.Context, userID string) (model.User, error) {
+	user, found, err := u.userRepo.SelectWithID(ctx, userID)
+	if err != nil {
+		return model.User{}, err
+	}
+	if !found {
+		return model.User{}, model.ErrUserNotFound
+	}
+
+	user.ConnectedProviders, err = u.credentialRepo.SelectProviders(ctx, userID)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return user, nil
+}
+
+func (u *UserService) Update(ctx context.Context, userID string, user model.UserUpdate) (model.User, error) {
+	err := u.userRepo.Update(ctx, userID, user)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	return u.Get(ctx, userID)
+}
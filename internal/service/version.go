@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/tuannamnguyen/playlist-manager/internal/model"
+)
+
+// PlaylistVersionRepository reads the history of playlists. Versions are recorded by the repositories
+// in the transaction of every change to a playlist.
+type PlaylistVersionRepository interface {
+	SelectAll(ctx context.Context, playlistID int) ([]model.PlaylistVersion, error)
+	Select(ctx context.Context, playlistID int, version int) (model.PlaylistVersion, bool, error)
+	Restore(ctx context.Context, playlistVersion model.PlaylistVersion) error
+}
+
+type SongFinder interface {
+	SelectWithIDs(ctx context.Context, songsID []int) ([]model.SongOutAPI, error)
+}
+
+type VersionService struct {
+	versionRepo PlaylistVersionRepository
+	songFinder  SongFinder
+}
+
+func NewVersion(versionRepo PlaylistVersionRepository, songFinder SongFinder) *VersionService {
+	return &VersionService{
+		versionRepo: versionRepo,
+		songFinder:  songFinder,
+	}
+}
+
+// GetAll returns the history of the playlist from its latest version.
+func (v *VersionService) GetAll(ctx context.Context, playlistID int) ([]model.PlaylistVersion, error) {
+	return v.versionRepo.SelectAll(ctx, playlistID)
+}
+
+// Diff returns what changed from a version of the playlist to another.
+func (v *VersionService) Diff(ctx context.Context, playlistID int, from int, to int) (model.PlaylistVersionDiff, error) {
+	fromVersion, err := v.get(ctx, playlistID, from)
+	if err != nil {
+		return model.PlaylistVersionDiff{}, err
+	}
+
+	toVersion, err := v.get(ctx, playlistID, to)
+	if err != nil {
+		return model.PlaylistVersionDiff{}, err
+	}
+
+	diff := model.PlaylistVersionDiff{
+		From:         from,
+		To:           to,
+		AddedSongs:   []model.SongOutAPI{},
+		RemovedSongs: []model.SongOutAPI{},
+	}
+	if fromVersion.Name != toVersion.Name {
+		diff.Name = &model.ValueChange{From: fromVersion.Name, To: toVersion.Name}
+	}
+	if fromVersion.PlaylistDescription != toVersion.PlaylistDescription {
+		diff.PlaylistDescription = &model.ValueChange{From: fromVersion.PlaylistDescription, To: toVersion.PlaylistDescription}
+	}
+
+	added, removed, reordered := diffVersionSongs(fromVersion.Songs, toVersion.Songs)
+	diff.Reordered = reordered
+
+	songs, err := v.songFinder.SelectWithIDs(ctx, append(slices.Clone(added), removed...))
+	if err != nil {
+		return model.PlaylistVersionDiff{}, err
+	}
+
+	songsByID := make(map[int]model.SongOutAPI, len(songs))
+	for _, song := range songs {
+		songsByID[song.ID] = song
+	}
+	for _, songID := range added {
+		diff.AddedSongs = append(diff.AddedSongs, songsByID[songID])
+	}
+	for _, songID := range removed {
+		diff.RemovedSongs = append(diff.RemovedSongs, songsByID[songID])
+	}
+
+	return diff, nil
+}
+
+// Restore puts the playlist back to a version and records it as a new version, which is returned.
+func (v *VersionService) Restore(ctx context.Context, playlistID int, version int) (model.PlaylistVersion, error) {
+	playlistVersion, err := v.get(ctx, playlistID, version)
+	if err != nil {
+		return model.PlaylistVersion{}, err
+	}
+
+	err = v.versionRepo.Restore(ctx, playlistVersion)
+	if err != nil {
+		return model.PlaylistVersion{}, err
+	}
+
+	versions, err := v.versionRepo.SelectAll(ctx, playlistID)
+	if err != nil {
+		return model.PlaylistVersion{}, err
+	}
+
+	return versions[0], nil
+}
+
+func (v *VersionService) get(ctx context.Context, playlistID int, version int) (model.PlaylistVersion, error) {
+	playlistVersion, found, err := v.versionRepo.Select(ctx, playlistID, version)
+	if err != nil {
+		return model.PlaylistVersion{}, err
+	}
+	if !found {
+		return model.PlaylistVersion{}, model.ErrVersionNotFound
+	}
+
+	return playlistVersion, nil
+}
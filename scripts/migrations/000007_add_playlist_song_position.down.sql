@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS playlist_song_playlist_id_position_idx;
+
+ALTER TABLE playlist_song
+DROP COLUMN IF EXISTS position;
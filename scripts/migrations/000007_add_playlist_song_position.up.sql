@@ -0,0 +1,15 @@
+ALTER TABLE playlist_song
+ADD COLUMN IF NOT EXISTS position INT;
+
+UPDATE playlist_song AS pls
+SET position = ordered.position
+FROM (
+    SELECT playlist_id, song_id, ROW_NUMBER() OVER (PARTITION BY playlist_id ORDER BY created_at, song_id) - 1 AS position
+    FROM playlist_song
+) AS ordered
+WHERE pls.playlist_id = ordered.playlist_id AND pls.song_id = ordered.song_id;
+
+ALTER TABLE playlist_song
+ALTER COLUMN position SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS playlist_song_playlist_id_position_idx ON playlist_song (playlist_id, position);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS set_timestamp_conversion_job_song ON conversion_job_song;
+DROP TRIGGER IF EXISTS set_timestamp_conversion_job ON conversion_job;
+
+DROP TABLE IF EXISTS conversion_job_song;
+DROP TABLE IF EXISTS conversion_job;
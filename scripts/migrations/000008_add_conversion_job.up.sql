@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS conversion_job (
+    job_id SERIAL PRIMARY KEY,
+    playlist_id INT NOT NULL,
+    provider TEXT NOT NULL,
+    playlist_name TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    provider_metadata JSONB NOT NULL,
+    remote_playlist_id TEXT,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS conversion_job_status_idx ON conversion_job (status);
+
+CREATE TRIGGER set_timestamp_conversion_job
+BEFORE UPDATE ON conversion_job
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+CREATE TABLE IF NOT EXISTS conversion_job_song (
+    job_id INT NOT NULL,
+    position INT NOT NULL,
+    song JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    result JSONB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (job_id, position),
+    FOREIGN KEY (job_id) REFERENCES conversion_job(job_id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER set_timestamp_conversion_job_song
+BEFORE UPDATE ON conversion_job_song
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS set_timestamp_playlist_remote_link ON playlist_remote_link;
+
+DROP TABLE IF EXISTS playlist_remote_link;
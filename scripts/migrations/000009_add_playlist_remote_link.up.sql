@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS playlist_remote_link (
+    playlist_id INT NOT NULL,
+    provider TEXT NOT NULL,
+    remote_playlist_id TEXT NOT NULL,
+    remote_playlist_name TEXT NOT NULL,
+    track_ids JSONB NOT NULL DEFAULT '[]',
+    synced_job_id INT,
+    synced_at TIMESTAMP,
+    last_job_id INT,
+    last_sync_status TEXT,
+    last_sync_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (playlist_id, provider),
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE,
+    FOREIGN KEY (synced_job_id) REFERENCES conversion_job(job_id) ON DELETE SET NULL,
+    FOREIGN KEY (last_job_id) REFERENCES conversion_job(job_id) ON DELETE SET NULL
+);
+
+CREATE TRIGGER set_timestamp_playlist_remote_link
+BEFORE UPDATE ON playlist_remote_link
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
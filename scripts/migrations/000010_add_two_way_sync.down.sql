@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS playlist_remote_link_auto_sync_idx;
+
+ALTER TABLE playlist_remote_link
+DROP COLUMN IF EXISTS song_track_ids,
+DROP COLUMN IF EXISTS snapshot_id,
+DROP COLUMN IF EXISTS auto_sync,
+DROP COLUMN IF EXISTS provider_metadata,
+DROP COLUMN IF EXISTS conflicts,
+DROP COLUMN IF EXISTS two_way_synced_at,
+DROP COLUMN IF EXISTS sync_locked_until;
@@ -0,0 +1,10 @@
+ALTER TABLE playlist_remote_link
+ADD COLUMN IF NOT EXISTS song_track_ids JSONB NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS snapshot_id TEXT,
+ADD COLUMN IF NOT EXISTS auto_sync BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS provider_metadata JSONB,
+ADD COLUMN IF NOT EXISTS conflicts JSONB NOT NULL DEFAULT '[]',
+ADD COLUMN IF NOT EXISTS two_way_synced_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS sync_locked_until TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS playlist_remote_link_auto_sync_idx ON playlist_remote_link (auto_sync, two_way_synced_at);
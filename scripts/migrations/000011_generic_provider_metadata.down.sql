@@ -0,0 +1,19 @@
+UPDATE conversion_job
+SET provider_metadata = jsonb_build_object(
+    'AppleMusic', jsonb_build_object('MusicUserToken', COALESCE(provider_metadata -> 'Values' ->> 'musicUserToken', '')),
+    'Spotify', jsonb_build_object('Token', CASE WHEN provider = 'spotify' THEN provider_metadata -> 'Token' END),
+    'YouTubeMusic', jsonb_build_object('Token', CASE WHEN provider = 'youtubemusic' THEN provider_metadata -> 'Token' END),
+    'Deezer', jsonb_build_object('Token', CASE WHEN provider = 'deezer' THEN provider_metadata -> 'Token' END),
+    'Tidal', jsonb_build_object('Token', CASE WHEN provider = 'tidal' THEN provider_metadata -> 'Token' END)
+)
+WHERE provider_metadata ? 'Values';
+
+UPDATE playlist_remote_link
+SET provider_metadata = jsonb_build_object(
+    'AppleMusic', jsonb_build_object('MusicUserToken', COALESCE(provider_metadata -> 'Values' ->> 'musicUserToken', '')),
+    'Spotify', jsonb_build_object('Token', CASE WHEN provider = 'spotify' THEN provider_metadata -> 'Token' END),
+    'YouTubeMusic', jsonb_build_object('Token', CASE WHEN provider = 'youtubemusic' THEN provider_metadata -> 'Token' END),
+    'Deezer', jsonb_build_object('Token', CASE WHEN provider = 'deezer' THEN provider_metadata -> 'Token' END),
+    'Tidal', jsonb_build_object('Token', CASE WHEN provider = 'tidal' THEN provider_metadata -> 'Token' END)
+)
+WHERE provider_metadata ? 'Values';
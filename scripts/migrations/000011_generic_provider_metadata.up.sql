@@ -0,0 +1,30 @@
+-- provider metadata used to have one object per provider, only the one of the job provider was set
+UPDATE conversion_job
+SET provider_metadata = jsonb_build_object(
+    'Token', provider_metadata -> (CASE provider
+        WHEN 'spotify' THEN 'Spotify'
+        WHEN 'youtubemusic' THEN 'YouTubeMusic'
+        WHEN 'deezer' THEN 'Deezer'
+        WHEN 'tidal' THEN 'Tidal'
+    END) -> 'Token',
+    'Values', CASE provider
+        WHEN 'applemusic' THEN jsonb_build_object('musicUserToken', provider_metadata -> 'AppleMusic' ->> 'MusicUserToken')
+        ELSE '{}'::JSONB
+    END
+)
+WHERE provider_metadata ? 'AppleMusic';
+
+UPDATE playlist_remote_link
+SET provider_metadata = jsonb_build_object(
+    'Token', provider_metadata -> (CASE provider
+        WHEN 'spotify' THEN 'Spotify'
+        WHEN 'youtubemusic' THEN 'YouTubeMusic'
+        WHEN 'deezer' THEN 'Deezer'
+        WHEN 'tidal' THEN 'Tidal'
+    END) -> 'Token',
+    'Values', CASE provider
+        WHEN 'applemusic' THEN jsonb_build_object('musicUserToken', provider_metadata -> 'AppleMusic' ->> 'MusicUserToken')
+        ELSE '{}'::JSONB
+    END
+)
+WHERE provider_metadata ? 'AppleMusic';
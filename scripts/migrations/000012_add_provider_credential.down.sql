@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS set_timestamp_provider_credential ON provider_credential;
+
+DROP TABLE IF EXISTS provider_credential;
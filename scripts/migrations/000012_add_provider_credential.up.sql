@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS provider_credential (
+    user_id TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    provider_user_id TEXT,
+    access_token BYTEA NOT NULL,
+    refresh_token BYTEA,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, provider)
+);
+
+CREATE TRIGGER set_timestamp_provider_credential
+BEFORE UPDATE ON provider_credential
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
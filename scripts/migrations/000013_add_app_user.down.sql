@@ -0,0 +1,16 @@
+ALTER TABLE provider_credential DROP CONSTRAINT IF EXISTS provider_credential_user_id_fkey;
+
+ALTER TABLE playlist
+DROP CONSTRAINT IF EXISTS playlist_user_id_fkey,
+ADD COLUMN IF NOT EXISTS user_name TEXT;
+
+UPDATE playlist AS p
+SET user_name = u.display_name
+FROM app_user AS u
+WHERE u.user_id = p.user_id;
+
+ALTER TABLE playlist ALTER COLUMN user_name SET NOT NULL;
+
+DROP TRIGGER IF EXISTS set_timestamp_app_user ON app_user;
+
+DROP TABLE IF EXISTS app_user;
@@ -0,0 +1,33 @@
+-- "user" is a reserved word in postgres
+CREATE TABLE IF NOT EXISTS app_user (
+    user_id TEXT PRIMARY KEY,
+    display_name TEXT NOT NULL,
+    avatar_url TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER set_timestamp_app_user
+BEFORE UPDATE ON app_user
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+-- backfill the users of existing playlists with the name of their latest playlist,
+-- then the users who only connected a provider
+INSERT INTO app_user (user_id, display_name)
+SELECT DISTINCT ON (user_id) user_id, user_name
+FROM playlist
+ORDER BY user_id, updated_at DESC
+ON CONFLICT (user_id) DO NOTHING;
+
+INSERT INTO app_user (user_id, display_name)
+SELECT DISTINCT user_id, user_id
+FROM provider_credential
+ON CONFLICT (user_id) DO NOTHING;
+
+ALTER TABLE playlist
+ADD CONSTRAINT playlist_user_id_fkey FOREIGN KEY (user_id) REFERENCES app_user(user_id) ON DELETE CASCADE,
+DROP COLUMN IF EXISTS user_name;
+
+ALTER TABLE provider_credential
+ADD CONSTRAINT provider_credential_user_id_fkey FOREIGN KEY (user_id) REFERENCES app_user(user_id) ON DELETE CASCADE;
@@ -0,0 +1,7 @@
+ALTER TABLE playlist_song DROP COLUMN IF EXISTS added_by;
+
+DROP TRIGGER IF EXISTS set_timestamp_playlist_invite ON playlist_invite;
+DROP TRIGGER IF EXISTS set_timestamp_playlist_member ON playlist_member;
+
+DROP TABLE IF EXISTS playlist_invite;
+DROP TABLE IF EXISTS playlist_member;
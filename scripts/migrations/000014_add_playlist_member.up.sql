@@ -0,0 +1,43 @@
+CREATE TABLE IF NOT EXISTS playlist_member (
+    playlist_id INT NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (playlist_id, user_id),
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES app_user(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS playlist_member_user_id_idx ON playlist_member (user_id);
+
+CREATE TRIGGER set_timestamp_playlist_member
+BEFORE UPDATE ON playlist_member
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+-- the user a playlist belongs to is its owner
+INSERT INTO playlist_member (playlist_id, user_id, role)
+SELECT playlist_id, user_id, 'owner'
+FROM playlist
+ON CONFLICT (playlist_id, user_id) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS playlist_invite (
+    token TEXT PRIMARY KEY,
+    playlist_id INT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('editor', 'viewer')),
+    created_by TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES app_user(user_id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER set_timestamp_playlist_invite
+BEFORE UPDATE ON playlist_invite
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+ALTER TABLE playlist_song
+ADD COLUMN IF NOT EXISTS added_by TEXT REFERENCES app_user(user_id) ON DELETE SET NULL;
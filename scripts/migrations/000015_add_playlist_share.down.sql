@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS set_timestamp_playlist_share ON playlist_share;
+
+DROP TABLE IF EXISTS playlist_share;
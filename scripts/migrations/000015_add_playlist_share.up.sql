@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS playlist_share (
+    token TEXT PRIMARY KEY,
+    playlist_id INT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES app_user(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS playlist_share_playlist_id_idx ON playlist_share (playlist_id);
+
+CREATE TRIGGER set_timestamp_playlist_share
+BEFORE UPDATE ON playlist_share
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS set_timestamp_playlist_version ON playlist_version;
+
+DROP TABLE IF EXISTS playlist_version;
@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS playlist_version (
+    playlist_id INT NOT NULL,
+    version INT NOT NULL,
+    change TEXT NOT NULL,
+    restored_from INT,
+    playlist_name TEXT NOT NULL,
+    playlist_description TEXT,
+    songs JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (playlist_id, version),
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER set_timestamp_playlist_version
+BEFORE UPDATE ON playlist_version
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+-- the history of existing playlists starts with their current state
+INSERT INTO playlist_version (playlist_id, version, change, playlist_name, playlist_description, songs)
+SELECT
+    pl.playlist_id,
+    1,
+    'created',
+    pl.playlist_name,
+    pl.playlist_description,
+    COALESCE(
+        (
+            SELECT jsonb_agg(
+                jsonb_build_object('song_id', pls.song_id, 'added_by', pls.added_by, 'added_at', pls.created_at AT TIME ZONE 'UTC')
+                ORDER BY pls.position
+            )
+            FROM playlist_song AS pls
+            WHERE pls.playlist_id = pl.playlist_id
+        ),
+        '[]'
+    )
+FROM playlist AS pl
+ON CONFLICT (playlist_id, version) DO NOTHING;
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS playlist_deleted_at_idx;
+
+-- playlists in the trash were deleted as far as the previous version is concerned
+DELETE FROM playlist WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE playlist DROP COLUMN IF EXISTS deleted_at;
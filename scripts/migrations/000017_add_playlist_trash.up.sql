@@ -0,0 +1,4 @@
+ALTER TABLE playlist
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS playlist_deleted_at_idx ON playlist (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE playlist DROP COLUMN IF EXISTS forked_from;
@@ -0,0 +1,2 @@
+ALTER TABLE playlist
+ADD COLUMN IF NOT EXISTS forked_from INT REFERENCES playlist(playlist_id) ON DELETE SET NULL;
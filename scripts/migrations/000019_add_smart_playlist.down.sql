@@ -0,0 +1,2 @@
+-- smart playlists are left as empty playlists
+ALTER TABLE playlist DROP COLUMN IF EXISTS smart_rules;
@@ -0,0 +1,2 @@
+ALTER TABLE playlist
+ADD COLUMN IF NOT EXISTS smart_rules JSONB;
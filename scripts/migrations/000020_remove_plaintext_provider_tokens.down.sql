@@ -0,0 +1 @@
+-- the removed tokens can't be put back, jobs and links keep the sealed provider metadata
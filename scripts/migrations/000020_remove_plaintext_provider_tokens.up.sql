@@ -0,0 +1,23 @@
+-- provider metadata used to be stored with its tokens in plaintext, the fields sent with the request are now
+-- sealed and OAuth tokens come from provider_credential. Jobs that can't run without the removed tokens fail,
+-- and links lose their scheduled sync until it's turned on again.
+UPDATE conversion_job
+SET status = 'failed', error = 'provider credentials were removed, convert the playlist again'
+WHERE status IN ('queued', 'running')
+    AND (
+        (jsonb_typeof(provider_metadata -> 'Values') = 'object' AND provider_metadata -> 'Values' <> '{}'::JSONB)
+        OR (jsonb_typeof(provider_metadata -> 'Token') = 'object' AND COALESCE(provider_metadata ->> 'UserID', '') = '')
+    );
+
+UPDATE conversion_job
+SET provider_metadata = provider_metadata - 'Token' - 'Values'
+WHERE provider_metadata ?| ARRAY['Token', 'Values'];
+
+UPDATE playlist_remote_link
+SET auto_sync = FALSE, provider_metadata = NULL
+WHERE (jsonb_typeof(provider_metadata -> 'Values') = 'object' AND provider_metadata -> 'Values' <> '{}'::JSONB)
+    OR (jsonb_typeof(provider_metadata -> 'Token') = 'object' AND COALESCE(provider_metadata ->> 'UserID', '') = '');
+
+UPDATE playlist_remote_link
+SET provider_metadata = provider_metadata - 'Token' - 'Values'
+WHERE provider_metadata ?| ARRAY['Token', 'Values'];
@@ -29,10 +29,10 @@ INSERT INTO song (song_name, album_id, image_url, duration) VALUES
 ('Song 3', 3, 'https://picsum.photos/200/300', 180);
 
 -- Insert sample data into the playlist_song table
-INSERT INTO playlist_song (playlist_id, song_id) VALUES
-(1, 1),
-(2, 2),
-(3, 3);
+INSERT INTO playlist_song (playlist_id, song_id, position) VALUES
+(1, 1, 0),
+(2, 2, 0),
+(3, 3, 0);
 
 -- Insert sample data into the artist_song table
 INSERT INTO artist_song (artist_id, song_id, artist_insertion_order) VALUES
@@ -131,4 +131,270 @@ ALTER TABLE playlist
 DROP CONSTRAINT IF EXISTS playlist_playlist_name_user_id_key;
 
 ALTER TABLE playlist
-ADD CONSTRAINT playlist_image_name UNIQUE(image_name)
+ADD CONSTRAINT playlist_image_name UNIQUE(image_name);
+
+ALTER TABLE playlist_song
+ADD COLUMN IF NOT EXISTS position INT NOT NULL;
+
+CREATE INDEX IF NOT EXISTS playlist_song_playlist_id_position_idx ON playlist_song (playlist_id, position);
+
+CREATE TABLE IF NOT EXISTS conversion_job (
+    job_id SERIAL PRIMARY KEY,
+    playlist_id INT NOT NULL,
+    provider TEXT NOT NULL,
+    playlist_name TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'queued',
+    provider_metadata JSONB NOT NULL,
+    remote_playlist_id TEXT,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS conversion_job_status_idx ON conversion_job (status);
+
+CREATE TRIGGER set_timestamp_conversion_job
+BEFORE UPDATE ON conversion_job
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+CREATE TABLE IF NOT EXISTS conversion_job_song (
+    job_id INT NOT NULL,
+    position INT NOT NULL,
+    song JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    result JSONB,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (job_id, position),
+    FOREIGN KEY (job_id) REFERENCES conversion_job(job_id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER set_timestamp_conversion_job_song
+BEFORE UPDATE ON conversion_job_song
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+CREATE TABLE IF NOT EXISTS playlist_remote_link (
+    playlist_id INT NOT NULL,
+    provider TEXT NOT NULL,
+    remote_playlist_id TEXT NOT NULL,
+    remote_playlist_name TEXT NOT NULL,
+    track_ids JSONB NOT NULL DEFAULT '[]',
+    synced_job_id INT,
+    synced_at TIMESTAMP,
+    last_job_id INT,
+    last_sync_status TEXT,
+    last_sync_error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (playlist_id, provider),
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE,
+    FOREIGN KEY (synced_job_id) REFERENCES conversion_job(job_id) ON DELETE SET NULL,
+    FOREIGN KEY (last_job_id) REFERENCES conversion_job(job_id) ON DELETE SET NULL
+);
+
+CREATE TRIGGER set_timestamp_playlist_remote_link
+BEFORE UPDATE ON playlist_remote_link
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+ALTER TABLE playlist_remote_link
+ADD COLUMN IF NOT EXISTS song_track_ids JSONB NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS snapshot_id TEXT,
+ADD COLUMN IF NOT EXISTS auto_sync BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS provider_metadata JSONB,
+ADD COLUMN IF NOT EXISTS conflicts JSONB NOT NULL DEFAULT '[]',
+ADD COLUMN IF NOT EXISTS two_way_synced_at TIMESTAMP,
+ADD COLUMN IF NOT EXISTS sync_locked_until TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS playlist_remote_link_auto_sync_idx ON playlist_remote_link (auto_sync, two_way_synced_at);
+
+CREATE TABLE IF NOT EXISTS provider_credential (
+    user_id TEXT NOT NULL,
+    provider TEXT NOT NULL,
+    provider_user_id TEXT,
+    access_token BYTEA NOT NULL,
+    refresh_token BYTEA,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, provider)
+);
+
+CREATE TRIGGER set_timestamp_provider_credential
+BEFORE UPDATE ON provider_credential
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+-- "user" is a reserved word in postgres
+CREATE TABLE IF NOT EXISTS app_user (
+    user_id TEXT PRIMARY KEY,
+    display_name TEXT NOT NULL,
+    avatar_url TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER set_timestamp_app_user
+BEFORE UPDATE ON app_user
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+-- backfill the users of existing playlists with the name of their latest playlist,
+-- then the users who only connected a provider
+INSERT INTO app_user (user_id, display_name)
+SELECT DISTINCT ON (user_id) user_id, user_name
+FROM playlist
+ORDER BY user_id, updated_at DESC
+ON CONFLICT (user_id) DO NOTHING;
+
+INSERT INTO app_user (user_id, display_name)
+SELECT DISTINCT user_id, user_id
+FROM provider_credential
+ON CONFLICT (user_id) DO NOTHING;
+
+ALTER TABLE playlist
+ADD CONSTRAINT playlist_user_id_fkey FOREIGN KEY (user_id) REFERENCES app_user(user_id) ON DELETE CASCADE,
+DROP COLUMN IF EXISTS user_name;
+
+ALTER TABLE provider_credential
+ADD CONSTRAINT provider_credential_user_id_fkey FOREIGN KEY (user_id) REFERENCES app_user(user_id) ON DELETE CASCADE;
+
+CREATE TABLE IF NOT EXISTS playlist_member (
+    playlist_id INT NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (playlist_id, user_id),
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES app_user(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS playlist_member_user_id_idx ON playlist_member (user_id);
+
+CREATE TRIGGER set_timestamp_playlist_member
+BEFORE UPDATE ON playlist_member
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+-- the user a playlist belongs to is its owner
+INSERT INTO playlist_member (playlist_id, user_id, role)
+SELECT playlist_id, user_id, 'owner'
+FROM playlist
+ON CONFLICT (playlist_id, user_id) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS playlist_invite (
+    token TEXT PRIMARY KEY,
+    playlist_id INT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('editor', 'viewer')),
+    created_by TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES app_user(user_id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER set_timestamp_playlist_invite
+BEFORE UPDATE ON playlist_invite
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+ALTER TABLE playlist_song
+ADD COLUMN IF NOT EXISTS added_by TEXT REFERENCES app_user(user_id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS playlist_share (
+    token TEXT PRIMARY KEY,
+    playlist_id INT NOT NULL,
+    created_by TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES app_user(user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS playlist_share_playlist_id_idx ON playlist_share (playlist_id);
+
+CREATE TRIGGER set_timestamp_playlist_share
+BEFORE UPDATE ON playlist_share
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+CREATE TABLE IF NOT EXISTS playlist_version (
+    playlist_id INT NOT NULL,
+    version INT NOT NULL,
+    change TEXT NOT NULL,
+    restored_from INT,
+    playlist_name TEXT NOT NULL,
+    playlist_description TEXT,
+    songs JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (playlist_id, version),
+    FOREIGN KEY (playlist_id) REFERENCES playlist(playlist_id) ON DELETE CASCADE
+);
+
+CREATE TRIGGER set_timestamp_playlist_version
+BEFORE UPDATE ON playlist_version
+FOR EACH ROW
+EXECUTE PROCEDURE update_updated_at_column();
+
+-- the history of existing playlists starts with their current state
+INSERT INTO playlist_version (playlist_id, version, change, playlist_name, playlist_description, songs)
+SELECT
+    pl.playlist_id,
+    1,
+    'created',
+    pl.playlist_name,
+    pl.playlist_description,
+    COALESCE(
+        (
+            SELECT jsonb_agg(
+                jsonb_build_object('song_id', pls.song_id, 'added_by', pls.added_by, 'added_at', pls.created_at AT TIME ZONE 'UTC')
+                ORDER BY pls.position
+            )
+            FROM playlist_song AS pls
+            WHERE pls.playlist_id = pl.playlist_id
+        ),
+        '[]'
+    )
+FROM playlist AS pl
+ON CONFLICT (playlist_id, version) DO NOTHING;
+
+ALTER TABLE playlist
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS playlist_deleted_at_idx ON playlist (deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE playlist
+ADD COLUMN IF NOT EXISTS forked_from INT REFERENCES playlist(playlist_id) ON DELETE SET NULL;
+
+ALTER TABLE playlist
+ADD COLUMN IF NOT EXISTS smart_rules JSONB;
+
+-- provider metadata used to be stored with its tokens in plaintext, the fields sent with the request are now
+-- sealed and OAuth tokens come from provider_credential. Jobs that can't run without the removed tokens fail,
+-- and links lose their scheduled sync until it's turned on again.
+UPDATE conversion_job
+SET status = 'failed', error = 'provider credentials were removed, convert the playlist again'
+WHERE status IN ('queued', 'running')
+    AND (
+        (jsonb_typeof(provider_metadata -> 'Values') = 'object' AND provider_metadata -> 'Values' <> '{}'::JSONB)
+        OR (jsonb_typeof(provider_metadata -> 'Token') = 'object' AND COALESCE(provider_metadata ->> 'UserID', '') = '')
+    );
+
+UPDATE conversion_job
+SET provider_metadata = provider_metadata - 'Token' - 'Values'
+WHERE provider_metadata ?| ARRAY['Token', 'Values'];
+
+UPDATE playlist_remote_link
+SET auto_sync = FALSE, provider_metadata = NULL
+WHERE (jsonb_typeof(provider_metadata -> 'Values') = 'object' AND provider_metadata -> 'Values' <> '{}'::JSONB)
+    OR (jsonb_typeof(provider_metadata -> 'Token') = 'object' AND COALESCE(provider_metadata ->> 'UserID', '') = '');
+
+UPDATE playlist_remote_link
+SET provider_metadata = provider_metadata - 'Token' - 'Values'
+WHERE provider_metadata ?| ARRAY['Token', 'Values'];